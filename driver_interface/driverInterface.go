@@ -3,7 +3,9 @@ package driver_interface
 import (
 	"github.com/timabell/schema-explorer/params"
 	"github.com/timabell/schema-explorer/schema"
+	"context"
 	"database/sql"
+	"time"
 )
 
 type DbReader interface {
@@ -23,11 +25,34 @@ type DbReader interface {
 	// get some data, obeying sorting, filtering etc in the table params
 	GetSqlRows(databaseName string, table *schema.Table, params *params.TableParams, peekFinder *PeekLookup) (rows *sql.Rows, err error)
 
+	// the statement GetSqlRows runs for the params, with the values inlined so it can be shown to users
+	GetSqlText(databaseName string, table *schema.Table, params *params.TableParams, peekFinder *PeekLookup) string
+
+	// how the database would run the statement GetSqlRows runs for the params, from its explain, without running it
+	GetQueryPlan(databaseName string, table *schema.Table, params *params.TableParams, peekFinder *PeekLookup) (plan *PlanNode, err error)
+
+	// a select of the tables joined along their fks, with the filter values inlined, for users to run in their own sql tools
+	GetJoinSql(databaseName string, join JoinQuery) string
+
 	// get a count for the supplied filters, for use with paging and overview info
 	GetRowCount(databaseName string, table *schema.Table, params *params.TableParams) (rowCount int, err error)
 
-	// get breakdown of most common values in each column
-	GetAnalysis(databaseName string, table *schema.Table) (analysis []schema.ColumnAnalysis, err error)
+	// as GetRowCount, cancelling the query on the server if ctx is done before it finishes
+	GetRowCountContext(ctx context.Context, databaseName string, table *schema.Table, params *params.TableParams) (rowCount int, err error)
+
+	// get breakdown of most common values and summary stats for a column,
+	// only reading the part of the table given by sample, percentage samples are only asked of drivers that support tablesample
+	GetColumnAnalysis(databaseName string, table *schema.Table, col *schema.Column, sample schema.AnalysisSample) (columnAnalysis schema.ColumnAnalysis, err error)
+
+	// count rows matching the supplied filters for each combination of values of the group by columns, largest 1000 groups first
+	GetGroupCounts(databaseName string, table *schema.Table, groupBy []params.GroupByCol, params *params.TableParams) (groups []schema.GroupCount, err error)
+
+	// run an ad-hoc select that can't change anything, i.e. in a read-only transaction that is rolled back,
+	// reading at most rowLimit rows and giving up after timeout
+	RunQuery(databaseName string, query string, rowLimit int, timeout time.Duration) (result QueryResult, err error)
+
+	// find rows with non-null fk values that don't exist in the destination table, most common first
+	GetOrphans(databaseName string, fk *schema.Fk) (orphans schema.FkOrphans, err error)
 
 	// get list of databases on this server (if supported)
 	ListDatabases() (databaseList []string, err error)
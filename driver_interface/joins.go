@@ -0,0 +1,69 @@
+package driver_interface
+
+import (
+	"github.com/timabell/schema-explorer/schema"
+)
+
+// A select of tables joined along fks, built for users to run in their own sql tools.
+// The tables are aliased t0, t1 etc in the order they're listed.
+type JoinQuery struct {
+	Tables  []JoinedTable
+	Filters []JoinFilter
+}
+
+// A table of a JoinQuery, joined along Step to the earlier table at index JoinedTo.
+// Step is nil for the first table, which the others are joined to.
+type JoinedTable struct {
+	Table    *schema.Table
+	Step     *schema.JoinStep
+	JoinedTo int
+}
+
+// Rows where a column of one of the tables, by its index in the query, has the value
+type JoinFilter struct {
+	TableIndex int
+	Column     *schema.Column
+	Value      string
+}
+
+// Each table of the path joined to the one before it
+func JoinQueryFromPath(from *schema.Table, path schema.JoinPath) (join JoinQuery) {
+	join.Tables = append(join.Tables, JoinedTable{Table: from})
+	for ix := range path {
+		join.Tables = append(join.Tables, JoinedTable{Table: path[ix].To(), Step: &path[ix], JoinedTo: ix})
+	}
+	return
+}
+
+// Each table joined along the shortest path from the nearest table already in the query, taking in the tables between.
+// Tables with no path from any of the earlier ones are returned as unjoined instead.
+func JoinQueryForTables(database *schema.Database, tables []*schema.Table) (join JoinQuery, unjoined []*schema.Table) {
+	indexes := map[*schema.Table]int{}
+	for _, table := range tables {
+		if _, joined := indexes[table]; joined {
+			continue
+		}
+		if len(join.Tables) == 0 {
+			indexes[table] = 0
+			join.Tables = append(join.Tables, JoinedTable{Table: table})
+			continue
+		}
+		var shortest schema.JoinPath
+		for _, joined := range join.Tables {
+			paths := database.FindJoinPaths(joined.Table, table, 1)
+			if paths != nil && (shortest == nil || len(paths[0]) < len(shortest)) {
+				shortest = paths[0]
+			}
+		}
+		if shortest == nil {
+			unjoined = append(unjoined, table)
+			continue
+		}
+		for ix := range shortest {
+			step := &shortest[ix]
+			indexes[step.To()] = len(join.Tables)
+			join.Tables = append(join.Tables, JoinedTable{Table: step.To(), Step: step, JoinedTo: indexes[step.From()]})
+		}
+	}
+	return
+}
@@ -1,6 +1,7 @@
 package driver_interface
 
 import (
+	"github.com/timabell/schema-explorer/params"
 	"github.com/timabell/schema-explorer/schema"
 	"fmt"
 )
@@ -10,12 +11,26 @@ import (
 // the two sides.
 type PeekLookup struct {
 	Table                  *schema.Table
+	Columns                schema.ColumnList // table columns selected, in dataset order, empty when selecting all of them
 	Fks                    []*schema.Fk
 	OutboundPeekStartIndex int
 	InboundPeekStartIndex  int
 	PeekColumnCount        int
 }
 
+// Figures out the index of a column of the table in the returned dataset, which is its position in the table
+// unless only some of the columns were selected.
+func (peekFinder *PeekLookup) ColumnIndex(col *schema.Column) (dataIndex int) {
+	if len(peekFinder.Columns) == 0 {
+		return col.Position
+	}
+	dataIndex = peekFinder.Columns.IndexOf(col)
+	if dataIndex < 0 {
+		panic(fmt.Sprintf("column %s wasn't selected in PeekLookup data", col))
+	}
+	return
+}
+
 // Figures out the index of the peek column in the returned dataset for the given fk & column.
 // Intended to be used by the renderer to get the data it needs for peeking.
 func (peekFinder *PeekLookup) Find(peekFk *schema.Fk, peekCol *schema.Column) (peekDataIndex int) {
@@ -40,3 +55,25 @@ func (peekFinder *PeekLookup) FindInbound(peekFk *schema.Fk) (peekDataIndex int)
 	}
 	panic(fmt.Sprintf("Didn't find inbound fk %s in table.InboundFks", peekFk))
 }
+
+// The fks to left join for peeking: the ones with peek columns in the results (in the same order so that the
+// aliases line up with Fks), then any others only needed for sorting or filtering on a peek column.
+func (peekFinder *PeekLookup) JoinFks(tableParams *params.TableParams) (fks []*schema.Fk) {
+	fks = append(fks, peekFinder.Fks...)
+	for _, related := range tableParams.RelatedValues() {
+		if related.PeekFk != nil && JoinIndex(fks, related.PeekFk) < 0 {
+			fks = append(fks, related.PeekFk)
+		}
+	}
+	return
+}
+
+// The index of the fk in the joined fks, which is used for its alias, e.g. fk1
+func JoinIndex(fks []*schema.Fk, fk *schema.Fk) int {
+	for ix, joinFk := range fks {
+		if joinFk == fk {
+			return ix
+		}
+	}
+	return -1
+}
@@ -0,0 +1,69 @@
+package driver_interface
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// A step of a query plan from the database's explain, e.g. a scan of a table, with the steps it reads from
+type PlanNode struct {
+	Label    string   // what the step does, e.g. "Seq Scan on peek"
+	Details  []string // everything else the database said about the step, e.g. "Total Cost: 35.5"
+	Children []*PlanNode
+}
+
+// Builds a plan tree from explain output in json, such as pg's and mysql's.
+// Each object is a node, labelled by labelFor from the key it was found under and its fields.
+// Plain values become details, lists of plain values are joined into one detail,
+// and objects and lists of objects become children.
+func PlanFromJson(planJson []byte, labelFor func(key string, object map[string]interface{}) string) (root *PlanNode, err error) {
+	var plan interface{}
+	err = json.Unmarshal(planJson, &plan)
+	if err != nil {
+		return
+	}
+	root = &PlanNode{Label: "Plan"}
+	addJsonPlanValue(root, "", plan, labelFor)
+	// skip the wrapping that databases put around a single plan, e.g. pg's [{"Plan": {...}}]
+	for len(root.Details) == 0 && len(root.Children) == 1 {
+		root = root.Children[0]
+	}
+	return
+}
+
+func addJsonPlanValue(parent *PlanNode, key string, value interface{}, labelFor func(key string, object map[string]interface{}) string) {
+	switch typedValue := value.(type) {
+	case map[string]interface{}:
+		node := &PlanNode{Label: labelFor(key, typedValue)}
+		var keys []string
+		for childKey := range typedValue {
+			keys = append(keys, childKey)
+		}
+		sort.Strings(keys)
+		for _, childKey := range keys {
+			addJsonPlanValue(node, childKey, typedValue[childKey], labelFor)
+		}
+		if len(node.Details) == 0 && len(node.Children) == 1 {
+			// just a wrapper, e.g. each item in mysql's "nested_loop": [{"table": {...}}, ...]
+			node = node.Children[0]
+		}
+		parent.Children = append(parent.Children, node)
+	case []interface{}:
+		var plainValues []string
+		for _, item := range typedValue {
+			switch item.(type) {
+			case map[string]interface{}, []interface{}:
+				addJsonPlanValue(parent, key, item, labelFor)
+			default:
+				plainValues = append(plainValues, fmt.Sprint(item))
+			}
+		}
+		if len(plainValues) > 0 {
+			parent.Details = append(parent.Details, fmt.Sprintf("%s: %s", key, strings.Join(plainValues, ", ")))
+		}
+	default:
+		parent.Details = append(parent.Details, fmt.Sprintf("%s: %v", key, typedValue))
+	}
+}
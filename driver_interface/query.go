@@ -0,0 +1,49 @@
+package driver_interface
+
+import (
+	"database/sql"
+	"strings"
+)
+
+// The rows of an ad-hoc query, as they came back from the database
+type QueryResult struct {
+	Columns   []string
+	TypeNames []string // lower case database type of each column where the driver reports it, e.g. "varchar"
+	Rows      [][]interface{}
+	Truncated bool // there were more than the row limit, the rest weren't read
+}
+
+// Reads up to rowLimit rows, for the drivers to share once they've run the query
+func ReadQueryResult(rows *sql.Rows, rowLimit int) (result QueryResult, err error) {
+	result.Columns, err = rows.Columns()
+	if err != nil {
+		return
+	}
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return
+	}
+	for _, columnType := range columnTypes {
+		result.TypeNames = append(result.TypeNames, strings.ToLower(columnType.DatabaseTypeName()))
+	}
+	for rows.Next() {
+		if len(result.Rows) >= rowLimit {
+			result.Truncated = true
+			break
+		}
+		row := make([]interface{}, len(result.Columns))
+		scanTargets := make([]interface{}, len(row))
+		for ix := range row {
+			scanTargets[ix] = &row[ix]
+		}
+		err = rows.Scan(scanTargets...)
+		if err != nil {
+			return
+		}
+		result.Rows = append(result.Rows, row)
+	}
+	if err == nil {
+		err = rows.Err()
+	}
+	return
+}
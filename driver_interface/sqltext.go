@@ -0,0 +1,121 @@
+package driver_interface
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Puts the values of a parameterised statement in place of its placeholders, for showing the statement to users
+// so they can copy it into their own sql tools. It's never run like this, the values are always sent separately.
+// Placeholders are ? or $1, $2 etc, anything that looks like one inside quotes or brackets is left alone.
+// Strings are quoted with any quotes in them doubled, and otherwise written the way the dialect's strings are.
+func InlineValues(sql string, values []interface{}, literals StringLiterals) string {
+	var inlined strings.Builder
+	nextValue := 0
+	var closingQuote byte // set while inside a quoted string or identifier
+	for i := 0; i < len(sql); i++ {
+		c := sql[i]
+		switch {
+		case closingQuote != 0:
+			if c == closingQuote {
+				closingQuote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			closingQuote = c
+		case c == '[':
+			closingQuote = ']'
+		case c == '?' && nextValue < len(values):
+			inlined.WriteString(sqlLiteral(values[nextValue], literals))
+			nextValue++
+			continue
+		case c == '$':
+			end := i + 1
+			for end < len(sql) && sql[end] >= '0' && sql[end] <= '9' {
+				end++
+			}
+			if number, err := strconv.Atoi(sql[i+1 : end]); err == nil && number >= 1 && number <= len(values) {
+				inlined.WriteString(sqlLiteral(values[number-1], literals))
+				i = end - 1
+				continue
+			}
+		}
+		inlined.WriteByte(c)
+	}
+	return inlined.String()
+}
+
+// How a database's string literals are written
+type StringLiterals int
+
+const (
+	StandardStrings         StringLiterals = iota
+	BackslashEscapedStrings                // mysql, where backslashes escape unless NO_BACKSLASH_ESCAPES is set
+	NationalStrings                        // sql server, N'...' so they're nvarchar like the parameters the driver sends
+)
+
+// The statement with quoted strings, quoted identifiers and comments blanked out,
+// for looking for semicolons and keywords without being fooled by values like 'a;b'
+func WithoutQuotedText(sql string) string {
+	var code strings.Builder
+	closing := "" // set while inside quotes or a comment
+	for i := 0; i < len(sql); i++ {
+		if closing != "" {
+			if strings.HasPrefix(sql[i:], closing) {
+				i += len(closing) - 1
+				closing = ""
+				code.WriteByte(' ')
+			}
+			continue
+		}
+		switch {
+		case sql[i] == '\'' || sql[i] == '"' || sql[i] == '`':
+			closing = string(sql[i])
+		case sql[i] == '[':
+			closing = "]"
+		case strings.HasPrefix(sql[i:], "--"):
+			closing = "\n"
+		case strings.HasPrefix(sql[i:], "/*"):
+			closing = "*/"
+			i++
+		default:
+			code.WriteByte(sql[i])
+		}
+	}
+	return code.String()
+}
+
+func sqlLiteral(value interface{}, literals StringLiterals) string {
+	if valuer, ok := value.(driver.Valuer); ok {
+		driverValue, err := valuer.Value()
+		if err != nil {
+			return fmt.Sprintf("/* %s */", err)
+		}
+		value = driverValue
+	}
+	switch typedValue := value.(type) {
+	case nil:
+		return "null"
+	case int, int32, int64, float32, float64:
+		return fmt.Sprint(typedValue)
+	case time.Time:
+		return quoteSqlString(typedValue.Format("2006-01-02 15:04:05.999999999"), literals)
+	case []byte:
+		return quoteSqlString(string(typedValue), literals)
+	default:
+		return quoteSqlString(fmt.Sprint(typedValue), literals)
+	}
+}
+
+func quoteSqlString(value string, literals StringLiterals) string {
+	if literals == BackslashEscapedStrings {
+		value = strings.Replace(value, "\\", "\\\\", -1)
+	}
+	quoted := "'" + strings.Replace(value, "'", "''", -1) + "'"
+	if literals == NationalStrings {
+		return "N" + quoted
+	}
+	return quoted
+}
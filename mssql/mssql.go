@@ -9,13 +9,17 @@ import (
 	"github.com/timabell/schema-explorer/params"
 	"github.com/timabell/schema-explorer/reader"
 	"github.com/timabell/schema-explorer/schema"
+	"context"
 	"database/sql"
+	"encoding/xml"
 	"errors"
 	"fmt"
 	_ "github.com/denisenkom/go-mssqldb"
 	"log"
+	"regexp"
 	"strconv"
 	"strings"
+	"time"
 )
 
 var driverOpts = drivers.DriverOpts{
@@ -127,6 +131,8 @@ func (model mssqlModel) ReadSchema(databaseName string) (database *schema.Databa
 			Descriptions:         true,
 			FkNames:              true,
 			PagingWithoutSorting: false,
+			JsonFilter:           true,
+			TableSample:          true,
 		},
 		DefaultSchemaName: "dbo",
 		Name:              databaseName,
@@ -161,6 +167,18 @@ func (model mssqlModel) ReadSchema(databaseName string) (database *schema.Databa
 
 	getIndexes(dbc, database)
 
+	err = getCheckConstraints(dbc, database)
+	if err != nil {
+		return
+	}
+
+	err = getUniqueConstraints(dbc, database)
+	if err != nil {
+		return
+	}
+
+	flagJsonColumns(database)
+
 	addDescriptions(dbc, database)
 
 	//log.Print(database.DebugString())
@@ -340,7 +358,8 @@ func allFks(dbc *sql.DB, database *schema.Database) (allFks []*schema.Fk, err er
 			parent_col.name parent_col_name,
 			child_sch.name child_sch_name,
 			child_tbl.name child_tbl_name,
-			child_col.name child_col_name
+			child_col.name child_col_name,
+			fk.is_not_trusted
 		from sys.foreign_keys fk
 			inner join sys.foreign_key_columns fkcol on fkcol.constraint_object_id = fk.object_id
 			inner join sys.tables parent_tbl on parent_tbl.object_id = fk.parent_object_id
@@ -368,7 +387,8 @@ func allFks(dbc *sql.DB, database *schema.Database) (allFks []*schema.Fk, err er
 	allFks = []*schema.Fk{}
 	for rows.Next() {
 		var name, sourceSchema, sourceTableName, sourceColumnName, destinationSchema, destinationTableName, destinationColumnName string
-		rows.Scan(&name, &sourceSchema, &sourceTableName, &sourceColumnName, &destinationSchema, &destinationTableName, &destinationColumnName)
+		var notTrusted bool
+		rows.Scan(&name, &sourceSchema, &sourceTableName, &sourceColumnName, &destinationSchema, &destinationTableName, &destinationColumnName, &notTrusted)
 		sourceTable := database.FindTable(&schema.Table{Schema: sourceSchema, Name: sourceTableName})
 		_, sourceColumn := sourceTable.FindColumn(sourceColumnName)
 		destinationTable := database.FindTable(&schema.Table{Schema: destinationSchema, Name: destinationTableName})
@@ -385,6 +405,7 @@ func allFks(dbc *sql.DB, database *schema.Database) (allFks []*schema.Fk, err er
 		}
 		if fk == nil {
 			fk = schema.NewFk(name, sourceTable, sourceColumn, destinationTable, destinationColumn)
+			fk.NotTrusted = notTrusted // is_disabled implies is_not_trusted
 			allFks = append(allFks, fk)
 			sourceTable.Fks = append(sourceTable.Fks, fk)
 			destinationTable.InboundFks = append(destinationTable.InboundFks, fk)
@@ -405,7 +426,7 @@ func (model mssqlModel) GetSqlRows(databaseName string, table *schema.Table, par
 
 	sql, values := buildQuery(table, params, peekFinder)
 	rows, err = dbc.Query(sql, values...)
-	if params.SkipRows > 0 && len(params.Sort) == 0 {
+	if params.SkipRows > 0 && len(params.Sort) == 0 && !params.UsesCursor(table) {
 		// Can't use offset or row_number without a sort order so use a hack.
 		// buildQuery has given us rowlimit+skip rows so now we just need to discard the unwanted leading rows
 		for i := 0; i < params.SkipRows; i++ {
@@ -422,7 +443,142 @@ func (model mssqlModel) GetSqlRows(databaseName string, table *schema.Table, par
 	return
 }
 
+func (model mssqlModel) GetSqlText(databaseName string, table *schema.Table, params *params.TableParams, peekFinder *driver_interface.PeekLookup) string {
+	sql, values := buildQuery(table, params, peekFinder)
+	sql = driver_interface.InlineValues(sql, values, driver_interface.NationalStrings)
+	if params.SkipRows > 0 && len(params.Sort) == 0 && !params.UsesCursor(table) {
+		sql = sql + fmt.Sprintf("\n-- without a sort order to offset by, the first %d rows are read and discarded", params.SkipRows)
+	}
+	return sql
+}
+
+func (model mssqlModel) GetQueryPlan(databaseName string, table *schema.Table, params *params.TableParams, peekFinder *driver_interface.PeekLookup) (plan *driver_interface.PlanNode, err error) {
+	dbc, err := getConnection(buildConnectionString(databaseName))
+	if err != nil {
+		log.Print("GetQueryPlan failed to get connection")
+		return
+	}
+	defer dbc.Close()
+
+	// showplan is set for the connection and has to be in a batch of its own,
+	// while it's on queries return their plan instead of being run
+	ctx := context.Background()
+	conn, err := dbc.Conn(ctx)
+	if err != nil {
+		log.Print("GetQueryPlan failed to get connection")
+		return
+	}
+	defer conn.Close()
+	_, err = conn.ExecContext(ctx, "set showplan_xml on")
+	if err != nil {
+		log.Print("GetQueryPlan failed to turn on showplan")
+		log.Println(err)
+		return
+	}
+	defer conn.ExecContext(ctx, "set showplan_xml off")
+
+	// explained with the values as parameters like when the rows are read, so the plan is the one they get
+	sql, values := buildQuery(table, params, peekFinder)
+	var planXml string
+	err = conn.QueryRowContext(ctx, sql, values...).Scan(&planXml)
+	if err != nil {
+		log.Print("GetQueryPlan failed to get query")
+		log.Println(sql)
+		log.Println(err)
+		return
+	}
+	return parseShowPlan(planXml)
+}
+
+// Any element of the showplan xml, which is too large a schema to map out
+type showPlanElement struct {
+	XMLName  xml.Name
+	Attrs    []xml.Attr        `xml:",any,attr"`
+	Children []showPlanElement `xml:",any"`
+}
+
+func (element showPlanElement) attr(name string) string {
+	for _, attr := range element.Attrs {
+		if attr.Name.Local == name {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// Each operator is a RelOp element, with the operators it reads from nested in its child elements
+func parseShowPlan(planXml string) (plan *driver_interface.PlanNode, err error) {
+	var root showPlanElement
+	err = xml.Unmarshal([]byte(planXml), &root)
+	if err != nil {
+		return
+	}
+	plan = &driver_interface.PlanNode{Label: "Query Plan"}
+	addShowPlanOperators(plan, root)
+	if len(plan.Children) == 1 {
+		plan = plan.Children[0]
+	}
+	return
+}
+
+func addShowPlanOperators(parent *driver_interface.PlanNode, element showPlanElement) {
+	for _, child := range element.Children {
+		if child.XMLName.Local != "RelOp" {
+			addShowPlanOperators(parent, child)
+			continue
+		}
+		// e.g. "Clustered Index Seek on [dbo].[poke] [fk0] using [PK_poke]"
+		node := &driver_interface.PlanNode{Label: child.attr("PhysicalOp")}
+		if object := findShowPlanElement(child, "Object"); object != nil {
+			node.Label = node.Label + " on " + object.attr("Schema") + "." + object.attr("Table")
+			if alias := object.attr("Alias"); alias != "" {
+				node.Label = node.Label + " " + alias
+			}
+			if index := object.attr("Index"); index != "" {
+				node.Label = node.Label + " using " + index
+			}
+		}
+		for _, name := range []string{"LogicalOp", "EstimateRows", "EstimatedTotalSubtreeCost"} {
+			if value := child.attr(name); value != "" {
+				node.Details = append(node.Details, fmt.Sprintf("%s: %s", name, value))
+			}
+		}
+		if predicate := findShowPlanElement(child, "Predicate"); predicate != nil {
+			if scalar := findShowPlanElement(*predicate, "ScalarOperator"); scalar != nil {
+				node.Details = append(node.Details, "Predicate: "+scalar.attr("ScalarString"))
+			}
+		}
+		parent.Children = append(parent.Children, node)
+		addShowPlanOperators(node, child)
+	}
+}
+
+// The first element with the name within the operator, not looking into the operators it reads from
+func findShowPlanElement(operator showPlanElement, name string) *showPlanElement {
+	for ix, child := range operator.Children {
+		if child.XMLName.Local == "RelOp" {
+			continue
+		}
+		if child.XMLName.Local == name {
+			return &operator.Children[ix]
+		}
+		if found := findShowPlanElement(child, name); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func (model mssqlModel) GetJoinSql(databaseName string, join driver_interface.JoinQuery) string {
+	sql, values := buildJoinQuery(join)
+	return driver_interface.InlineValues(sql, values, driver_interface.NationalStrings)
+}
+
 func (model mssqlModel) GetRowCount(databaseName string, table *schema.Table, params *params.TableParams) (rowCount int, err error) {
+	return model.GetRowCountContext(context.Background(), databaseName, table, params)
+}
+
+func (model mssqlModel) GetRowCountContext(ctx context.Context, databaseName string, table *schema.Table, params *params.TableParams) (rowCount int, err error) {
 	dbc, err := getConnection(buildConnectionString(databaseName))
 	if err != nil {
 		log.Print("GetRows failed to get connection")
@@ -432,13 +588,14 @@ func (model mssqlModel) GetRowCount(databaseName string, table *schema.Table, pa
 
 	sql, values := buildQuery(table, params, &driver_interface.PeekLookup{})
 	sql = "select count(*) from (" + sql + ") as x"
-	rows, err := dbc.Query(sql, values...)
+	rows, err := dbc.QueryContext(ctx, sql, values...)
 	if err != nil {
 		log.Print("GetRowCount failed to get query")
 		log.Println(sql)
 		log.Println(err)
 		return
 	}
+	defer rows.Close()
 	if !rows.Next() {
 		err = errors.New("GetRowCount query returned no rows")
 		return
@@ -447,37 +604,266 @@ func (model mssqlModel) GetRowCount(databaseName string, table *schema.Table, pa
 	return
 }
 
-func (model mssqlModel) GetAnalysis(databaseName string, table *schema.Table) (analysis []schema.ColumnAnalysis, err error) {
+func (model mssqlModel) GetColumnAnalysis(databaseName string, table *schema.Table, col *schema.Column, sample schema.AnalysisSample) (columnAnalysis schema.ColumnAnalysis, err error) {
 	dbc, err := getConnection(buildConnectionString(databaseName))
 	if err != nil {
-		log.Print("GetAnalysis failed to get connection")
+		log.Print("GetColumnAnalysis failed to get connection")
 		return
 	}
 	defer dbc.Close()
 
-	analysis = []schema.ColumnAnalysis{}
-	for _, col := range table.Columns {
-		sql := "select top 100 [" + col.Name + "], count(*) qty from [" + table.Schema + "].[" + table.Name + "] group by [" + col.Name + "] order by count(*) desc, [" + col.Name + "];"
-		rows, err := dbc.Query(sql)
-		if err != nil {
-			log.Print("GetAnalysis failed to get query")
-			log.Println(sql)
-			log.Println(err)
-			return nil, err
-		}
-		var valueInfos []schema.ValueInfo
-		for rows.Next() {
-			var value interface{}
-			var quantity int
-			rows.Scan(&value, &quantity)
-			valueInfos = append(valueInfos, schema.ValueInfo{
-				Value:    value,
-				Quantity: quantity,
-			})
-		}
-		analysis = append(analysis, schema.ColumnAnalysis{
-			Column:      col,
-			ValueCounts: valueInfos,
+	fromSql := " from [" + table.Schema + "].[" + table.Name + "]"
+	switch {
+	case sample.Percent > 0:
+		fromSql = fmt.Sprintf("%s tablesample (%d percent) repeatable (%d)", fromSql, sample.Percent, schema.AnalysisSampleSeed)
+	case sample.FirstRows > 0:
+		fromSql = fmt.Sprintf(" from (select top %d * from [%s].[%s]) s", sample.FirstRows, table.Schema, table.Name)
+	}
+	colSql := "[" + col.Name + "]"
+	sql := "select top 100 " + colSql + ", count(*) qty" + fromSql + " group by " + colSql + " order by count(*) desc, " + colSql + ";"
+	rows, err := dbc.Query(sql)
+	if err != nil {
+		log.Print("GetColumnAnalysis failed to get query")
+		log.Println(sql)
+		log.Println(err)
+		return
+	}
+	var valueInfos []schema.ValueInfo
+	for rows.Next() {
+		var value interface{}
+		var quantity int
+		rows.Scan(&value, &quantity)
+		valueInfos = append(valueInfos, schema.ValueInfo{
+			Value:    value,
+			Quantity: quantity,
+		})
+	}
+	rows.Close()
+	columnAnalysis = schema.ColumnAnalysis{
+		Column:      col,
+		ValueCounts: valueInfos,
+		Sample:      sample,
+	}
+	err = addColumnStats(dbc, col, fromSql, &columnAnalysis)
+	return
+}
+
+// Adds summary statistics for the column, plus a length or month histogram for text and temporal columns
+func addColumnStats(dbc *sql.DB, col *schema.Column, fromSql string, columnAnalysis *schema.ColumnAnalysis) (err error) {
+	var nonNullCount int
+	var average, stdDev sql.NullFloat64
+	var minLength, maxLength sql.NullInt64
+	colSql := "[" + col.Name + "]"
+	statsSql := "select count(*), count(" + colSql + "), count(distinct " + colSql + ")"
+	scanTargets := []interface{}{&columnAnalysis.RowCount, &nonNullCount, &columnAnalysis.DistinctCount}
+	switch {
+	case col.Type.IsNumeric():
+		statsSql = statsSql + ", min(" + colSql + "), max(" + colSql + "), avg(cast(" + colSql + " as float)), stdevp(cast(" + colSql + " as float))"
+		scanTargets = append(scanTargets, &columnAnalysis.Min, &columnAnalysis.Max, &average, &stdDev)
+	case col.Type.IsText():
+		statsSql = statsSql + ", min(" + colSql + "), max(" + colSql + "), min(len(" + colSql + ")), max(len(" + colSql + "))"
+		scanTargets = append(scanTargets, &columnAnalysis.Min, &columnAnalysis.Max, &minLength, &maxLength)
+	case col.Type.IsTemporal():
+		statsSql = statsSql + ", min(" + colSql + "), max(" + colSql + ")"
+		scanTargets = append(scanTargets, &columnAnalysis.Min, &columnAnalysis.Max)
+	}
+	statsSql = statsSql + fromSql
+	rows, err := dbc.Query(statsSql)
+	if err != nil {
+		log.Print("GetColumnAnalysis failed to get column stats")
+		log.Println(statsSql)
+		log.Println(err)
+		return
+	}
+	if rows.Next() {
+		rows.Scan(scanTargets...)
+	}
+	rows.Close()
+	columnAnalysis.NullCount = columnAnalysis.RowCount - nonNullCount
+	if average.Valid {
+		columnAnalysis.Average = &average.Float64
+		if stdDev.Valid {
+			columnAnalysis.StdDev = &stdDev.Float64
+		}
+	}
+	if minLength.Valid && maxLength.Valid {
+		minLengthInt, maxLengthInt := int(minLength.Int64), int(maxLength.Int64)
+		columnAnalysis.MinLength = &minLengthInt
+		columnAnalysis.MaxLength = &maxLengthInt
+	}
+
+	var bucketSql string
+	switch {
+	case col.Type.IsText():
+		lengthSql := "len(" + colSql + ")"
+		bucketSql = "select top 100 " + lengthSql + ", count(*)" + fromSql + " where " + colSql + " is not null group by " + lengthSql + " order by count(*) desc, " + lengthSql
+	case col.Type.IsTemporal():
+		monthSql := "convert(char(7), " + colSql + ", 126)"
+		bucketSql = "select " + monthSql + ", count(*)" + fromSql + " where " + monthSql + " is not null group by " + monthSql + " order by " + monthSql
+	default:
+		return
+	}
+	rows, err = dbc.Query(bucketSql)
+	if err != nil {
+		log.Print("GetColumnAnalysis failed to get column histogram")
+		log.Println(bucketSql)
+		log.Println(err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var bucket string
+		var quantity int
+		rows.Scan(&bucket, &quantity)
+		valueInfo := schema.ValueInfo{Value: bucket, Quantity: quantity}
+		if col.Type.IsText() {
+			length, _ := strconv.Atoi(bucket)
+			valueInfo.Value = length
+			columnAnalysis.LengthCounts = append(columnAnalysis.LengthCounts, valueInfo)
+		} else {
+			columnAnalysis.DateCounts = append(columnAnalysis.DateCounts, valueInfo)
+		}
+	}
+	return
+}
+
+func (model mssqlModel) GetGroupCounts(databaseName string, table *schema.Table, groupBy []params.GroupByCol, tableParams *params.TableParams) (groups []schema.GroupCount, err error) {
+	dbc, err := getConnection(buildConnectionString(databaseName))
+	if err != nil {
+		log.Print("GetGroupCounts failed to get connection")
+		return
+	}
+	defer dbc.Close()
+
+	// only the filters apply, paging and sorting are meaningless for a count
+	innerSql, values := buildQuery(table, &params.TableParams{Filter: tableParams.Filter}, &driver_interface.PeekLookup{})
+	var groupCols []string
+	joinSql := ""
+	for ix, groupCol := range groupBy {
+		groupCols = append(groupCols, fmt.Sprintf("t.[%s]", groupCol.Column.Name))
+		if groupCol.PeekFk != nil {
+			groupCols = append(groupCols, fmt.Sprintf("g%d.[%s]", ix, groupCol.PeekCol.Name))
+			joinSql = joinSql + fmt.Sprintf(" left outer join %s g%d on g%d.[%s] = t.[%s]", "["+groupCol.PeekFk.DestinationTable.Schema+"].["+groupCol.PeekFk.DestinationTable.Name+"]", ix, ix, groupCol.PeekFk.DestinationColumns[0].Name, groupCol.Column.Name)
+		}
+	}
+	groupBySql := strings.Join(groupCols, ", ")
+	sql := "select top 1000 " + groupBySql + ", count(*) qty from (" + innerSql + ") as t" + joinSql + " group by " + groupBySql + " order by count(*) desc"
+	rows, err := dbc.Query(sql, values...)
+	if err != nil {
+		log.Print("GetGroupCounts failed to get query")
+		log.Println(sql)
+		log.Println(err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		scanned := make([]interface{}, len(groupCols))
+		scanTargets := make([]interface{}, len(scanned)+1)
+		for ix := range scanned {
+			scanTargets[ix] = &scanned[ix]
+		}
+		group := schema.GroupCount{}
+		scanTargets[len(scanned)] = &group.Quantity
+		rows.Scan(scanTargets...)
+		scanIndex := 0
+		for _, groupCol := range groupBy {
+			group.Values = append(group.Values, scanned[scanIndex])
+			scanIndex++
+			var peekValue interface{}
+			if groupCol.PeekFk != nil {
+				peekValue = scanned[scanIndex]
+				scanIndex++
+			}
+			group.PeekValues = append(group.PeekValues, peekValue)
+		}
+		groups = append(groups, group)
+	}
+	return
+}
+
+func (model mssqlModel) RunQuery(databaseName string, query string, rowLimit int, timeout time.Duration) (result driver_interface.QueryResult, err error) {
+	dbc, err := getConnection(buildConnectionString(databaseName))
+	if err != nil {
+		log.Print("RunQuery failed to get connection")
+		return
+	}
+	defer dbc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	// sql server doesn't have read-only transactions, rolling back undoes anything the query changed,
+	// as long as nothing in it ends the transaction first, which the keyword check above is for
+	tx, err := dbc.BeginTx(ctx, nil)
+	if err != nil {
+		log.Print("RunQuery failed to begin transaction")
+		return
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		log.Print("RunQuery failed to get query")
+		log.Println(query)
+		log.Println(err)
+		return
+	}
+	defer rows.Close()
+	return driver_interface.ReadQueryResult(rows, rowLimit)
+}
+
+func (model mssqlModel) GetOrphans(databaseName string, fk *schema.Fk) (orphans schema.FkOrphans, err error) {
+	dbc, err := getConnection(buildConnectionString(databaseName))
+	if err != nil {
+		log.Print("GetOrphans failed to get connection")
+		return
+	}
+	defer dbc.Close()
+
+	orphans = schema.FkOrphans{Fk: fk}
+	var sourceCols, notNull, joinPredicates []string
+	for ix, sourceCol := range fk.SourceColumns {
+		sourceCols = append(sourceCols, "s.["+sourceCol.Name+"]")
+		notNull = append(notNull, "s.["+sourceCol.Name+"] is not null")
+		joinPredicates = append(joinPredicates, "d.["+fk.DestinationColumns[ix].Name+"] = s.["+sourceCol.Name+"]")
+	}
+	from := " from [" + fk.SourceTable.Schema + "].[" + fk.SourceTable.Name + "] s where " + strings.Join(notNull, " and ") +
+		" and not exists (select 1 from [" + fk.DestinationTable.Schema + "].[" + fk.DestinationTable.Name + "] d where " + strings.Join(joinPredicates, " and ") + ")"
+	groupBy := strings.Join(sourceCols, ", ")
+
+	sql := "select count(*)" + from
+	rows, err := dbc.Query(sql)
+	if err != nil {
+		log.Print("GetOrphans failed to count orphans")
+		log.Println(sql)
+		log.Println(err)
+		return
+	}
+	if rows.Next() {
+		rows.Scan(&orphans.RowCount)
+	}
+	rows.Close()
+
+	sql = "select top 100 " + groupBy + ", count(*) qty" + from + " group by " + groupBy + " order by count(*) desc"
+	rows, err = dbc.Query(sql)
+	if err != nil {
+		log.Print("GetOrphans failed to get query")
+		log.Println(sql)
+		log.Println(err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		values := make([]interface{}, len(fk.SourceColumns))
+		scanTargets := make([]interface{}, len(values)+1)
+		for ix := range values {
+			scanTargets[ix] = &values[ix]
+		}
+		var quantity int
+		scanTargets[len(values)] = &quantity
+		rows.Scan(scanTargets...)
+		orphans.ValueCounts = append(orphans.ValueCounts, schema.OrphanValue{
+			Values:   values,
+			Quantity: quantity,
 		})
 	}
 	return
@@ -490,12 +876,27 @@ func buildQuery(table *schema.Table, params *params.TableParams, peekFinder *dri
 
 	sql = "select"
 
+	switch {
+	case params.UsesCursor(table):
+		sql = sql + " top " + strconv.Itoa(params.RowLimit)
 	// use top when we have a row limit but now sorting (or can't use offset because there's no sort)
-	if params.RowLimit > 0 && len(params.Sort) == 0 {
+	case params.RowLimit > 0 && len(params.Sort) == 0:
 		sql = sql + " top " + strconv.Itoa(params.RowLimit+params.SkipRows)
+	// sorted first page, offset is only needed when skipping
+	case params.RowLimit > 0 && params.SkipRows == 0:
+		sql = sql + " top " + strconv.Itoa(params.RowLimit)
 	}
 
-	sql = sql + " t.*"
+	if len(peekFinder.Columns) > 0 {
+		// only the chosen columns, plus the ones needed for links
+		var selectCols []string
+		for _, col := range peekFinder.Columns {
+			selectCols = append(selectCols, "t.["+col.Name+"]")
+		}
+		sql = sql + " " + strings.Join(selectCols, ", ")
+	} else {
+		sql = sql + " t.*"
+	}
 
 	// peek cols
 	for fkIndex, fk := range peekFinder.Fks {
@@ -506,17 +907,13 @@ func buildQuery(table *schema.Table, params *params.TableParams, peekFinder *dri
 
 	// inbound fk counts
 	for inboundFkIndex, inboundFk := range table.InboundFks {
-		onPredicates := []string{}
-		for ix, sourceCol := range inboundFk.SourceColumns {
-			onPredicates = append(onPredicates, fmt.Sprintf("ifk%d.[%s] = t.[%s]", inboundFkIndex, sourceCol.Name, inboundFk.DestinationColumns[ix].Name))
-		}
-		onString := strings.Join(onPredicates, " and ")
-		sql = sql + fmt.Sprintf(", (select count(*) from [%s].[%s] ifk%d where %s) ifk%d_count", inboundFk.SourceTable.Schema, inboundFk.SourceTable.Name, inboundFkIndex, onString, inboundFkIndex)
+		sql = sql + fmt.Sprintf(", %s ifk%d_count", inboundCountSql(inboundFkIndex, inboundFk), inboundFkIndex)
 	}
 	sql = sql + " from [" + table.Schema + "].[" + table.Name + "] t"
 
 	// peek tables
-	for fkIndex, fk := range peekFinder.Fks {
+	joinFks := peekFinder.JoinFks(params)
+	for fkIndex, fk := range joinFks {
 		sql = sql + fmt.Sprintf(" left outer join [%s].[%s] fk%d on ", fk.DestinationTable.Schema, fk.DestinationTable.Name, fkIndex)
 		onPredicates := []string{}
 		for ix, sourceCol := range fk.SourceColumns {
@@ -533,24 +930,54 @@ func buildQuery(table *schema.Table, params *params.TableParams, peekFinder *dri
 		values = make([]interface{}, 0, len(query))
 		for _, v := range query {
 			col := v.Field
-			clauses = append(clauses, "t.["+col.Name+"] = ?")
+			if v.Related != nil {
+				clauses = append(clauses, relatedValueSql(table, v.Related, joinFks)+" = ?")
+			} else if len(v.JsonPath) > 0 {
+				clauses = append(clauses, "json_value(t.["+col.Name+"], ?) = ?")
+				values = append(values, v.JsonPathExpression())
+			} else {
+				clauses = append(clauses, "t.["+col.Name+"] = ?")
+			}
 			values = append(values, v.Values[0]) // todo: maybe support multiple values
 		}
 		sql = sql + strings.Join(clauses, " and ")
 	}
 
-	if len(params.Sort) > 0 {
+	if params.UsesCursor(table) {
+		if len(query) > 0 {
+			sql = sql + " and "
+		} else {
+			sql = sql + " where "
+		}
+		cursorSql, cursorValues := keysetClause(params.KeysetColumns(table), params.Cursor)
+		sql = sql + cursorSql
+		values = append(values, cursorValues...)
+	}
+
+	// paging from a cursor needs a unique order, and reads previous pages backwards.
+	// without one the order is left as it was asked for so as not to make the database sort every limited read.
+	orderBy := params.Sort
+	if params.UsesCursor(table) {
+		orderBy = params.KeysetColumns(table)
+	}
+	backwards := params.UsesCursor(table) && params.Cursor.Backwards
+	if len(orderBy) > 0 {
 		var sortParts []string
-		for _, sortCol := range params.Sort {
-			sortString := "t.[" + sortCol.Column.Name + "]"
-			if sortCol.Descending {
+		for _, sortCol := range orderBy {
+			var sortString string
+			if sortCol.Related != nil {
+				sortString = relatedValueSql(table, sortCol.Related, joinFks)
+			} else {
+				sortString = "t.[" + sortCol.Column.Name + "]"
+			}
+			if sortCol.Descending != backwards {
 				sortString = sortString + " desc"
 			}
 			sortParts = append(sortParts, sortString)
 		}
 		sql = sql + " order by " + strings.Join(sortParts, ", ")
 
-		if params.SkipRows > 0 {
+		if params.SkipRows > 0 && !params.UsesCursor(table) {
 			sql = sql + fmt.Sprintf(" offset %d rows", params.SkipRows)
 			if params.RowLimit > 0 {
 				sql = sql + fmt.Sprintf(" fetch next %d rows only", params.RowLimit)
@@ -560,11 +987,92 @@ func buildQuery(table *schema.Table, params *params.TableParams, peekFinder *dri
 	return
 }
 
+// Joins the tables along their fks, each table is aliased by its position in the list
+func buildJoinQuery(join driver_interface.JoinQuery) (sql string, values []interface{}) {
+	var selectTables []string
+	for ix := range join.Tables {
+		selectTables = append(selectTables, fmt.Sprintf("t%d.*", ix))
+	}
+	sql = "select " + strings.Join(selectTables, ", ")
+	for ix, joined := range join.Tables {
+		if joined.Step == nil {
+			sql = sql + fmt.Sprintf("\nfrom [%s].[%s] t%d", joined.Table.Schema, joined.Table.Name, ix)
+			continue
+		}
+		var onPredicates []string
+		toColumns := joined.Step.ToColumns()
+		for colIx, fromCol := range joined.Step.FromColumns() {
+			onPredicates = append(onPredicates, fmt.Sprintf("t%d.[%s] = t%d.[%s]", joined.JoinedTo, fromCol.Name, ix, toColumns[colIx].Name))
+		}
+		sql = sql + fmt.Sprintf("\njoin [%s].[%s] t%d on %s", joined.Table.Schema, joined.Table.Name, ix, strings.Join(onPredicates, " and "))
+	}
+
+	if len(join.Filters) > 0 {
+		var clauses []string
+		for _, filter := range join.Filters {
+			clauses = append(clauses, fmt.Sprintf("t%d.[%s] = ?", filter.TableIndex, filter.Column.Name))
+			values = append(values, filter.Value)
+		}
+		sql = sql + "\nwhere " + strings.Join(clauses, "\nand ")
+	}
+	return
+}
+
+// Number of rows referencing the row through the inbound fk, as a subquery
+func inboundCountSql(inboundFkIndex int, inboundFk *schema.Fk) string {
+	onPredicates := []string{}
+	for ix, sourceCol := range inboundFk.SourceColumns {
+		onPredicates = append(onPredicates, fmt.Sprintf("ifk%d.[%s] = t.[%s]", inboundFkIndex, sourceCol.Name, inboundFk.DestinationColumns[ix].Name))
+	}
+	onString := strings.Join(onPredicates, " and ")
+	return fmt.Sprintf("(select count(*) from [%s].[%s] ifk%d where %s)", inboundFk.SourceTable.Schema, inboundFk.SourceTable.Name, inboundFkIndex, onString)
+}
+
+// Expression for a peeked value (from the peek joins) or an inbound count, for sorting and filtering on
+func relatedValueSql(table *schema.Table, related *params.RelatedValue, joinFks []*schema.Fk) string {
+	if related.InboundFk != nil {
+		for inboundFkIndex, inboundFk := range table.InboundFks {
+			if inboundFk == related.InboundFk {
+				return inboundCountSql(inboundFkIndex, inboundFk)
+			}
+		}
+	}
+	return fmt.Sprintf("fk%d.[%s]", driver_interface.JoinIndex(joinFks, related.PeekFk), related.PeekCol)
+}
+
+// Rows after (or before) the cursor in the keyset order, e.g. for keyset (a, b) after (1, 2):
+// ((t.[a] > ?) or (t.[a] = ? and t.[b] > ?)) with values 1, 1, 2
+func keysetClause(keyset []params.SortCol, cursor *params.KeysetCursor) (sql string, values []interface{}) {
+	var alternatives []string
+	for ix, sortCol := range keyset {
+		var parts []string
+		for _, equalCol := range keyset[:ix] {
+			parts = append(parts, "t.["+equalCol.Column.Name+"] = ?")
+		}
+		operator := ">"
+		if sortCol.Descending != cursor.Backwards {
+			operator = "<"
+		}
+		parts = append(parts, "t.["+sortCol.Column.Name+"] "+operator+" ?")
+		alternatives = append(alternatives, "("+strings.Join(parts, " and ")+")")
+		for _, value := range cursor.Values[:ix+1] {
+			values = append(values, value)
+		}
+	}
+	sql = "(" + strings.Join(alternatives, " or ") + ")"
+	return
+}
+
 func getColumns(dbc *sql.DB, table *schema.Table) (cols []*schema.Column, err error) {
 	// todo: parameterise
-	sqlText := `select c.name, type_name(c.system_type_id), is_nullable from sys.columns c
+	// clr types such as geometry all have system_type_id 240 which has no name, so fall back to the user type
+	sqlText := `select c.name, coalesce(type_name(c.system_type_id), type_name(c.user_type_id)), c.max_length, c.precision, c.scale, coalesce(c.collation_name, ''),
+		c.is_nullable, c.is_identity, c.is_computed, coalesce(dc.definition, ''), coalesce(cc.definition, '')
+	from sys.columns c
 	inner join sys.tables t on t.object_id = c.object_id
 	inner join sys.schemas s on s.schema_id = t.schema_id
+	left outer join sys.default_constraints dc on dc.object_id = c.default_object_id
+	left outer join sys.computed_columns cc on cc.object_id = c.object_id and cc.column_id = c.column_id
 	where s.name = '` + table.Schema + `' and t.name = '` + table.Name + `'
 order by c.column_id`
 
@@ -573,16 +1081,123 @@ order by c.column_id`
 	cols = []*schema.Column{}
 	colIndex := 0
 	for rows.Next() {
-		var name, typeName string
-		var nullable bool
-		rows.Scan(&name, &typeName, &nullable)
-		thisCol := schema.Column{Position: colIndex, Name: name, Type: typeName, Nullable: nullable}
+		var name, typeName, collation, defaultDefinition, computedDefinition string
+		var maxLength, precision, scale int
+		var nullable, isIdentity, isComputed bool
+		rows.Scan(&name, &typeName, &maxLength, &precision, &scale, &collation, &nullable, &isIdentity, &isComputed, &defaultDefinition, &computedDefinition)
+		dataType := schema.DataType{Name: typeName, Collation: collation}
+		// max_length is in bytes and is -1 for (max) types
+		switch typeName {
+		case "char", "varchar", "binary", "varbinary":
+			dataType.MaxLength = &maxLength
+		case "nchar", "nvarchar":
+			if maxLength > 0 {
+				maxLength = maxLength / 2 // two bytes per character
+			}
+			dataType.MaxLength = &maxLength
+		case "decimal", "numeric":
+			dataType.Precision = &precision
+			dataType.Scale = &scale
+		case "geometry", "geography":
+			dataType.Spatial = schema.MssqlClrGeometry
+		}
+		thisCol := schema.Column{
+			Position:            colIndex,
+			Name:                name,
+			Type:                dataType,
+			Nullable:            nullable,
+			Default:             defaultDefinition,
+			IsIdentity:          isIdentity,
+			IsGenerated:         isComputed,
+			GeneratedExpression: computedDefinition,
+		}
 		cols = append(cols, &thisCol)
 		colIndex++
 	}
 	return
 }
 
+func getCheckConstraints(dbc *sql.DB, database *schema.Database) error {
+	rows, err := dbc.Query(`
+		select s.name schema_name, t.name table_name, ck.name, ck.definition
+		from sys.check_constraints ck
+			inner join sys.tables t on t.object_id = ck.parent_object_id
+			inner join sys.schemas s on s.schema_id = t.schema_id
+		order by s.name, t.name, ck.name`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var schemaName, tableName, name, definition string
+		rows.Scan(&schemaName, &tableName, &name, &definition)
+		table := database.FindTable(&schema.Table{Schema: schemaName, Name: tableName})
+		if table == nil {
+			return fmt.Errorf("failed to find table %s.%s for check constraint %s", schemaName, tableName, name)
+		}
+		table.CheckConstraints = append(table.CheckConstraints, &schema.CheckConstraint{Name: name, Clause: definition, Table: table})
+	}
+	return nil
+}
+
+// sql server has no json type, json is stored in nvarchar columns and validated with a check constraint
+// such as (isjson([payload])=(1)), so use that as the marker for columns to show as json
+var isJsonRegex = regexp.MustCompile(`(?i)isjson\s*\(\s*\[?([^\]\)]+?)\]?\s*\)`)
+
+func flagJsonColumns(database *schema.Database) {
+	for _, table := range database.Tables {
+		for _, check := range table.CheckConstraints {
+			for _, match := range isJsonRegex.FindAllStringSubmatch(check.Clause, -1) {
+				_, col := table.FindColumn(match[1])
+				if col != nil {
+					col.Type.IsJson = true
+				}
+			}
+		}
+	}
+}
+
+func getUniqueConstraints(dbc *sql.DB, database *schema.Database) error {
+	rows, err := dbc.Query(`
+		select s.name schema_name, t.name table_name, kc.name, col.name colname
+		from sys.key_constraints kc
+			inner join sys.tables t on t.object_id = kc.parent_object_id
+			inner join sys.schemas s on s.schema_id = t.schema_id
+			inner join sys.index_columns ic on ic.object_id = kc.parent_object_id and ic.index_id = kc.unique_index_id
+			inner join sys.columns col on col.object_id = ic.object_id and col.column_id = ic.column_id
+		where kc.type = 'UQ'
+		order by s.name, t.name, kc.name, ic.key_ordinal`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var schemaName, tableName, name, columnName string
+		rows.Scan(&schemaName, &tableName, &name, &columnName)
+		table := database.FindTable(&schema.Table{Schema: schemaName, Name: tableName})
+		if table == nil {
+			return fmt.Errorf("failed to find table %s.%s for unique constraint %s", schemaName, tableName, name)
+		}
+		_, col := table.FindColumn(columnName)
+		if col == nil {
+			return fmt.Errorf("failed to find col %s in table %s for unique constraint %s", columnName, table, name)
+		}
+		var uniqueConstraint *schema.UniqueConstraint
+		for _, existingConstraint := range table.UniqueConstraints {
+			if existingConstraint.Name == name {
+				uniqueConstraint = existingConstraint
+				break
+			}
+		}
+		if uniqueConstraint == nil {
+			uniqueConstraint = &schema.UniqueConstraint{Name: name, Table: table}
+			table.UniqueConstraints = append(table.UniqueConstraints, uniqueConstraint)
+		}
+		uniqueConstraint.Columns = append(uniqueConstraint.Columns, col)
+	}
+	return nil
+}
+
 func getIndexes(dbc *sql.DB, database *schema.Database) {
 	rows, err := dbc.Query(`
 		select
@@ -8,12 +8,16 @@ import (
 	"github.com/timabell/schema-explorer/params"
 	"github.com/timabell/schema-explorer/reader"
 	"github.com/timabell/schema-explorer/schema"
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
 	_ "github.com/go-sql-driver/mysql"
 	"log"
+	"strconv"
 	"strings"
+	"time"
+	"unicode/utf8"
 )
 
 var driverOpts = drivers.DriverOpts{
@@ -117,6 +121,8 @@ func (model mysqlModel) ReadSchema(databaseName string) (database *schema.Databa
 			Descriptions:         false,
 			FkNames:              true,
 			PagingWithoutSorting: true,
+			JsonFilter:           true,
+			TableSample:          false,
 		},
 		Name: databaseName,
 	}
@@ -143,6 +149,11 @@ func (model mysqlModel) ReadSchema(databaseName string) (database *schema.Databa
 		return
 	}
 
+	err = readCheckConstraints(dbc, database)
+	if err != nil {
+		return
+	}
+
 	// indexes
 	err = readIndexes(dbc, database)
 	if err != nil {
@@ -275,6 +286,7 @@ func readConstraints(dbc *sql.DB, database *schema.Database) (err error) {
 					and kc.constraint_name = tc.constraint_name
 					and kc.table_name = tc.table_name
 			where tc.constraint_schema=database()
+				and tc.constraint_type in ('PRIMARY KEY', 'FOREIGN KEY', 'UNIQUE')
 			order by tc.constraint_type, tc.constraint_name,
 				kc.ordinal_position,
 				tc.table_name, kc.column_name,
@@ -335,7 +347,19 @@ func readConstraints(dbc *sql.DB, database *schema.Database) (err error) {
 			//log.Printf("pk: %s.%s", sourceTable, sourceColumn)
 			sourceTable.Pk.Columns = append(sourceTable.Pk.Columns, sourceColumn)
 			sourceColumn.IsInPrimaryKey = true
-		case "UNIQUE": // todo
+		case "UNIQUE":
+			var uniqueConstraint *schema.UniqueConstraint
+			for _, existingConstraint := range sourceTable.UniqueConstraints {
+				if existingConstraint.Name == name {
+					uniqueConstraint = existingConstraint
+					break
+				}
+			}
+			if uniqueConstraint == nil {
+				uniqueConstraint = &schema.UniqueConstraint{Name: name, Table: sourceTable}
+				sourceTable.UniqueConstraints = append(sourceTable.UniqueConstraints, uniqueConstraint)
+			}
+			uniqueConstraint.Columns = append(uniqueConstraint.Columns, sourceColumn)
 		default:
 			log.Printf("?? %s", conType)
 		}
@@ -343,6 +367,38 @@ func readConstraints(dbc *sql.DB, database *schema.Database) (err error) {
 	return
 }
 
+func readCheckConstraints(dbc *sql.DB, database *schema.Database) (err error) {
+	sql := `
+		select tc.table_name, cc.constraint_name, cc.check_clause
+		from information_schema.check_constraints cc
+			inner join information_schema.table_constraints tc
+				on tc.constraint_schema = cc.constraint_schema
+					and tc.constraint_name = cc.constraint_name
+		where cc.constraint_schema = database()
+			and tc.constraint_type = 'CHECK'
+		order by tc.table_name, cc.constraint_name;`
+
+	rows, err := dbc.Query(sql)
+	if err != nil {
+		// check constraints are only enforced (and recorded) from mysql 8.0.16 onwards
+		log.Printf("Unable to read check constraints, skipping. %s", err)
+		return nil
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tableName, name, clause string
+		rows.Scan(&tableName, &name, &clause)
+		tableToFind := &schema.Table{Name: tableName}
+		table := database.FindTable(tableToFind)
+		if table == nil {
+			err = errors.New(fmt.Sprintf("Table %s not found, owner of check constraint %s", tableToFind.String(), name))
+			return
+		}
+		table.CheckConstraints = append(table.CheckConstraints, &schema.CheckConstraint{Name: name, Clause: clause, Table: table})
+	}
+	return
+}
+
 func readIndexes(dbc *sql.DB, database *schema.Database) (err error) {
 	sql := `
 		select index_name, table_name, column_name, non_unique
@@ -421,7 +477,84 @@ func (model mysqlModel) GetSqlRows(databaseName string, table *schema.Table, par
 	return
 }
 
+func (model mysqlModel) GetSqlText(databaseName string, table *schema.Table, params *params.TableParams, peekFinder *driver_interface.PeekLookup) string {
+	sql, values := buildQuery(table, params, peekFinder)
+	// backslashes in strings are escapes in mysql unless NO_BACKSLASH_ESCAPES is set
+	return driver_interface.InlineValues(sql, values, driver_interface.BackslashEscapedStrings)
+}
+
+func (model mysqlModel) GetQueryPlan(databaseName string, table *schema.Table, params *params.TableParams, peekFinder *driver_interface.PeekLookup) (plan *driver_interface.PlanNode, err error) {
+	dbc, err := getConnection(buildConnectionString(databaseName))
+	if err != nil {
+		log.Print("GetQueryPlan failed to get connection")
+		return
+	}
+	defer dbc.Close()
+
+	// explain can't be a prepared statement, so the values are inlined as in the sql shown to users
+	_, values := buildQuery(table, params, peekFinder)
+	err = checkInlinable(values)
+	if err != nil {
+		return
+	}
+	sql := "explain format=json " + model.GetSqlText(databaseName, table, params, peekFinder)
+	var planJson []byte
+	err = dbc.QueryRow(sql).Scan(&planJson)
+	if err != nil {
+		log.Print("GetQueryPlan failed to get query")
+		log.Println(sql)
+		log.Println(err)
+		return
+	}
+	return driver_interface.PlanFromJson(planJson, mysqlPlanLabel)
+}
+
+// Backslashes in string literals are read according to NO_BACKSLASH_ESCAPES, and bytes that aren't utf-8 according to
+// the connection's character set, so strings with either might not mean the same once inlined and are refused
+func checkInlinable(values []interface{}) error {
+	for _, value := range values {
+		var text string
+		switch typedValue := value.(type) {
+		case string:
+			text = typedValue
+		case []byte:
+			text = string(typedValue)
+		default:
+			continue
+		}
+		if strings.ContainsAny(text, "\\\x00") || !utf8.ValidString(text) {
+			return errors.New(fmt.Sprintf("the plan can't be shown for the value %q, mysql can't be sent it as a parameter to explain and it can't be quoted reliably", text))
+		}
+	}
+	return nil
+}
+
+// e.g. "table fk0 (eq_ref)", mysql names tables by their alias in the query
+func mysqlPlanLabel(key string, object map[string]interface{}) string {
+	if tableName, ok := object["table_name"].(string); ok {
+		label := key + " " + tableName
+		if accessType, ok := object["access_type"].(string); ok {
+			label = label + " (" + accessType + ")"
+		}
+		return label
+	}
+	if key == "" {
+		return "query"
+	}
+	return key
+}
+
+func (model mysqlModel) GetJoinSql(databaseName string, join driver_interface.JoinQuery) string {
+	sql, values := buildJoinQuery(join)
+	// backslashes in strings are escapes in mysql unless NO_BACKSLASH_ESCAPES is set
+	return driver_interface.InlineValues(sql, values, driver_interface.BackslashEscapedStrings)
+}
+
 func (model mysqlModel) GetRowCount(databaseName string, table *schema.Table, params *params.TableParams) (rowCount int, err error) {
+	return model.GetRowCountContext(context.Background(), databaseName, table, params)
+}
+
+func (model mysqlModel) GetRowCountContext(ctx context.Context, databaseName string, table *schema.Table, params *params.TableParams) (rowCount int, err error) {
 	dbc, err := getConnection(buildConnectionString(databaseName))
 	if err != nil {
 		log.Print("GetRows failed to get connection")
@@ -429,15 +562,21 @@ func (model mysqlModel) GetRowCount(databaseName string, table *schema.Table, pa
 	}
 	defer dbc.Close()
 
+	// the driver only drops the connection when ctx is done, which doesn't stop the server, so it gets the deadline too
+	var hint string
+	if deadline, ok := ctx.Deadline(); ok {
+		hint = fmt.Sprintf("/*+ MAX_EXECUTION_TIME(%d) */ ", time.Until(deadline)/time.Millisecond+1)
+	}
 	sql, values := buildQuery(table, params, &driver_interface.PeekLookup{})
-	sql = "select count(*) from (" + sql + ") as x"
-	rows, err := dbc.Query(sql, values...)
+	sql = "select " + hint + "count(*) from (" + sql + ") as x"
+	rows, err := dbc.QueryContext(ctx, sql, values...)
 	if err != nil {
 		log.Print("GetRowCount failed to get query")
 		log.Println(sql)
 		log.Println(err)
 		return
 	}
+	defer rows.Close()
 	if !rows.Next() {
 		err = errors.New("GetRowCount query returned no rows")
 		return
@@ -446,38 +585,275 @@ func (model mysqlModel) GetRowCount(databaseName string, table *schema.Table, pa
 	return
 }
 
-func (model mysqlModel) GetAnalysis(databaseName string, table *schema.Table) (analysis []schema.ColumnAnalysis, err error) {
-	// todo, might be good to stream this all the way to the http response
+func (model mysqlModel) GetColumnAnalysis(databaseName string, table *schema.Table, col *schema.Column, sample schema.AnalysisSample) (columnAnalysis schema.ColumnAnalysis, err error) {
 	dbc, err := getConnection(buildConnectionString(databaseName))
 	if err != nil {
-		log.Print("GetAnalysis failed to get connection")
+		log.Print("GetColumnAnalysis failed to get connection")
 		return
 	}
 	defer dbc.Close()
 
-	analysis = []schema.ColumnAnalysis{}
-	for _, col := range table.Columns {
-		sql := "select `" + col.Name + "`, count(*) qty from `" + table.Name + "` group by `" + col.Name + "` order by count(*) desc, `" + col.Name + "` limit 100;"
-		rows, err := dbc.Query(sql)
-		if err != nil {
-			log.Print("GetAnalysis failed to get query")
-			log.Println(sql)
-			log.Println(err)
-			return nil, err
-		}
-		var valueInfos []schema.ValueInfo
-		for rows.Next() {
-			var value interface{}
-			var quantity int
-			rows.Scan(&value, &quantity)
-			valueInfos = append(valueInfos, schema.ValueInfo{
-				Value:    value,
-				Quantity: quantity,
-			})
-		}
-		analysis = append(analysis, schema.ColumnAnalysis{
-			Column:      col,
-			ValueCounts: valueInfos,
+	if sample.Percent > 0 {
+		err = errors.New("mysql has no tablesample to analyse a percentage of a table with")
+		return
+	}
+	fromSql := " from `" + table.Name + "`"
+	if sample.FirstRows > 0 {
+		fromSql = fmt.Sprintf(" from (select * from `%s` limit %d) s", table.Name, sample.FirstRows)
+	}
+	colSql := "`" + col.Name + "`"
+	sql := "select " + colSql + ", count(*) qty" + fromSql + " group by " + colSql + " order by count(*) desc, " + colSql + " limit 100;"
+	rows, err := dbc.Query(sql)
+	if err != nil {
+		log.Print("GetColumnAnalysis failed to get query")
+		log.Println(sql)
+		log.Println(err)
+		return
+	}
+	var valueInfos []schema.ValueInfo
+	for rows.Next() {
+		var value interface{}
+		var quantity int
+		rows.Scan(&value, &quantity)
+		valueInfos = append(valueInfos, schema.ValueInfo{
+			Value:    value,
+			Quantity: quantity,
+		})
+	}
+	rows.Close()
+	columnAnalysis = schema.ColumnAnalysis{
+		Column:      col,
+		ValueCounts: valueInfos,
+		Sample:      sample,
+	}
+	err = addColumnStats(dbc, col, fromSql, &columnAnalysis)
+	return
+}
+
+// Adds summary statistics for the column, plus a length or month histogram for text and temporal columns
+func addColumnStats(dbc *sql.DB, col *schema.Column, fromSql string, columnAnalysis *schema.ColumnAnalysis) (err error) {
+	var nonNullCount int
+	var average, stdDev sql.NullFloat64
+	var minLength, maxLength sql.NullInt64
+	colSql := "`" + col.Name + "`"
+	statsSql := "select count(*), count(" + colSql + "), count(distinct " + colSql + ")"
+	scanTargets := []interface{}{&columnAnalysis.RowCount, &nonNullCount, &columnAnalysis.DistinctCount}
+	switch {
+	case col.Type.IsNumeric():
+		statsSql = statsSql + ", min(" + colSql + "), max(" + colSql + "), avg(" + colSql + "), stddev_pop(" + colSql + ")"
+		scanTargets = append(scanTargets, &columnAnalysis.Min, &columnAnalysis.Max, &average, &stdDev)
+	case col.Type.IsText():
+		statsSql = statsSql + ", min(" + colSql + "), max(" + colSql + "), min(char_length(" + colSql + ")), max(char_length(" + colSql + "))"
+		scanTargets = append(scanTargets, &columnAnalysis.Min, &columnAnalysis.Max, &minLength, &maxLength)
+	case col.Type.IsTemporal():
+		statsSql = statsSql + ", min(" + colSql + "), max(" + colSql + ")"
+		scanTargets = append(scanTargets, &columnAnalysis.Min, &columnAnalysis.Max)
+	}
+	statsSql = statsSql + fromSql
+	rows, err := dbc.Query(statsSql)
+	if err != nil {
+		log.Print("GetColumnAnalysis failed to get column stats")
+		log.Println(statsSql)
+		log.Println(err)
+		return
+	}
+	if rows.Next() {
+		rows.Scan(scanTargets...)
+	}
+	rows.Close()
+	columnAnalysis.NullCount = columnAnalysis.RowCount - nonNullCount
+	if average.Valid {
+		columnAnalysis.Average = &average.Float64
+		if stdDev.Valid {
+			columnAnalysis.StdDev = &stdDev.Float64
+		}
+	}
+	if minLength.Valid && maxLength.Valid {
+		minLengthInt, maxLengthInt := int(minLength.Int64), int(maxLength.Int64)
+		columnAnalysis.MinLength = &minLengthInt
+		columnAnalysis.MaxLength = &maxLengthInt
+	}
+
+	var bucketSql string
+	switch {
+	case col.Type.IsText():
+		lengthSql := "char_length(" + colSql + ")"
+		bucketSql = "select " + lengthSql + ", count(*)" + fromSql + " where " + colSql + " is not null group by " + lengthSql + " order by count(*) desc, " + lengthSql + " limit 100"
+	case col.Type.IsTemporal():
+		monthSql := "date_format(" + colSql + ", '%Y-%m')"
+		bucketSql = "select " + monthSql + ", count(*)" + fromSql + " where " + monthSql + " is not null group by " + monthSql + " order by " + monthSql
+	default:
+		return
+	}
+	rows, err = dbc.Query(bucketSql)
+	if err != nil {
+		log.Print("GetColumnAnalysis failed to get column histogram")
+		log.Println(bucketSql)
+		log.Println(err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var bucket string
+		var quantity int
+		rows.Scan(&bucket, &quantity)
+		valueInfo := schema.ValueInfo{Value: bucket, Quantity: quantity}
+		if col.Type.IsText() {
+			length, _ := strconv.Atoi(bucket)
+			valueInfo.Value = length
+			columnAnalysis.LengthCounts = append(columnAnalysis.LengthCounts, valueInfo)
+		} else {
+			columnAnalysis.DateCounts = append(columnAnalysis.DateCounts, valueInfo)
+		}
+	}
+	return
+}
+
+func (model mysqlModel) GetGroupCounts(databaseName string, table *schema.Table, groupBy []params.GroupByCol, tableParams *params.TableParams) (groups []schema.GroupCount, err error) {
+	dbc, err := getConnection(buildConnectionString(databaseName))
+	if err != nil {
+		log.Print("GetGroupCounts failed to get connection")
+		return
+	}
+	defer dbc.Close()
+
+	// only the filters apply, paging and sorting are meaningless for a count
+	innerSql, values := buildQuery(table, &params.TableParams{Filter: tableParams.Filter}, &driver_interface.PeekLookup{})
+	var groupCols []string
+	joinSql := ""
+	for ix, groupCol := range groupBy {
+		groupCols = append(groupCols, fmt.Sprintf("t.`%s`", groupCol.Column.Name))
+		if groupCol.PeekFk != nil {
+			groupCols = append(groupCols, fmt.Sprintf("g%d.`%s`", ix, groupCol.PeekCol.Name))
+			joinSql = joinSql + fmt.Sprintf(" left outer join %s g%d on g%d.`%s` = t.`%s`", "`"+groupCol.PeekFk.DestinationTable.Name+"`", ix, ix, groupCol.PeekFk.DestinationColumns[0].Name, groupCol.Column.Name)
+		}
+	}
+	groupBySql := strings.Join(groupCols, ", ")
+	sql := "select " + groupBySql + ", count(*) qty from (" + innerSql + ") as t" + joinSql + " group by " + groupBySql + " order by count(*) desc limit 1000"
+	rows, err := dbc.Query(sql, values...)
+	if err != nil {
+		log.Print("GetGroupCounts failed to get query")
+		log.Println(sql)
+		log.Println(err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		scanned := make([]interface{}, len(groupCols))
+		scanTargets := make([]interface{}, len(scanned)+1)
+		for ix := range scanned {
+			scanTargets[ix] = &scanned[ix]
+		}
+		group := schema.GroupCount{}
+		scanTargets[len(scanned)] = &group.Quantity
+		rows.Scan(scanTargets...)
+		scanIndex := 0
+		for _, groupCol := range groupBy {
+			group.Values = append(group.Values, scanned[scanIndex])
+			scanIndex++
+			var peekValue interface{}
+			if groupCol.PeekFk != nil {
+				peekValue = scanned[scanIndex]
+				scanIndex++
+			}
+			group.PeekValues = append(group.PeekValues, peekValue)
+		}
+		groups = append(groups, group)
+	}
+	return
+}
+
+func (model mysqlModel) RunQuery(databaseName string, query string, rowLimit int, timeout time.Duration) (result driver_interface.QueryResult, err error) {
+	dbc, err := getConnection(buildConnectionString(databaseName))
+	if err != nil {
+		log.Print("RunQuery failed to get connection")
+		return
+	}
+	defer dbc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	tx, err := dbc.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		log.Print("RunQuery failed to begin transaction")
+		return
+	}
+	defer tx.Rollback()
+	// stop the server working on it as well as giving up waiting, mariadb's equivalent is in seconds
+	_, err = tx.ExecContext(ctx, fmt.Sprintf("set session max_execution_time = %d", timeout/time.Millisecond))
+	if err != nil {
+		_, err = tx.ExecContext(ctx, fmt.Sprintf("set session max_statement_time = %f", timeout.Seconds()))
+	}
+	if err != nil {
+		log.Print("RunQuery failed to set timeout")
+		log.Println(err)
+		return
+	}
+
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		log.Print("RunQuery failed to get query")
+		log.Println(query)
+		log.Println(err)
+		return
+	}
+	defer rows.Close()
+	return driver_interface.ReadQueryResult(rows, rowLimit)
+}
+
+func (model mysqlModel) GetOrphans(databaseName string, fk *schema.Fk) (orphans schema.FkOrphans, err error) {
+	dbc, err := getConnection(buildConnectionString(databaseName))
+	if err != nil {
+		log.Print("GetOrphans failed to get connection")
+		return
+	}
+	defer dbc.Close()
+
+	orphans = schema.FkOrphans{Fk: fk}
+	var sourceCols, notNull, joinPredicates []string
+	for ix, sourceCol := range fk.SourceColumns {
+		sourceCols = append(sourceCols, "s.`"+sourceCol.Name+"`")
+		notNull = append(notNull, "s.`"+sourceCol.Name+"` is not null")
+		joinPredicates = append(joinPredicates, "d.`"+fk.DestinationColumns[ix].Name+"` = s.`"+sourceCol.Name+"`")
+	}
+	from := " from `" + fk.SourceTable.Name + "` s where " + strings.Join(notNull, " and ") +
+		" and not exists (select 1 from `" + fk.DestinationTable.Name + "` d where " + strings.Join(joinPredicates, " and ") + ")"
+	groupBy := strings.Join(sourceCols, ", ")
+
+	sql := "select count(*)" + from
+	rows, err := dbc.Query(sql)
+	if err != nil {
+		log.Print("GetOrphans failed to count orphans")
+		log.Println(sql)
+		log.Println(err)
+		return
+	}
+	if rows.Next() {
+		rows.Scan(&orphans.RowCount)
+	}
+	rows.Close()
+
+	sql = "select " + groupBy + ", count(*) qty" + from + " group by " + groupBy + " order by count(*) desc limit 100"
+	rows, err = dbc.Query(sql)
+	if err != nil {
+		log.Print("GetOrphans failed to get query")
+		log.Println(sql)
+		log.Println(err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		values := make([]interface{}, len(fk.SourceColumns))
+		scanTargets := make([]interface{}, len(values)+1)
+		for ix := range values {
+			scanTargets[ix] = &values[ix]
+		}
+		var quantity int
+		scanTargets[len(values)] = &quantity
+		rows.Scan(scanTargets...)
+		orphans.ValueCounts = append(orphans.ValueCounts, schema.OrphanValue{
+			Values:   values,
+			Quantity: quantity,
 		})
 	}
 	return
@@ -485,6 +861,14 @@ func (model mysqlModel) GetAnalysis(databaseName string, table *schema.Table) (a
 
 func buildQuery(table *schema.Table, params *params.TableParams, peekFinder *driver_interface.PeekLookup) (sql string, values []interface{}) {
 	sql = "select t.*"
+	if len(peekFinder.Columns) > 0 {
+		// only the chosen columns, plus the ones needed for links
+		var selectCols []string
+		for _, col := range peekFinder.Columns {
+			selectCols = append(selectCols, "t.`"+col.Name+"`")
+		}
+		sql = "select " + strings.Join(selectCols, ", ")
+	}
 
 	// peek cols
 	for fkIndex, fk := range peekFinder.Fks {
@@ -495,18 +879,14 @@ func buildQuery(table *schema.Table, params *params.TableParams, peekFinder *dri
 
 	// inbound fk counts
 	for inboundFkIndex, inboundFk := range table.InboundFks {
-		onPredicates := []string{}
-		for ix, sourceCol := range inboundFk.SourceColumns {
-			onPredicates = append(onPredicates, fmt.Sprintf("ifk%d.`%s` = t.`%s`", inboundFkIndex, sourceCol.Name, inboundFk.DestinationColumns[ix].Name))
-		}
-		onString := strings.Join(onPredicates, " and ")
-		sql = sql + fmt.Sprintf(", (select count(*) from `%s` ifk%d where %s) ifk%d_count", inboundFk.SourceTable.Name, inboundFkIndex, onString, inboundFkIndex)
+		sql = sql + fmt.Sprintf(", %s ifk%d_count", inboundCountSql(inboundFkIndex, inboundFk), inboundFkIndex)
 	}
 
 	sql = sql + " from `" + table.Name + "` t"
 
 	// peek tables
-	for fkIndex, fk := range peekFinder.Fks {
+	joinFks := peekFinder.JoinFks(params)
+	for fkIndex, fk := range joinFks {
 		sql = sql + fmt.Sprintf(" left outer join `%s` fk%d on ", fk.DestinationTable.Name, fkIndex)
 		onPredicates := []string{}
 		for ix, sourceCol := range fk.SourceColumns {
@@ -524,18 +904,48 @@ func buildQuery(table *schema.Table, params *params.TableParams, peekFinder *dri
 		var index = 1
 		for _, v := range query {
 			col := v.Field
-			clauses = append(clauses, "t.`"+col.Name+"` = ?")
+			if v.Related != nil {
+				clauses = append(clauses, relatedValueSql(table, v.Related, joinFks)+" = ?")
+			} else if len(v.JsonPath) > 0 {
+				clauses = append(clauses, "json_unquote(json_extract(t.`"+col.Name+"`, ?)) = ?")
+				values = append(values, v.JsonPathExpression())
+			} else {
+				clauses = append(clauses, "t.`"+col.Name+"` = ?")
+			}
 			index = index + 1
 			values = append(values, v.Values[0]) // todo: maybe support multiple values
 		}
 		sql = sql + strings.Join(clauses, " and ")
 	}
 
-	if len(params.Sort) > 0 {
+	if params.UsesCursor(table) {
+		if len(query) > 0 {
+			sql = sql + " and "
+		} else {
+			sql = sql + " where "
+		}
+		cursorSql, cursorValues := keysetClause(params.KeysetColumns(table), params.Cursor)
+		sql = sql + cursorSql
+		values = append(values, cursorValues...)
+	}
+
+	// paging from a cursor needs a unique order, and reads previous pages backwards.
+	// without one the order is left as it was asked for so as not to make the database sort every limited read.
+	orderBy := params.Sort
+	if params.UsesCursor(table) {
+		orderBy = params.KeysetColumns(table)
+	}
+	backwards := params.UsesCursor(table) && params.Cursor.Backwards
+	if len(orderBy) > 0 {
 		var sortParts []string
-		for _, sortCol := range params.Sort {
-			sortString := "`" + sortCol.Column.Name + "`"
-			if sortCol.Descending {
+		for _, sortCol := range orderBy {
+			var sortString string
+			if sortCol.Related != nil {
+				sortString = relatedValueSql(table, sortCol.Related, joinFks)
+			} else {
+				sortString = "t.`" + sortCol.Column.Name + "`"
+			}
+			if sortCol.Descending != backwards {
 				sortString = sortString + " desc"
 			}
 			sortParts = append(sortParts, sortString)
@@ -543,16 +953,94 @@ func buildQuery(table *schema.Table, params *params.TableParams, peekFinder *dri
 		sql = sql + " order by " + strings.Join(sortParts, ", ")
 	}
 
-	if params.RowLimit > 0 || params.SkipRows > 0 {
+	if params.UsesCursor(table) {
+		sql = sql + fmt.Sprintf(" limit %d", params.RowLimit)
+	} else if params.RowLimit > 0 || params.SkipRows > 0 {
 		sql = sql + fmt.Sprintf(" limit %d offset %d", params.RowLimit, params.SkipRows)
 	}
 	return
 }
 
+// Joins the tables along their fks, each table is aliased by its position in the list
+func buildJoinQuery(join driver_interface.JoinQuery) (sql string, values []interface{}) {
+	var selectTables []string
+	for ix := range join.Tables {
+		selectTables = append(selectTables, fmt.Sprintf("t%d.*", ix))
+	}
+	sql = "select " + strings.Join(selectTables, ", ")
+	for ix, joined := range join.Tables {
+		if joined.Step == nil {
+			sql = sql + fmt.Sprintf("\nfrom `%s` t%d", joined.Table.Name, ix)
+			continue
+		}
+		var onPredicates []string
+		toColumns := joined.Step.ToColumns()
+		for colIx, fromCol := range joined.Step.FromColumns() {
+			onPredicates = append(onPredicates, fmt.Sprintf("t%d.`%s` = t%d.`%s`", joined.JoinedTo, fromCol.Name, ix, toColumns[colIx].Name))
+		}
+		sql = sql + fmt.Sprintf("\njoin `%s` t%d on %s", joined.Table.Name, ix, strings.Join(onPredicates, " and "))
+	}
+
+	if len(join.Filters) > 0 {
+		var clauses []string
+		for _, filter := range join.Filters {
+			clauses = append(clauses, fmt.Sprintf("t%d.`%s` = ?", filter.TableIndex, filter.Column.Name))
+			values = append(values, filter.Value)
+		}
+		sql = sql + "\nwhere " + strings.Join(clauses, "\nand ")
+	}
+	return
+}
+
+// Number of rows referencing the row through the inbound fk, as a subquery
+func inboundCountSql(inboundFkIndex int, inboundFk *schema.Fk) string {
+	onPredicates := []string{}
+	for ix, sourceCol := range inboundFk.SourceColumns {
+		onPredicates = append(onPredicates, fmt.Sprintf("ifk%d.`%s` = t.`%s`", inboundFkIndex, sourceCol.Name, inboundFk.DestinationColumns[ix].Name))
+	}
+	onString := strings.Join(onPredicates, " and ")
+	return fmt.Sprintf("(select count(*) from `%s` ifk%d where %s)", inboundFk.SourceTable.Name, inboundFkIndex, onString)
+}
+
+// Expression for a peeked value (from the peek joins) or an inbound count, for sorting and filtering on
+func relatedValueSql(table *schema.Table, related *params.RelatedValue, joinFks []*schema.Fk) string {
+	if related.InboundFk != nil {
+		for inboundFkIndex, inboundFk := range table.InboundFks {
+			if inboundFk == related.InboundFk {
+				return inboundCountSql(inboundFkIndex, inboundFk)
+			}
+		}
+	}
+	return fmt.Sprintf("fk%d.`%s`", driver_interface.JoinIndex(joinFks, related.PeekFk), related.PeekCol)
+}
+
+// Rows after (or before) the cursor in the keyset order, e.g. for keyset (a, b) after (1, 2):
+// ((t.`a` > ?) or (t.`a` = ? and t.`b` > ?)) with values 1, 1, 2
+func keysetClause(keyset []params.SortCol, cursor *params.KeysetCursor) (sql string, values []interface{}) {
+	var alternatives []string
+	for ix, sortCol := range keyset {
+		var parts []string
+		for _, equalCol := range keyset[:ix] {
+			parts = append(parts, "t.`"+equalCol.Column.Name+"` = ?")
+		}
+		operator := ">"
+		if sortCol.Descending != cursor.Backwards {
+			operator = "<"
+		}
+		parts = append(parts, "t.`"+sortCol.Column.Name+"` "+operator+" ?")
+		alternatives = append(alternatives, "("+strings.Join(parts, " and ")+")")
+		for _, value := range cursor.Values[:ix+1] {
+			values = append(values, value)
+		}
+	}
+	sql = "(" + strings.Join(alternatives, " or ") + ")"
+	return
+}
+
 func (model mysqlModel) getColumns(dbc *sql.DB, table *schema.Table) (cols []*schema.Column, err error) {
 	// todo: parameterise
 	// todo: read all tables' columns in one query hit
-	sql := fmt.Sprintf("select column_name, data_type, is_nullable, character_maximum_length from information_schema.columns where table_schema = '%s' and table_name='%s' order by ordinal_position;", opts.Database, table.Name)
+	sql := fmt.Sprintf("select column_name, data_type, column_type, is_nullable, coalesce(character_maximum_length, -1), coalesce(numeric_precision, -1), coalesce(numeric_scale, -1), coalesce(collation_name, ''), coalesce(column_default, ''), extra, coalesce(generation_expression, '') from information_schema.columns where table_schema = '%s' and table_name='%s' order by ordinal_position;", opts.Database, table.Name)
 
 	rows, err := dbc.Query(sql)
 	if err != nil {
@@ -563,20 +1051,69 @@ func (model mysqlModel) getColumns(dbc *sql.DB, table *schema.Table) (cols []*sc
 	cols = []*schema.Column{}
 	colIndex := 0
 	for rows.Next() {
-		var len int
-		var name, typeName, isNullable string
-		rows.Scan(&name, &typeName, &isNullable, &len)
-		if strings.Contains(typeName, "char") {
-			typeName = fmt.Sprintf("%s(%d)", typeName, len)
+		var len, precision, scale int
+		var name, typeName, columnType, isNullable, collation, defaultValue, extra, generationExpression string
+		rows.Scan(&name, &typeName, &columnType, &isNullable, &len, &precision, &scale, &collation, &defaultValue, &extra, &generationExpression)
+		dataType := schema.DataType{Name: typeName, Collation: collation}
+		// only keep the sizes that are part of the column definition, e.g. text reports a max length but doesn't take one
+		switch typeName {
+		case "char", "varchar", "binary", "varbinary":
+			dataType.MaxLength = &len
+		case "decimal":
+			dataType.Precision = &precision
+			dataType.Scale = &scale
+		case "enum", "set":
+			dataType.EnumValues = parseEnumValues(columnType)
+			dataType.IsSet = typeName == "set"
+		case "json":
+			dataType.IsJson = true
+		case "geometry", "point", "linestring", "polygon", "multipoint", "multilinestring", "multipolygon", "geometrycollection", "geomcollection":
+			dataType.Spatial = schema.MysqlGeometry
 		}
 		nullable := isNullable == "YES"
-		thisCol := schema.Column{Position: colIndex, Name: name, Type: typeName, Nullable: nullable}
+		thisCol := schema.Column{Position: colIndex, Name: name, Type: dataType, Nullable: nullable, Default: defaultValue}
+		// extra contains things like "auto_increment", "VIRTUAL GENERATED" and "STORED GENERATED"
+		extra = strings.ToLower(extra)
+		thisCol.IsIdentity = strings.Contains(extra, "auto_increment")
+		if strings.Contains(extra, "virtual generated") || strings.Contains(extra, "stored generated") {
+			thisCol.IsGenerated = true
+			thisCol.GeneratedExpression = generationExpression
+		}
 		cols = append(cols, &thisCol)
 		colIndex++
 	}
 	return
 }
 
+// Extracts the permitted values from a column_type such as "enum('a','b')" or "set('it''s','x')"
+func parseEnumValues(columnType string) (values []string) {
+	openIndex := strings.Index(columnType, "(")
+	closeIndex := strings.LastIndex(columnType, ")")
+	if openIndex < 0 || closeIndex < openIndex {
+		return
+	}
+	list := columnType[openIndex+1 : closeIndex]
+	var value strings.Builder
+	inQuote := false
+	for i := 0; i < len(list); i++ {
+		c := list[i]
+		switch {
+		case c == '\'' && inQuote && i+1 < len(list) && list[i+1] == '\'':
+			value.WriteByte(c) // doubled up quote is an escaped quote
+			i++
+		case c == '\'':
+			if inQuote {
+				values = append(values, value.String())
+				value.Reset()
+			}
+			inQuote = !inQuote
+		case inQuote:
+			value.WriteByte(c)
+		}
+	}
+	return
+}
+
 func (model mysqlModel) SetTableDescription(database string, table string, description string) (err error) {
 	return
 }
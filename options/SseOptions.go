@@ -19,6 +19,15 @@ type SseOptions struct {
 	ListenOnAddress       string
 	ListenOnPort          string
 	PeekConfigPath        string
+	VirtualFksConfigPath  string
+	InferFks              bool
+	InferFksConfigPath    string
+	ValidateInferredFks   bool
+	AnalysisSampleRows    int
+	SearchConfigPath      string
+	SearchSeconds         int
+	QuerySeconds          int
+	SavedViewsPath        string
 }
 
 var Options = &SseOptions{}
@@ -52,6 +61,15 @@ func SetupArgs() {
 	flag.BoolVar(&Options.Live, "live", false, "Update html templates & schema information on from every page load. (Row counts and data are always updated).")
 	flag.StringVar(&Options.ConnectionDisplayName, "display-name", "", "A display name for this connection.")
 	flag.StringVar(&Options.PeekConfigPath, "peek-config-path", "", "Path to peek configuration file. Defaults to the file included with schema explorer.")
+	flag.StringVar(&Options.VirtualFksConfigPath, "virtual-fks-config-path", "", "Path to virtual relationships configuration file, for relationships the database doesn't declare. Defaults to the file included with schema explorer.")
+	flag.BoolVar(&Options.InferFks, "infer-fks", false, "Guess foreign keys that aren't declared in the database from column names, e.g. customer_id => customers.id")
+	flag.StringVar(&Options.InferFksConfigPath, "infer-fks-config-path", "", "Path to the naming rules for infer-fks. Defaults to the file included with schema explorer.")
+	flag.BoolVar(&Options.ValidateInferredFks, "validate-inferred-fks", false, "Only keep inferred foreign keys where a sample of the values exist in the referenced table. Slows down loading the schema.")
+	flag.IntVar(&Options.AnalysisSampleRows, "analysis-sample-rows", 0, "Only analyse the first n rows of each table unless another sample is chosen on the analysis page, for large tables where analysing every row is too slow. Defaults to analysing all rows.")
+	flag.StringVar(&Options.SearchConfigPath, "search-config-path", "", "Path to the list of columns to include when searching all tables for a value. Defaults to the file included with schema explorer.")
+	flag.IntVar(&Options.SearchSeconds, "search-seconds", 0, "How long to wait for results when searching all tables for a value, columns not searched in time are listed. Defaults to 10 seconds.")
+	flag.IntVar(&Options.QuerySeconds, "query-seconds", 0, "How long a query from the SQL page can run before it is cancelled. Defaults to 30 seconds.")
+	flag.StringVar(&Options.SavedViewsPath, "saved-views-path", "", "Path to the file that saved views and queries are kept in. A sqlite file, defaults to saved-views.db in a schemaexplorer folder in your user config folder.")
 
 	for _, driver := range drivers.Drivers {
 		for key, driverOpt := range driver.Options {
@@ -92,6 +110,54 @@ func ReadArgsAndEnv() {
 		Options.PeekConfigPath = envPeek
 	}
 
+	if Options.VirtualFksConfigPath == "" && os.Getenv("schemaexplorer_virtual_fks_config_path") != "" {
+		Options.VirtualFksConfigPath = os.Getenv("schemaexplorer_virtual_fks_config_path")
+	}
+	if !Options.InferFks && os.Getenv("schemaexplorer_infer_fks") != "" {
+		boolInfer, err := strconv.ParseBool(os.Getenv("schemaexplorer_infer_fks"))
+		if err != nil {
+			panic(err)
+		}
+		Options.InferFks = boolInfer
+	}
+	if Options.InferFksConfigPath == "" && os.Getenv("schemaexplorer_infer_fks_config_path") != "" {
+		Options.InferFksConfigPath = os.Getenv("schemaexplorer_infer_fks_config_path")
+	}
+	if !Options.ValidateInferredFks && os.Getenv("schemaexplorer_validate_inferred_fks") != "" {
+		boolValidate, err := strconv.ParseBool(os.Getenv("schemaexplorer_validate_inferred_fks"))
+		if err != nil {
+			panic(err)
+		}
+		Options.ValidateInferredFks = boolValidate
+	}
+	if Options.AnalysisSampleRows == 0 && os.Getenv("schemaexplorer_analysis_sample_rows") != "" {
+		sampleRows, err := strconv.Atoi(os.Getenv("schemaexplorer_analysis_sample_rows"))
+		if err != nil {
+			panic(err)
+		}
+		Options.AnalysisSampleRows = sampleRows
+	}
+	if Options.SearchConfigPath == "" && os.Getenv("schemaexplorer_search_config_path") != "" {
+		Options.SearchConfigPath = os.Getenv("schemaexplorer_search_config_path")
+	}
+	if Options.SearchSeconds == 0 && os.Getenv("schemaexplorer_search_seconds") != "" {
+		searchSeconds, err := strconv.Atoi(os.Getenv("schemaexplorer_search_seconds"))
+		if err != nil {
+			panic(err)
+		}
+		Options.SearchSeconds = searchSeconds
+	}
+	if Options.QuerySeconds == 0 && os.Getenv("schemaexplorer_query_seconds") != "" {
+		querySeconds, err := strconv.Atoi(os.Getenv("schemaexplorer_query_seconds"))
+		if err != nil {
+			panic(err)
+		}
+		Options.QuerySeconds = querySeconds
+	}
+	if Options.SavedViewsPath == "" && os.Getenv("schemaexplorer_saved_views_path") != "" {
+		Options.SavedViewsPath = os.Getenv("schemaexplorer_saved_views_path")
+	}
+
 	for _, driver := range drivers.Drivers {
 		for key, driverOpt := range driver.Options {
 			if *driverOpt.Value != "" {
@@ -10,21 +10,33 @@ import (
 )
 
 type SortCol struct {
-	Column     *schema.Column
+	Column     *schema.Column // nil when sorting on a related value
 	Descending bool
+	Related    *RelatedValue
 }
 
 type TableParams struct {
 	RowLimit int
-	SkipRows int
+	SkipRows int // with a cursor this is only used for showing row numbers
 	CardView bool
 	Filter   FieldFilterList
 	Sort     []SortCol
+	Cursor   *KeysetCursor
+	Columns  schema.ColumnList // columns to show in this order, nil for all of the table's columns
+}
+
+// Where a page starts for keyset paging, so deep pages don't have to count their way past all the earlier rows
+type KeysetCursor struct {
+	Values    []string // values of the KeysetColumns of the row next to the page
+	Backwards bool     // page ends before the row instead of starting after it
 }
 
 type FieldFilter struct {
-	Field  *schema.Column
-	Values []string
+	Field         *schema.Column
+	Values        []string
+	ArrayContains bool          // for array columns, match rows where the array contains the value instead of equalling it
+	JsonPath      []string      // for json columns, compare the value found at this path (keys and array indexes) instead of the whole column
+	Related       *RelatedValue // compare a value from a related table instead, Field is nil
 }
 
 type FieldFilterList []FieldFilter
@@ -41,6 +53,21 @@ func (tableParams TableParams) CardViewOn() TableParams {
 	return tableParams
 }
 
+// the query string name of the sort column, e.g. "name" or "~count.orders.customer_id"
+func (sortCol SortCol) Key() string {
+	if sortCol.Related != nil {
+		return sortCol.Related.Key()
+	}
+	return sortCol.Column.Name
+}
+
+func (sortCol SortCol) String() string {
+	if sortCol.Related != nil {
+		return sortCol.Related.String()
+	}
+	return sortCol.Column.String()
+}
+
 // for building sort links
 func (tableParams TableParams) AddSort(col *schema.Column) TableParams {
 	var newSort []SortCol
@@ -60,12 +87,13 @@ func (tableParams TableParams) AddSort(col *schema.Column) TableParams {
 
 	// return a copy of the tableparams with a new sort
 	tableParams.Sort = newSort
+	tableParams.Cursor = nil // the cursor values are for the old sort
 	return tableParams
 }
 
 func (tableParams TableParams) SortPosition(col *schema.Column) int {
 	for index, c := range tableParams.Sort {
-		if c.Column.Name == col.Name {
+		if c.Column != nil && c.Column.Name == col.Name {
 			return index + 1
 		}
 	}
@@ -77,18 +105,180 @@ func (tableParams TableParams) PrevPage() TableParams {
 	if skip < 0 {
 		skip = 0
 	}
-	tableParams.SkipRows = tableParams.SkipRows - tableParams.RowLimit
+	tableParams.SkipRows = skip
+	tableParams.Cursor = nil
+	return tableParams
+}
+
+func (tableParams TableParams) FirstPage() TableParams {
+	tableParams.SkipRows = 0
+	tableParams.Cursor = nil
 	return tableParams
 }
 
 func (tableParams TableParams) NextPage() TableParams {
 	tableParams.SkipRows = tableParams.SkipRows + tableParams.RowLimit
+	tableParams.Cursor = nil
+	return tableParams
+}
+
+// the page ending just before the row with the given keyset values, the first page doesn't need a cursor
+func (tableParams TableParams) PrevPageBefore(values []string) TableParams {
+	tableParams = tableParams.PrevPage()
+	if tableParams.SkipRows > 0 {
+		tableParams.Cursor = &KeysetCursor{Values: values, Backwards: true}
+	}
+	return tableParams
+}
+
+// the page starting just after the row with the given keyset values
+func (tableParams TableParams) NextPageAfter(values []string) TableParams {
+	tableParams = tableParams.NextPage()
+	tableParams.Cursor = &KeysetCursor{Values: values}
+	return tableParams
+}
+
+// Columns to seek on for keyset paging: the sort columns followed by any primary key columns not already sorted on.
+// Nil if the rows can't be paged by key, i.e. there's no row limit, no primary key, or a column can be null or
+// has values that don't survive the round trip through the query string, such as dates.
+func (tableParams TableParams) KeysetColumns(table *schema.Table) (keyset []SortCol) {
+	if tableParams.RowLimit <= 0 || table.Pk == nil || len(table.Pk.Columns) == 0 {
+		return nil
+	}
+	for _, sortCol := range tableParams.Sort {
+		if sortCol.Related != nil {
+			return nil // peeked values can be null and counts aren't unique, so they're no use for seeking
+		}
+	}
+	keyset = append(keyset, tableParams.Sort...)
+	for _, pkCol := range table.Pk.Columns {
+		if !tableParams.IsSorted(pkCol) {
+			keyset = append(keyset, SortCol{Column: pkCol})
+		}
+	}
+	for _, sortCol := range keyset {
+		if (sortCol.Column.Nullable && !sortCol.Column.IsInPrimaryKey) || !canSeek(sortCol.Column.Type) {
+			return nil
+		}
+	}
+	return
+}
+
+func canSeek(dataType schema.DataType) bool {
+	if dataType.IsText() || dataType.IsNumeric() {
+		return true
+	}
+	switch strings.ToLower(dataType.Name) {
+	case "uuid", "uniqueidentifier":
+		return true
+	}
+	return false
+}
+
+// True if the query should start from the cursor instead of skipping rows
+func (tableParams TableParams) UsesCursor(table *schema.Table) bool {
+	return tableParams.Cursor != nil && len(tableParams.Cursor.Values) > 0 && len(tableParams.Cursor.Values) == len(tableParams.KeysetColumns(table))
+}
+
+// True if the rows are read in the keyset order, so the first and last rows can be the cursors of the pages either side.
+// The primary key is only added to the order when a cursor is in use, otherwise the sort has to be unique by itself.
+func (tableParams TableParams) ReadsInKeysetOrder(table *schema.Table) bool {
+	keyset := tableParams.KeysetColumns(table)
+	return keyset != nil && (tableParams.UsesCursor(table) || len(keyset) == len(tableParams.Sort))
+}
+
+// The columns to show in the grid, in display order
+func (tableParams TableParams) ShownColumns(table *schema.Table) schema.ColumnList {
+	if tableParams.Columns == nil {
+		return table.Columns
+	}
+	return tableParams.Columns
+}
+
+// The columns that have been hidden, in table order
+func (tableParams TableParams) HiddenColumns(table *schema.Table) (hidden schema.ColumnList) {
+	if tableParams.Columns == nil {
+		return nil
+	}
+	for _, col := range table.Columns {
+		if !tableParams.Columns.Contains(col) {
+			hidden = append(hidden, col)
+		}
+	}
+	return
+}
+
+// for building column chooser links, adds the column at the end
+func (tableParams TableParams) ShowColumn(table *schema.Table, col *schema.Column) TableParams {
+	shown := tableParams.ShownColumns(table)
+	if shown.Contains(col) {
+		return tableParams
+	}
+	tableParams.Columns = append(append(schema.ColumnList{}, shown...), col)
+	return tableParams
+}
+
+// for building column chooser links, the last column can't be hidden
+func (tableParams TableParams) HideColumn(table *schema.Table, col *schema.Column) TableParams {
+	var columns schema.ColumnList
+	for _, shownCol := range tableParams.ShownColumns(table) {
+		if shownCol != col {
+			columns = append(columns, shownCol)
+		}
+	}
+	if len(columns) == 0 {
+		return tableParams
+	}
+	tableParams.Columns = columns
+	return tableParams
+}
+
+// for building column chooser links, moves the column left (negative offset) or right by offset places
+func (tableParams TableParams) MoveColumn(table *schema.Table, col *schema.Column, offset int) TableParams {
+	columns := append(schema.ColumnList{}, tableParams.ShownColumns(table)...)
+	from := columns.IndexOf(col)
+	to := from + offset
+	if from < 0 || to < 0 || to >= len(columns) {
+		return tableParams
+	}
+	columns = append(columns[:from], columns[from+1:]...)
+	columns = append(columns[:to], append(schema.ColumnList{col}, columns[to:]...)...)
+	tableParams.Columns = columns
+	return tableParams
+}
+
+func (tableParams TableParams) ShowAllColumns() TableParams {
+	tableParams.Columns = nil
 	return tableParams
 }
 
+// Columns for the drivers to select: the shown columns followed by any others needed for building links,
+// i.e. primary key, foreign key and keyset columns. Nil when all the columns are shown.
+func (tableParams TableParams) SelectColumns(table *schema.Table) (columns schema.ColumnList) {
+	if tableParams.Columns == nil {
+		return nil
+	}
+	columns = append(columns, tableParams.Columns...)
+	for _, col := range table.Columns {
+		if columns.Contains(col) {
+			continue
+		}
+		needed := col.IsInPrimaryKey || len(col.Fks) > 0 || len(col.InboundFks) > 0
+		for _, sortCol := range tableParams.KeysetColumns(table) {
+			if sortCol.Column == col {
+				needed = true
+			}
+		}
+		if needed {
+			columns = append(columns, col)
+		}
+	}
+	return
+}
+
 func (tableParams TableParams) IsSortedAsc(col *schema.Column) bool {
 	for _, c := range tableParams.Sort {
-		if c.Column.Name == col.Name && !c.Descending {
+		if c.Column != nil && c.Column.Name == col.Name && !c.Descending {
 			return true
 		}
 	}
@@ -97,7 +287,7 @@ func (tableParams TableParams) IsSortedAsc(col *schema.Column) bool {
 
 func (tableParams TableParams) IsSortedDesc(col *schema.Column) bool {
 	for _, c := range tableParams.Sort {
-		if c.Column.Name == col.Name && c.Descending {
+		if c.Column != nil && c.Column.Name == col.Name && c.Descending {
 			return true
 		}
 	}
@@ -106,7 +296,7 @@ func (tableParams TableParams) IsSortedDesc(col *schema.Column) bool {
 
 func (tableParams TableParams) IsSorted(col *schema.Column) bool {
 	for _, c := range tableParams.Sort {
-		if c.Column.Name == col.Name {
+		if c.Column != nil && c.Column.Name == col.Name {
 			return true
 		}
 	}
@@ -115,17 +305,104 @@ func (tableParams TableParams) IsSorted(col *schema.Column) bool {
 
 func (tableParams TableParams) ClearSort() TableParams {
 	tableParams.Sort = nil
+	tableParams.Cursor = nil
 	return tableParams
 }
 
+// for building sort links on related values, toggles the direction if already sorted
+func (tableParams TableParams) AddRelatedSort(related RelatedValue) TableParams {
+	var newSort []SortCol
+	exists := false
+	for _, sortCol := range tableParams.Sort {
+		if sortCol.Related != nil && sortCol.Related.Key() == related.Key() {
+			exists = true
+			sortCol.Descending = !sortCol.Descending
+		}
+		newSort = append(newSort, sortCol)
+	}
+	if !exists {
+		newSort = append(newSort, SortCol{Related: &related})
+	}
+	tableParams.Sort = newSort
+	tableParams.Cursor = nil
+	return tableParams
+}
+
+// for building filter links on related values, replaces any existing filter on the same value
+func (tableParams TableParams) SetRelatedFilter(related RelatedValue, value string) TableParams {
+	var newFilter FieldFilterList
+	for _, filter := range tableParams.Filter {
+		if filter.Related == nil || filter.Related.Key() != related.Key() {
+			newFilter = append(newFilter, filter)
+		}
+	}
+	tableParams.Filter = append(newFilter, FieldFilter{Related: &related, Values: []string{value}})
+	tableParams.SkipRows = 0
+	tableParams.Cursor = nil
+	return tableParams
+}
+
+// The related values that are sorted or filtered on, for the drivers to join in
+func (tableParams TableParams) RelatedValues() (related []*RelatedValue) {
+	for _, sortCol := range tableParams.Sort {
+		if sortCol.Related != nil {
+			related = append(related, sortCol.Related)
+		}
+	}
+	for _, filter := range tableParams.Filter {
+		if filter.Related != nil {
+			related = append(related, filter.Related)
+		}
+	}
+	return
+}
+
+// for building filter links, replaces any existing filter on the column
+func (tableParams TableParams) SetFilter(col *schema.Column, value string) TableParams {
+	tableParams = tableParams.RemoveFilter(col)
+	tableParams.Filter = append(tableParams.Filter, FieldFilter{Field: col, Values: []string{value}})
+	return tableParams
+}
+
+// for building filter links, leaves filters on other columns in place
+func (tableParams TableParams) RemoveFilter(col *schema.Column) TableParams {
+	var newFilter FieldFilterList
+	for _, filter := range tableParams.Filter {
+		if filter.Field != col {
+			newFilter = append(newFilter, filter)
+		}
+	}
+	tableParams.Filter = newFilter
+	tableParams.SkipRows = 0 // the current page is meaningless once the filter changes
+	tableParams.Cursor = nil
+	return tableParams
+}
+
+// for showing the filter, e.g. "customer.name"
+func (filter FieldFilter) JsonPathString() string {
+	return strings.Join(filter.JsonPath, ".")
+}
+
+// for populating filter dropdowns, empty if the column isn't filtered
+func (tableParams TableParams) FilterValue(col *schema.Column) string {
+	for _, filter := range tableParams.Filter {
+		if filter.Field == col && len(filter.Values) > 0 {
+			return filter.Values[0]
+		}
+	}
+	return ""
+}
+
 func (tableParams TableParams) ClearFilter() TableParams {
 	tableParams.Filter = nil
+	tableParams.Cursor = nil
 	return tableParams
 }
 
 func (tableParams TableParams) ClearPaging() TableParams {
 	tableParams.RowLimit = 0
 	tableParams.SkipRows = 0
+	tableParams.Cursor = nil
 	return tableParams
 }
 
@@ -147,6 +424,21 @@ func (tableParams TableParams) AsQueryString() template.URL {
 		parts = append(parts, fmt.Sprintf("%s=%d", skipKey, tableParams.SkipRows))
 	}
 
+	// repeated rather than comma separated as names can contain commas
+	for _, col := range tableParams.Columns {
+		parts = append(parts, fmt.Sprintf("%s=%s", columnsKey, url.QueryEscape(col.Name)))
+	}
+
+	if tableParams.Cursor != nil {
+		cursorKey := afterKey
+		if tableParams.Cursor.Backwards {
+			cursorKey = beforeKey
+		}
+		for _, value := range tableParams.Cursor.Values {
+			parts = append(parts, fmt.Sprintf("%s=%s", cursorKey, url.QueryEscape(value)))
+		}
+	}
+
 	return template.URL(strings.Join(parts, "&"))
 }
 
@@ -164,9 +456,9 @@ func BuildSortParts(tableParams TableParams) []string {
 	var sort []string
 	for _, sortCol := range tableParams.Sort {
 		if sortCol.Descending {
-			sort = append(sort, sortCol.Column.Name+descStr)
+			sort = append(sort, sortCol.Key()+descStr)
 		} else {
-			sort = append(sort, sortCol.Column.Name)
+			sort = append(sort, sortCol.Key())
 		}
 	}
 	var parts []string
@@ -185,16 +477,39 @@ func BuildFilterParts(filterList FieldFilterList) []string {
 	var parts []string
 	for _, part := range filterList {
 		// todo: support multiple values correctly
-		parts = append(parts, fmt.Sprintf("%s=%s", part.Field, strings.Join(part.Values, ",")))
+		var values []string
+		for _, value := range part.Values {
+			values = append(values, url.QueryEscape(value))
+		}
+		key := url.QueryEscape(part.Key())
+		parts = append(parts, fmt.Sprintf("%s=%s", key, strings.Join(values, ",")))
 	}
 	return parts
 }
 
+// the query string key for the filter, unescaped, e.g. "tags~contains"
+func (filter FieldFilter) Key() string {
+	if filter.Related != nil {
+		return filter.Related.Key()
+	}
+	if len(filter.JsonPath) > 0 {
+		return JsonPathKey(filter.Field, filter.JsonPath)
+	}
+	if filter.ArrayContains {
+		return ArrayContainsKey(filter.Field)
+	}
+	return filter.Field.Name
+}
+
 // todo: more robust separation of query param keys
 const rowLimitKey = "_rowLimit" // this should be reasonably safe from clashes with column names
 const skipKey = "_skip"
 const cardViewKey = "_cardView"
 const sortKey = "_sort"
+const groupByKey = "_groupBy"
+const afterKey = "_after"   // repeated for each keyset column
+const beforeKey = "_before" // repeated for each keyset column
+const columnsKey = "_cols"  // repeated for each shown column
 
 func ParseTableParams(raw url.Values, table *schema.Table) (tableParams *TableParams) {
 	tableParams = &TableParams{}
@@ -202,12 +517,18 @@ func ParseTableParams(raw url.Values, table *schema.Table) (tableParams *TablePa
 	ParseSkip(raw, tableParams)
 	ParseSortParams(raw, tableParams, table)
 	ParseCardView(raw, tableParams)
+	ParseCursor(raw, tableParams)
+	ParseColumns(raw, tableParams, table)
 
 	// exclude special params from column filters
 	raw.Del(rowLimitKey)
 	raw.Del(skipKey)
 	raw.Del(sortKey)
 	raw.Del(cardViewKey)
+	raw.Del(groupByKey)
+	raw.Del(afterKey)
+	raw.Del(beforeKey)
+	raw.Del(columnsKey)
 
 	ParseFilters(raw, tableParams, table)
 
@@ -217,11 +538,26 @@ func ParseTableParams(raw url.Values, table *schema.Table) (tableParams *TablePa
 func ParseFilters(raw url.Values, tableParams *TableParams, table *schema.Table) {
 	if len(raw) > 0 {
 		for k, v := range raw {
+			filter := FieldFilter{Values: v}
+			if related := FindRelatedValue(table, k); related != nil {
+				filter.Related = related
+				tableParams.Filter = append(tableParams.Filter, filter)
+				continue
+			}
+			if strings.HasSuffix(k, containsStr) {
+				filter.ArrayContains = true
+				k = strings.TrimSuffix(k, containsStr)
+			}
+			if pathIndex := strings.Index(k, jsonPathStr); pathIndex >= 0 {
+				filter.JsonPath = strings.Split(k[pathIndex+len(jsonPathStr):], ".")
+				k = k[:pathIndex]
+			}
 			_, col := table.FindColumn(k)
 			if col == nil {
 				panic("Column '" + k + "' not found")
 			}
-			tableParams.Filter = append(tableParams.Filter, FieldFilter{Field: col, Values: v})
+			filter.Field = col
+			tableParams.Filter = append(tableParams.Filter, filter)
 		}
 	}
 }
@@ -233,6 +569,28 @@ func ParseCardView(raw url.Values, tableParams *TableParams) {
 	}
 }
 
+func ParseCursor(raw url.Values, tableParams *TableParams) {
+	if after, ok := raw[afterKey]; ok {
+		tableParams.Cursor = &KeysetCursor{Values: after}
+	}
+	if before, ok := raw[beforeKey]; ok {
+		tableParams.Cursor = &KeysetCursor{Values: before, Backwards: true}
+	}
+}
+
+// Reads the columns to show in order, e.g. "_cols=name&_cols=id", without any all of them are shown
+func ParseColumns(raw url.Values, tableParams *TableParams, table *schema.Table) {
+	for _, columnName := range raw[columnsKey] {
+		_, column := table.FindColumn(columnName)
+		if column == nil {
+			panic("column not found for showing: " + columnName)
+		}
+		if !tableParams.Columns.Contains(column) {
+			tableParams.Columns = append(tableParams.Columns, column)
+		}
+	}
+}
+
 func ParseRowLimit(raw url.Values, tableParams *TableParams) {
 	rowLimitString := raw.Get(rowLimitKey)
 	if rowLimitString == "" {
@@ -260,6 +618,33 @@ func ParseSkip(raw url.Values, tableParams *TableParams) {
 }
 
 const descStr = "~desc"
+const containsStr = "~contains"
+const jsonPathStr = "~json."
+
+// for building links to rows with a value inside a json column, e.g. "payload~json.customer.name"
+// keys containing dots can't be expressed
+func JsonPathKey(col *schema.Column, path []string) string {
+	return col.Name + jsonPathStr + strings.Join(path, ".")
+}
+
+// json path in the syntax used by mysql, mssql and sqlite, e.g. $."customer"."addresses"[0]
+// all-digit path elements are treated as array indexes
+func (filter FieldFilter) JsonPathExpression() string {
+	expression := "$"
+	for _, element := range filter.JsonPath {
+		if _, err := strconv.Atoi(element); err == nil {
+			expression = expression + "[" + element + "]"
+		} else {
+			expression = expression + "." + strconv.Quote(element)
+		}
+	}
+	return expression
+}
+
+// for building links to rows where an array column includes the given value
+func ArrayContainsKey(col *schema.Column) string {
+	return col.Name + containsStr
+}
 
 func ParseSortParams(raw url.Values, tableParams *TableParams, table *schema.Table) {
 	sortString := raw.Get(sortKey)
@@ -278,6 +663,11 @@ func ParseSortParams(raw url.Values, tableParams *TableParams, table *schema.Tab
 		} else {
 			columnName = columnString
 		}
+		if related := FindRelatedValue(table, columnName); related != nil {
+			colSort.Related = related
+			tableParams.Sort = append(tableParams.Sort, colSort)
+			continue
+		}
 		_, column := table.FindColumn(columnName)
 		if column == nil {
 			panic("column not found for sorting: " + columnString)
@@ -291,3 +681,134 @@ func ParseSortParams(raw url.Values, tableParams *TableParams, table *schema.Tab
 	}
 	return
 }
+
+// A column to group rows by, optionally showing the peek column of the table the column references
+// in place of the raw key value, e.g. "owner_id~peek.name"
+type GroupByCol struct {
+	Column  *schema.Column
+	PeekFk  *schema.Fk     // single-column fk from Column, nil for a plain group
+	PeekCol *schema.Column // column of PeekFk.DestinationTable to show
+}
+
+const peekStr = "~peek."
+
+func (groupCol GroupByCol) Key() string {
+	if groupCol.PeekFk != nil {
+		return groupCol.Column.Name + peekStr + groupCol.PeekCol.Name
+	}
+	return groupCol.Column.Name
+}
+
+func (groupCol GroupByCol) String() string {
+	if groupCol.PeekFk != nil {
+		return fmt.Sprintf("%s (%s.%s)", groupCol.Column, groupCol.PeekFk.DestinationTable, groupCol.PeekCol)
+	}
+	return groupCol.Column.Name
+}
+
+// All the ways the rows of the table can be grouped: each column, then each peek column of single-column fks
+func GroupByChoices(table *schema.Table) (choices []GroupByCol) {
+	for _, col := range table.Columns {
+		choices = append(choices, GroupByCol{Column: col})
+	}
+	for _, fk := range table.Fks {
+		if len(fk.SourceColumns) != 1 {
+			continue
+		}
+		for _, peekCol := range fk.DestinationTable.PeekColumns {
+			choices = append(choices, GroupByCol{Column: fk.SourceColumns[0], PeekFk: fk, PeekCol: peekCol})
+		}
+	}
+	return
+}
+
+// Reads the comma separated group by keys, e.g. "_groupBy=status,owner_id~peek.name",
+// the key can also be repeated and blanks are ignored so that unused dropdowns can be submitted
+func ParseGroupBy(raw url.Values, table *schema.Table) (groupBy []GroupByCol) {
+	choices := GroupByChoices(table)
+	var keys []string
+	for _, groupByString := range raw[groupByKey] {
+		for _, key := range strings.Split(groupByString, ",") {
+			if key != "" {
+				keys = append(keys, key)
+			}
+		}
+	}
+	for _, key := range keys {
+		found := false
+		for _, choice := range choices {
+			if choice.Key() == key {
+				groupBy = append(groupBy, choice)
+				found = true
+				break
+			}
+		}
+		if !found {
+			panic("column not found for grouping: " + key)
+		}
+	}
+	return
+}
+
+const countStr = "~count."
+
+// A value from a related table that rows can be sorted and filtered on as if it were one of their own columns:
+// a peek column of a referenced table, or the number of rows referencing each row.
+type RelatedValue struct {
+	PeekFk    *schema.Fk     // single-column fk to the table holding PeekCol
+	PeekCol   *schema.Column // a peek column of PeekFk.DestinationTable
+	InboundFk *schema.Fk     // when set, the value is the number of rows of InboundFk.SourceTable referencing the row
+}
+
+// e.g. "customer_id~peek.name" or "~count.orders.customer_id"
+func (related RelatedValue) Key() string {
+	if related.InboundFk != nil {
+		return InboundCountKey(related.InboundFk)
+	}
+	return related.PeekFk.SourceColumns[0].Name + peekStr + related.PeekCol.Name
+}
+
+func (related RelatedValue) String() string {
+	if related.InboundFk != nil {
+		return fmt.Sprintf("%s(%s) rows", related.InboundFk.SourceTable, related.InboundFk.SourceColumns)
+	}
+	return fmt.Sprintf("%s (%s.%s)", related.PeekFk.SourceColumns[0], related.PeekFk.DestinationTable, related.PeekCol)
+}
+
+// for building links to rows by the number of rows referencing them, e.g. customers with no orders
+func InboundCountKey(fk *schema.Fk) string {
+	var names []string
+	for _, col := range fk.SourceColumns {
+		names = append(names, col.Name)
+	}
+	return countStr + fk.SourceTable.String() + "." + strings.Join(names, ".")
+}
+
+// The peek columns of the table's single-column fks, then the count of each inbound fk
+func RelatedValueChoices(table *schema.Table) (choices []RelatedValue) {
+	for _, fk := range table.Fks {
+		if len(fk.SourceColumns) != 1 || fk.SourceColumns[0].Type.IsArray() {
+			continue
+		}
+		for _, peekCol := range fk.DestinationTable.PeekColumns {
+			choices = append(choices, RelatedValue{PeekFk: fk, PeekCol: peekCol})
+		}
+	}
+	for _, fk := range table.InboundFks {
+		choices = append(choices, RelatedValue{InboundFk: fk})
+	}
+	return
+}
+
+// nil if the key isn't for a related value of the table
+func FindRelatedValue(table *schema.Table, key string) *RelatedValue {
+	if !strings.HasPrefix(key, countStr) && !strings.Contains(key, peekStr) {
+		return nil
+	}
+	for _, choice := range RelatedValueChoices(table) {
+		if choice.Key() == key {
+			return &choice
+		}
+	}
+	panic("related value not found: " + key)
+}
@@ -8,14 +8,16 @@ import (
 	"github.com/timabell/schema-explorer/params"
 	"github.com/timabell/schema-explorer/reader"
 	"github.com/timabell/schema-explorer/schema"
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 	"log"
 	"os"
 	"strconv"
 	"strings"
+	"time"
 )
 
 var driverOpts = drivers.DriverOpts{
@@ -121,6 +123,8 @@ func (model pgModel) ReadSchema(databaseName string) (database *schema.Database,
 			Descriptions:         false,
 			FkNames:              true,
 			PagingWithoutSorting: true,
+			JsonFilter:           true,
+			TableSample:          true,
 		},
 		DefaultSchemaName: "public",
 		Name:              databaseName,
@@ -133,9 +137,13 @@ func (model pgModel) ReadSchema(databaseName string) (database *schema.Database,
 	}
 
 	// add table columns
+	serverVersion, err := getServerVersion(dbc)
+	if err != nil {
+		return
+	}
 	for _, table := range database.Tables {
 		var cols []*schema.Column
-		cols, err = model.getColumns(dbc, table)
+		cols, err = model.getColumns(dbc, table, serverVersion)
 		if err != nil {
 			return
 		}
@@ -148,6 +156,11 @@ func (model pgModel) ReadSchema(databaseName string) (database *schema.Database,
 		return
 	}
 
+	err = readCheckConstraints(dbc, database)
+	if err != nil {
+		return
+	}
+
 	// indexes
 	err = readIndexes(dbc, database)
 	if err != nil {
@@ -272,12 +285,12 @@ func readConstraints(dbc *sql.DB, database *schema.Database) (err error) {
 	// null-proof unnest: https://stackoverflow.com/a/49736694
 	sql := fmt.Sprintf(`
 		select
-			con.oid, ns.nspname, con.conname, con.contype,
+			con.oid, ns.nspname, con.conname, con.contype, con.convalidated,
 			tns.nspname, tbl.relname, col.attname column_name,
 			fns.nspname foreign_namespace_name, ftbl.relname foreign_table_name, fcol.attname foreign_column_name
 		from
 			(
-				select pgc.oid, pgc.connamespace, pgc.conrelid, pgc.confrelid, pgc.contype, pgc.conname,
+				select pgc.oid, pgc.connamespace, pgc.conrelid, pgc.confrelid, pgc.contype, pgc.conname, pgc.convalidated,
 				       unnest(case when pgc.conkey <> '{}' then pgc.conkey else '{null}' end) as conkey,
 				       unnest(case when pgc.confkey <> '{}' then pgc.confkey else '{null}' end) as confkey
 				from pg_constraint pgc
@@ -299,7 +312,8 @@ func readConstraints(dbc *sql.DB, database *schema.Database) (err error) {
 		var oid, conType, namespace, name,
 			sourceNamespace, sourceTableName, sourceColumnName,
 			destinationNamespace, destinationTableName, destinationColumnName string
-		rows.Scan(&oid, &namespace, &name, &conType,
+		var validated bool
+		rows.Scan(&oid, &namespace, &name, &conType, &validated,
 			&sourceNamespace, &sourceTableName, &sourceColumnName,
 			&destinationNamespace, &destinationTableName, &destinationColumnName)
 		tableToFind := &schema.Table{Schema: sourceNamespace, Name: sourceTableName}
@@ -334,6 +348,7 @@ func readConstraints(dbc *sql.DB, database *schema.Database) (err error) {
 			}
 			if fk == nil { // then this is a never-before-seen fk
 				fk = schema.NewFk(name, sourceTable, sourceColumn, destinationTable, destinationColumn)
+				fk.NotTrusted = !validated // added "not valid", existing rows weren't checked
 				database.Fks = append(database.Fks, fk)
 				sourceTable.Fks = append(sourceTable.Fks, fk)
 				sourceColumn.Fks = append(sourceColumn.Fks, fk)
@@ -345,8 +360,20 @@ func readConstraints(dbc *sql.DB, database *schema.Database) (err error) {
 			//log.Printf("pk: %s.%s", sourceTable, sourceColumn)
 			sourceTable.Pk.Columns = append(sourceTable.Pk.Columns, sourceColumn)
 			sourceColumn.IsInPrimaryKey = true
-		case "c": // todo: check constraint
-		case "u": // todo: unique constraint
+		case "c": // check constraints are read by readCheckConstraints as they don't always reference columns
+		case "u": // unique constraint
+			var uniqueConstraint *schema.UniqueConstraint
+			for _, existingConstraint := range sourceTable.UniqueConstraints {
+				if existingConstraint.Name == name {
+					uniqueConstraint = existingConstraint
+					break
+				}
+			}
+			if uniqueConstraint == nil {
+				uniqueConstraint = &schema.UniqueConstraint{Name: name, Table: sourceTable}
+				sourceTable.UniqueConstraints = append(sourceTable.UniqueConstraints, uniqueConstraint)
+			}
+			uniqueConstraint.Columns = append(uniqueConstraint.Columns, sourceColumn)
 		case "t": // todo: constraint
 		case "x": // todo: exclusion constraint
 		default:
@@ -356,6 +383,39 @@ func readConstraints(dbc *sql.DB, database *schema.Database) (err error) {
 	return
 }
 
+func readCheckConstraints(dbc *sql.DB, database *schema.Database) (err error) {
+	sql := `
+		select tns.nspname, tbl.relname, con.conname, pg_get_constraintdef(con.oid)
+		from pg_constraint con
+			inner join pg_class tbl on tbl.oid = con.conrelid
+			inner join pg_namespace tns on tbl.relnamespace = tns.oid
+		where con.contype = 'c'
+			and tns.nspname not in ('pg_catalog','information_schema')
+		order by tns.nspname, tbl.relname, con.conname;`
+
+	rows, err := dbc.Query(sql)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tableNamespace, tableName, name, definition string
+		rows.Scan(&tableNamespace, &tableName, &name, &definition)
+		tableToFind := &schema.Table{Schema: tableNamespace, Name: tableName}
+		table := database.FindTable(tableToFind)
+		if table == nil {
+			err = errors.New(fmt.Sprintf("Table %s not found, owner of check constraint %s", tableToFind.String(), name))
+			return
+		}
+		table.CheckConstraints = append(table.CheckConstraints, &schema.CheckConstraint{
+			Name:   name,
+			Clause: strings.TrimPrefix(definition, "CHECK "),
+			Table:  table,
+		})
+	}
+	return
+}
+
 func readIndexes(dbc *sql.DB, database *schema.Database) (err error) {
 	sql := `
 		select
@@ -441,7 +501,62 @@ func (model pgModel) GetSqlRows(databaseName string, table *schema.Table, params
 	return
 }
 
+func (model pgModel) GetSqlText(databaseName string, table *schema.Table, params *params.TableParams, peekFinder *driver_interface.PeekLookup) string {
+	sql, values := buildQuery(table, params, peekFinder)
+	return driver_interface.InlineValues(sql, values, driver_interface.StandardStrings)
+}
+
+func (model pgModel) GetQueryPlan(databaseName string, table *schema.Table, params *params.TableParams, peekFinder *driver_interface.PeekLookup) (plan *driver_interface.PlanNode, err error) {
+	dbc, err := getConnection(buildConnectionString(databaseName))
+	if err != nil {
+		log.Print("GetQueryPlan failed to get connection")
+		return
+	}
+	defer dbc.Close()
+
+	// explained with the values as parameters like when the rows are read, so the plan is the one they get
+	sql, values := buildQuery(table, params, peekFinder)
+	sql = "explain (format json) " + sql
+	var planJson []byte
+	err = dbc.QueryRow(sql, values...).Scan(&planJson)
+	if err != nil {
+		log.Print("GetQueryPlan failed to get query")
+		log.Println(sql)
+		log.Println(err)
+		return
+	}
+	return driver_interface.PlanFromJson(planJson, pgPlanLabel)
+}
+
+// e.g. "Index Scan using poke_pkey on poke fk0"
+func pgPlanLabel(key string, object map[string]interface{}) string {
+	nodeType, ok := object["Node Type"].(string)
+	if !ok {
+		return key
+	}
+	label := nodeType
+	if index, ok := object["Index Name"].(string); ok {
+		label = label + " using " + index
+	}
+	if relation, ok := object["Relation Name"].(string); ok {
+		label = label + " on " + relation
+		if alias, ok := object["Alias"].(string); ok && alias != relation {
+			label = label + " " + alias
+		}
+	}
+	return label
+}
+
+func (model pgModel) GetJoinSql(databaseName string, join driver_interface.JoinQuery) string {
+	sql, values := buildJoinQuery(join)
+	return driver_interface.InlineValues(sql, values, driver_interface.StandardStrings)
+}
+
 func (model pgModel) GetRowCount(databaseName string, table *schema.Table, params *params.TableParams) (rowCount int, err error) {
+	return model.GetRowCountContext(context.Background(), databaseName, table, params)
+}
+
+func (model pgModel) GetRowCountContext(ctx context.Context, databaseName string, table *schema.Table, params *params.TableParams) (rowCount int, err error) {
 	dbc, err := getConnection(buildConnectionString(databaseName))
 	if err != nil {
 		log.Print("GetRows failed to get connection")
@@ -451,13 +566,14 @@ func (model pgModel) GetRowCount(databaseName string, table *schema.Table, param
 
 	sql, values := buildQuery(table, params, &driver_interface.PeekLookup{})
 	sql = "select count(*) from (" + sql + ") as x"
-	rows, err := dbc.Query(sql, values...)
+	rows, err := dbc.QueryContext(ctx, sql, values...)
 	if err != nil {
 		log.Print("GetRowCount failed to get query")
 		log.Println(sql)
 		log.Println(err)
 		return
 	}
+	defer rows.Close()
 	if !rows.Next() {
 		err = errors.New("GetRowCount query returned no rows")
 		return
@@ -466,38 +582,285 @@ func (model pgModel) GetRowCount(databaseName string, table *schema.Table, param
 	return
 }
 
-func (model pgModel) GetAnalysis(databaseName string, table *schema.Table) (analysis []schema.ColumnAnalysis, err error) {
-	// todo, might be good to stream this all the way to the http response
+func (model pgModel) GetColumnAnalysis(databaseName string, table *schema.Table, col *schema.Column, sample schema.AnalysisSample) (columnAnalysis schema.ColumnAnalysis, err error) {
 	dbc, err := getConnection(buildConnectionString(databaseName))
 	if err != nil {
-		log.Print("GetAnalysis failed to get connection")
+		log.Print("GetColumnAnalysis failed to get connection")
 		return
 	}
 	defer dbc.Close()
 
-	analysis = []schema.ColumnAnalysis{}
-	for _, col := range table.Columns {
-		sql := "select \"" + col.Name + "\", count(*) qty from \"" + table.Schema + "\".\"" + table.Name + "\" group by \"" + col.Name + "\" order by count(*) desc, \"" + col.Name + "\" limit 100;"
-		rows, err := dbc.Query(sql)
-		if err != nil {
-			log.Print("GetAnalysis failed to get query")
-			log.Println(sql)
-			log.Println(err)
-			return nil, err
-		}
-		var valueInfos []schema.ValueInfo
-		for rows.Next() {
-			var value interface{}
-			var quantity int
-			rows.Scan(&value, &quantity)
-			valueInfos = append(valueInfos, schema.ValueInfo{
-				Value:    value,
-				Quantity: quantity,
-			})
-		}
-		analysis = append(analysis, schema.ColumnAnalysis{
-			Column:      col,
-			ValueCounts: valueInfos,
+	fromSql := " from \"" + table.Schema + "\".\"" + table.Name + "\""
+	switch {
+	case sample.Percent > 0:
+		// whole pages rather than bernoulli's rows so that only the sampled part of the table is read
+		fromSql = fmt.Sprintf("%s tablesample system (%d) repeatable (%d)", fromSql, sample.Percent, schema.AnalysisSampleSeed)
+	case sample.FirstRows > 0:
+		fromSql = fmt.Sprintf(" from (select * from \"%s\".\"%s\" limit %d) s", table.Schema, table.Name, sample.FirstRows)
+	}
+	colSql := "\"" + col.Name + "\""
+	sql := "select " + colSql + ", count(*) qty" + fromSql + " group by " + colSql + " order by count(*) desc, " + colSql + " limit 100;"
+	rows, err := dbc.Query(sql)
+	if err != nil {
+		log.Print("GetColumnAnalysis failed to get query")
+		log.Println(sql)
+		log.Println(err)
+		return
+	}
+	var valueInfos []schema.ValueInfo
+	for rows.Next() {
+		var value interface{}
+		var quantity int
+		rows.Scan(&value, &quantity)
+		valueInfos = append(valueInfos, schema.ValueInfo{
+			Value:    value,
+			Quantity: quantity,
+		})
+	}
+	rows.Close()
+	columnAnalysis = schema.ColumnAnalysis{
+		Column:      col,
+		ValueCounts: valueInfos,
+		Sample:      sample,
+	}
+	err = addColumnStats(dbc, col, fromSql, &columnAnalysis)
+	return
+}
+
+// Adds summary statistics for the column, plus a length or month histogram for text and temporal columns
+func addColumnStats(dbc *sql.DB, col *schema.Column, fromSql string, columnAnalysis *schema.ColumnAnalysis) (err error) {
+	var nonNullCount int
+	var average, stdDev sql.NullFloat64
+	var minLength, maxLength sql.NullInt64
+	colSql := "\"" + col.Name + "\""
+	statsSql := "select count(*), count(" + colSql + "), count(distinct " + colSql + ")"
+	scanTargets := []interface{}{&columnAnalysis.RowCount, &nonNullCount, &columnAnalysis.DistinctCount}
+	switch {
+	case col.Type.IsNumeric():
+		statsSql = statsSql + ", min(" + colSql + "), max(" + colSql + "), avg(" + colSql + "::numeric), stddev_pop(" + colSql + "::numeric)"
+		scanTargets = append(scanTargets, &columnAnalysis.Min, &columnAnalysis.Max, &average, &stdDev)
+	case col.Type.IsText():
+		statsSql = statsSql + ", min(" + colSql + "), max(" + colSql + "), min(length(" + colSql + ")), max(length(" + colSql + "))"
+		scanTargets = append(scanTargets, &columnAnalysis.Min, &columnAnalysis.Max, &minLength, &maxLength)
+	case col.Type.IsTemporal():
+		statsSql = statsSql + ", min(" + colSql + "), max(" + colSql + ")"
+		scanTargets = append(scanTargets, &columnAnalysis.Min, &columnAnalysis.Max)
+	}
+	statsSql = statsSql + fromSql
+	rows, err := dbc.Query(statsSql)
+	if err != nil {
+		log.Print("GetColumnAnalysis failed to get column stats")
+		log.Println(statsSql)
+		log.Println(err)
+		return
+	}
+	if rows.Next() {
+		rows.Scan(scanTargets...)
+	}
+	rows.Close()
+	columnAnalysis.NullCount = columnAnalysis.RowCount - nonNullCount
+	if average.Valid {
+		columnAnalysis.Average = &average.Float64
+		if stdDev.Valid {
+			columnAnalysis.StdDev = &stdDev.Float64
+		}
+	}
+	if minLength.Valid && maxLength.Valid {
+		minLengthInt, maxLengthInt := int(minLength.Int64), int(maxLength.Int64)
+		columnAnalysis.MinLength = &minLengthInt
+		columnAnalysis.MaxLength = &maxLengthInt
+	}
+
+	var bucketSql string
+	switch {
+	case col.Type.IsText():
+		lengthSql := "length(" + colSql + ")"
+		bucketSql = "select " + lengthSql + ", count(*)" + fromSql + " where " + colSql + " is not null group by " + lengthSql + " order by count(*) desc, " + lengthSql + " limit 100"
+	case col.Type.IsTemporal():
+		monthSql := "to_char(" + colSql + ", 'YYYY-MM')"
+		bucketSql = "select " + monthSql + ", count(*)" + fromSql + " where " + monthSql + " is not null group by " + monthSql + " order by " + monthSql
+	default:
+		return
+	}
+	rows, err = dbc.Query(bucketSql)
+	if err != nil {
+		log.Print("GetColumnAnalysis failed to get column histogram")
+		log.Println(bucketSql)
+		log.Println(err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var bucket string
+		var quantity int
+		rows.Scan(&bucket, &quantity)
+		valueInfo := schema.ValueInfo{Value: bucket, Quantity: quantity}
+		if col.Type.IsText() {
+			length, _ := strconv.Atoi(bucket)
+			valueInfo.Value = length
+			columnAnalysis.LengthCounts = append(columnAnalysis.LengthCounts, valueInfo)
+		} else {
+			columnAnalysis.DateCounts = append(columnAnalysis.DateCounts, valueInfo)
+		}
+	}
+	return
+}
+
+func (model pgModel) GetGroupCounts(databaseName string, table *schema.Table, groupBy []params.GroupByCol, tableParams *params.TableParams) (groups []schema.GroupCount, err error) {
+	dbc, err := getConnection(buildConnectionString(databaseName))
+	if err != nil {
+		log.Print("GetGroupCounts failed to get connection")
+		return
+	}
+	defer dbc.Close()
+
+	// only the filters apply, paging and sorting are meaningless for a count
+	innerSql, values := buildQuery(table, &params.TableParams{Filter: tableParams.Filter}, &driver_interface.PeekLookup{})
+	var groupCols []string
+	joinSql := ""
+	for ix, groupCol := range groupBy {
+		groupCols = append(groupCols, fmt.Sprintf("t.\"%s\"", groupCol.Column.Name))
+		if groupCol.PeekFk != nil {
+			groupCols = append(groupCols, fmt.Sprintf("g%d.\"%s\"", ix, groupCol.PeekCol.Name))
+			joinSql = joinSql + fmt.Sprintf(" left outer join %s g%d on g%d.\"%s\" = t.\"%s\"", "\""+groupCol.PeekFk.DestinationTable.Schema+"\".\""+groupCol.PeekFk.DestinationTable.Name+"\"", ix, ix, groupCol.PeekFk.DestinationColumns[0].Name, groupCol.Column.Name)
+		}
+	}
+	groupBySql := strings.Join(groupCols, ", ")
+	sql := "select " + groupBySql + ", count(*) qty from (" + innerSql + ") as t" + joinSql + " group by " + groupBySql + " order by count(*) desc limit 1000"
+	rows, err := dbc.Query(sql, values...)
+	if err != nil {
+		log.Print("GetGroupCounts failed to get query")
+		log.Println(sql)
+		log.Println(err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		scanned := make([]interface{}, len(groupCols))
+		scanTargets := make([]interface{}, len(scanned)+1)
+		for ix := range scanned {
+			scanTargets[ix] = &scanned[ix]
+		}
+		group := schema.GroupCount{}
+		scanTargets[len(scanned)] = &group.Quantity
+		rows.Scan(scanTargets...)
+		scanIndex := 0
+		for _, groupCol := range groupBy {
+			group.Values = append(group.Values, scanned[scanIndex])
+			scanIndex++
+			var peekValue interface{}
+			if groupCol.PeekFk != nil {
+				peekValue = scanned[scanIndex]
+				scanIndex++
+			}
+			group.PeekValues = append(group.PeekValues, peekValue)
+		}
+		groups = append(groups, group)
+	}
+	return
+}
+
+func (model pgModel) RunQuery(databaseName string, query string, rowLimit int, timeout time.Duration) (result driver_interface.QueryResult, err error) {
+	dbc, err := getConnection(buildConnectionString(databaseName))
+	if err != nil {
+		log.Print("RunQuery failed to get connection")
+		return
+	}
+	defer dbc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	tx, err := dbc.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		log.Print("RunQuery failed to begin transaction")
+		return
+	}
+	defer tx.Rollback()
+	// stop the server working on it as well as giving up waiting
+	_, err = tx.ExecContext(ctx, fmt.Sprintf("set local statement_timeout = %d", timeout/time.Millisecond))
+	if err != nil {
+		log.Print("RunQuery failed to set timeout")
+		log.Println(err)
+		return
+	}
+
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		log.Print("RunQuery failed to get query")
+		log.Println(query)
+		log.Println(err)
+		return
+	}
+	defer rows.Close()
+	return driver_interface.ReadQueryResult(rows, rowLimit)
+}
+
+func (model pgModel) GetOrphans(databaseName string, fk *schema.Fk) (orphans schema.FkOrphans, err error) {
+	dbc, err := getConnection(buildConnectionString(databaseName))
+	if err != nil {
+		log.Print("GetOrphans failed to get connection")
+		return
+	}
+	defer dbc.Close()
+
+	orphans = schema.FkOrphans{Fk: fk}
+	// each value of an array is checked on its own, so a row is orphaned if any of them are missing
+	var valueCols, notNull, joinPredicates []string
+	var unnestSql string
+	hasArray := false
+	for ix, sourceCol := range fk.SourceColumns {
+		valueCol := "s.\"" + sourceCol.Name + "\""
+		if sourceCol.Type.IsArray() {
+			hasArray = true
+			unnestSql = unnestSql + fmt.Sprintf(" cross join lateral unnest(s.\"%s\") e%d(v)", sourceCol.Name, ix)
+			valueCol = fmt.Sprintf("e%d.v", ix)
+		}
+		valueCols = append(valueCols, valueCol)
+		notNull = append(notNull, valueCol+" is not null")
+		joinPredicates = append(joinPredicates, "d.\""+fk.DestinationColumns[ix].Name+"\" = "+valueCol)
+	}
+	from := " from \"" + fk.SourceTable.Schema + "\".\"" + fk.SourceTable.Name + "\" s" + unnestSql + " where " + strings.Join(notNull, " and ") +
+		" and not exists (select 1 from \"" + fk.DestinationTable.Schema + "\".\"" + fk.DestinationTable.Name + "\" d where " + strings.Join(joinPredicates, " and ") + ")"
+	groupBy := strings.Join(valueCols, ", ")
+
+	countSql := "count(*)"
+	if hasArray {
+		countSql = "count(distinct s.ctid)" // rows rather than array values
+	}
+	sql := "select " + countSql + from
+	rows, err := dbc.Query(sql)
+	if err != nil {
+		log.Print("GetOrphans failed to count orphans")
+		log.Println(sql)
+		log.Println(err)
+		return
+	}
+	if rows.Next() {
+		rows.Scan(&orphans.RowCount)
+	}
+	rows.Close()
+
+	sql = "select " + groupBy + ", count(*) qty" + from + " group by " + groupBy + " order by count(*) desc limit 100"
+	rows, err = dbc.Query(sql)
+	if err != nil {
+		log.Print("GetOrphans failed to get query")
+		log.Println(sql)
+		log.Println(err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		values := make([]interface{}, len(fk.SourceColumns))
+		scanTargets := make([]interface{}, len(values)+1)
+		for ix := range values {
+			scanTargets[ix] = &values[ix]
+		}
+		var quantity int
+		scanTargets[len(values)] = &quantity
+		rows.Scan(scanTargets...)
+		orphans.ValueCounts = append(orphans.ValueCounts, schema.OrphanValue{
+			Values:   values,
+			Quantity: quantity,
 		})
 	}
 	return
@@ -505,6 +868,14 @@ func (model pgModel) GetAnalysis(databaseName string, table *schema.Table) (anal
 
 func buildQuery(table *schema.Table, params *params.TableParams, peekFinder *driver_interface.PeekLookup) (sql string, values []interface{}) {
 	sql = "select t.*"
+	if len(peekFinder.Columns) > 0 {
+		// only the chosen columns, plus the ones needed for links
+		var selectCols []string
+		for _, col := range peekFinder.Columns {
+			selectCols = append(selectCols, "t.\""+col.Name+"\"")
+		}
+		sql = "select " + strings.Join(selectCols, ", ")
+	}
 
 	// peek cols
 	for fkIndex, fk := range peekFinder.Fks {
@@ -515,18 +886,14 @@ func buildQuery(table *schema.Table, params *params.TableParams, peekFinder *dri
 
 	// inbound fk counts
 	for inboundFkIndex, inboundFk := range table.InboundFks {
-		onPredicates := []string{}
-		for ix, sourceCol := range inboundFk.SourceColumns {
-			onPredicates = append(onPredicates, fmt.Sprintf("ifk%d.\"%s\" = t.\"%s\"", inboundFkIndex, sourceCol.Name, inboundFk.DestinationColumns[ix].Name))
-		}
-		onString := strings.Join(onPredicates, " and ")
-		sql = sql + fmt.Sprintf(", (select count(*) from \"%s\".\"%s\" ifk%d where %s) ifk%d_count", inboundFk.SourceTable.Schema, inboundFk.SourceTable.Name, inboundFkIndex, onString, inboundFkIndex)
+		sql = sql + fmt.Sprintf(", %s ifk%d_count", inboundCountSql(inboundFkIndex, inboundFk), inboundFkIndex)
 	}
 
 	sql = sql + " from \"" + table.Schema + "\".\"" + table.Name + "\" t"
 
 	// peek tables
-	for fkIndex, fk := range peekFinder.Fks {
+	joinFks := peekFinder.JoinFks(params)
+	for fkIndex, fk := range joinFks {
 		sql = sql + fmt.Sprintf(" left outer join \"%s\".\"%s\" fk%d on ", fk.DestinationTable.Schema, fk.DestinationTable.Name, fkIndex)
 		onPredicates := []string{}
 		for ix, sourceCol := range fk.SourceColumns {
@@ -544,18 +911,52 @@ func buildQuery(table *schema.Table, params *params.TableParams, peekFinder *dri
 		var index = 1
 		for _, v := range query {
 			col := v.Field
-			clauses = append(clauses, "t.\""+col.Name+"\" = $"+strconv.Itoa(index))
+			switch {
+			case v.Related != nil:
+				clauses = append(clauses, relatedValueSql(table, v.Related, joinFks)+" = $"+strconv.Itoa(index))
+			case len(v.JsonPath) > 0:
+				clauses = append(clauses, "t.\""+col.Name+"\" #>> $"+strconv.Itoa(index)+" = $"+strconv.Itoa(index+1))
+				index = index + 1
+				values = append(values, pq.Array(v.JsonPath))
+			case v.ArrayContains:
+				clauses = append(clauses, "$"+strconv.Itoa(index)+" = any(t.\""+col.Name+"\")")
+			default:
+				clauses = append(clauses, "t.\""+col.Name+"\" = $"+strconv.Itoa(index))
+			}
 			index = index + 1
 			values = append(values, v.Values[0]) // todo: maybe support multiple values
 		}
 		sql = sql + strings.Join(clauses, " and ")
 	}
 
-	if len(params.Sort) > 0 {
+	if params.UsesCursor(table) {
+		if len(query) > 0 {
+			sql = sql + " and "
+		} else {
+			sql = sql + " where "
+		}
+		cursorSql, cursorValues := keysetClause(params.KeysetColumns(table), params.Cursor, len(values)+1)
+		sql = sql + cursorSql
+		values = append(values, cursorValues...)
+	}
+
+	// paging from a cursor needs a unique order, and reads previous pages backwards.
+	// without one the order is left as it was asked for so as not to make the database sort every limited read.
+	orderBy := params.Sort
+	if params.UsesCursor(table) {
+		orderBy = params.KeysetColumns(table)
+	}
+	backwards := params.UsesCursor(table) && params.Cursor.Backwards
+	if len(orderBy) > 0 {
 		var sortParts []string
-		for _, sortCol := range params.Sort {
-			sortString := "\"" + sortCol.Column.Name + "\""
-			if sortCol.Descending {
+		for _, sortCol := range orderBy {
+			var sortString string
+			if sortCol.Related != nil {
+				sortString = relatedValueSql(table, sortCol.Related, joinFks)
+			} else {
+				sortString = "t.\"" + sortCol.Column.Name + "\""
+			}
+			if sortCol.Descending != backwards {
 				sortString = sortString + " desc"
 			}
 			sortParts = append(sortParts, sortString)
@@ -563,15 +964,118 @@ func buildQuery(table *schema.Table, params *params.TableParams, peekFinder *dri
 		sql = sql + " order by " + strings.Join(sortParts, ", ")
 	}
 
-	if params.RowLimit > 0 || params.SkipRows > 0 {
+	if params.UsesCursor(table) {
+		sql = sql + fmt.Sprintf(" limit %d", params.RowLimit)
+	} else if params.RowLimit > 0 || params.SkipRows > 0 {
 		sql = sql + fmt.Sprintf(" limit %d offset %d", params.RowLimit, params.SkipRows)
 	}
 	return
 }
 
-func (model pgModel) getColumns(dbc *sql.DB, table *schema.Table) (cols []*schema.Column, err error) {
+// Joins the tables along their fks, each table is aliased by its position in the list
+func buildJoinQuery(join driver_interface.JoinQuery) (sql string, values []interface{}) {
+	var selectTables []string
+	for ix := range join.Tables {
+		selectTables = append(selectTables, fmt.Sprintf("t%d.*", ix))
+	}
+	sql = "select " + strings.Join(selectTables, ", ")
+	for ix, joined := range join.Tables {
+		if joined.Step == nil {
+			sql = sql + fmt.Sprintf("\nfrom \"%s\".\"%s\" t%d", joined.Table.Schema, joined.Table.Name, ix)
+			continue
+		}
+		var onPredicates []string
+		toColumns := joined.Step.ToColumns()
+		for colIx, fromCol := range joined.Step.FromColumns() {
+			toCol := toColumns[colIx]
+			switch {
+			case fromCol.Type.IsArray():
+				onPredicates = append(onPredicates, fmt.Sprintf("t%d.\"%s\" = any(t%d.\"%s\")", ix, toCol.Name, joined.JoinedTo, fromCol.Name))
+			case toCol.Type.IsArray():
+				onPredicates = append(onPredicates, fmt.Sprintf("t%d.\"%s\" = any(t%d.\"%s\")", joined.JoinedTo, fromCol.Name, ix, toCol.Name))
+			default:
+				onPredicates = append(onPredicates, fmt.Sprintf("t%d.\"%s\" = t%d.\"%s\"", joined.JoinedTo, fromCol.Name, ix, toCol.Name))
+			}
+		}
+		sql = sql + fmt.Sprintf("\njoin \"%s\".\"%s\" t%d on %s", joined.Table.Schema, joined.Table.Name, ix, strings.Join(onPredicates, " and "))
+	}
+
+	if len(join.Filters) > 0 {
+		var clauses []string
+		for _, filter := range join.Filters {
+			clauses = append(clauses, fmt.Sprintf("t%d.\"%s\" = $%d", filter.TableIndex, filter.Column.Name, len(values)+1))
+			values = append(values, filter.Value)
+		}
+		sql = sql + "\nwhere " + strings.Join(clauses, "\nand ")
+	}
+	return
+}
+
+// Number of rows referencing the row through the inbound fk, as a subquery
+func inboundCountSql(inboundFkIndex int, inboundFk *schema.Fk) string {
+	onPredicates := []string{}
+	for ix, sourceCol := range inboundFk.SourceColumns {
+		if sourceCol.Type.IsArray() {
+			onPredicates = append(onPredicates, fmt.Sprintf("t.\"%s\" = any(ifk%d.\"%s\")", inboundFk.DestinationColumns[ix].Name, inboundFkIndex, sourceCol.Name))
+		} else {
+			onPredicates = append(onPredicates, fmt.Sprintf("ifk%d.\"%s\" = t.\"%s\"", inboundFkIndex, sourceCol.Name, inboundFk.DestinationColumns[ix].Name))
+		}
+	}
+	onString := strings.Join(onPredicates, " and ")
+	return fmt.Sprintf("(select count(*) from \"%s\".\"%s\" ifk%d where %s)", inboundFk.SourceTable.Schema, inboundFk.SourceTable.Name, inboundFkIndex, onString)
+}
+
+// Expression for a peeked value (from the peek joins) or an inbound count, for sorting and filtering on
+func relatedValueSql(table *schema.Table, related *params.RelatedValue, joinFks []*schema.Fk) string {
+	if related.InboundFk != nil {
+		for inboundFkIndex, inboundFk := range table.InboundFks {
+			if inboundFk == related.InboundFk {
+				return inboundCountSql(inboundFkIndex, inboundFk)
+			}
+		}
+	}
+	return fmt.Sprintf("fk%d.\"%s\"", driver_interface.JoinIndex(joinFks, related.PeekFk), related.PeekCol)
+}
+
+// Rows after (or before) the cursor in the keyset order, e.g. for keyset (a, b) after (1, 2):
+// ((t."a" > $1) or (t."a" = $2 and t."b" > $3)) with values 1, 1, 2
+// firstIndex is the number of the first placeholder to use
+func keysetClause(keyset []params.SortCol, cursor *params.KeysetCursor, firstIndex int) (sql string, values []interface{}) {
+	var alternatives []string
+	index := firstIndex
+	for ix, sortCol := range keyset {
+		var parts []string
+		for _, equalCol := range keyset[:ix] {
+			parts = append(parts, "t.\""+equalCol.Column.Name+"\" = $"+strconv.Itoa(index))
+			index = index + 1
+		}
+		operator := ">"
+		if sortCol.Descending != cursor.Backwards {
+			operator = "<"
+		}
+		parts = append(parts, "t.\""+sortCol.Column.Name+"\" "+operator+" $"+strconv.Itoa(index))
+		index = index + 1
+		alternatives = append(alternatives, "("+strings.Join(parts, " and ")+")")
+		for _, value := range cursor.Values[:ix+1] {
+			values = append(values, value)
+		}
+	}
+	sql = "(" + strings.Join(alternatives, " or ") + ")"
+	return
+}
+
+func (model pgModel) getColumns(dbc *sql.DB, table *schema.Table, serverVersion int) (cols []*schema.Column, err error) {
+	// identity columns only exist from pg 10 onwards, generated columns from pg 12
+	identitySql := "''"
+	if serverVersion >= 100000 {
+		identitySql = "col.attidentity"
+	}
+	generatedSql := "''"
+	if serverVersion >= 120000 {
+		generatedSql = "col.attgenerated"
+	}
 	// todo: parameterise
-	sql := "select col.attname colname, col.attlen, typ.typname, col.attnotnull from pg_catalog.pg_attribute col inner join pg_catalog.pg_class tbl on col.attrelid = tbl.oid inner join pg_catalog.pg_namespace ns on ns.oid = tbl.relnamespace inner join pg_catalog.pg_type typ on typ.oid = col.atttypid where col.attnum > 0 and not col.attisdropped and ns.nspname = '" + table.Schema + "' and tbl.relname = '" + table.Name + "' order by col.attnum;"
+	sql := "select col.attname colname, col.attlen, typ.typname, col.attnotnull, coalesce(pg_get_expr(def.adbin, def.adrelid), '') default_expression, " + identitySql + " identity_kind, " + generatedSql + " generated_kind, col.atttypmod, typ.typtype, coalesce(elemtyp.typname, '') element_type, coalesce(elemtyp.typtype, '') element_typtype, coalesce(coll.collname, '') collation_name, array(select e.enumlabel::text from pg_catalog.pg_enum e where e.enumtypid = coalesce(elemtyp.oid, typ.oid) order by e.enumsortorder) enum_values, format_type(col.atttypid, col.atttypmod) full_type from pg_catalog.pg_attribute col inner join pg_catalog.pg_class tbl on col.attrelid = tbl.oid inner join pg_catalog.pg_namespace ns on ns.oid = tbl.relnamespace inner join pg_catalog.pg_type typ on typ.oid = col.atttypid left outer join pg_catalog.pg_type elemtyp on elemtyp.oid = typ.typelem and typ.typcategory = 'A' left outer join pg_catalog.pg_collation coll on coll.oid = col.attcollation and col.attcollation <> typ.typcollation left outer join pg_catalog.pg_attrdef def on def.adrelid = col.attrelid and def.adnum = col.attnum where col.attnum > 0 and not col.attisdropped and ns.nspname = '" + table.Schema + "' and tbl.relname = '" + table.Name + "' order by col.attnum;"
 
 	rows, err := dbc.Query(sql)
 	if err != nil {
@@ -582,17 +1086,91 @@ func (model pgModel) getColumns(dbc *sql.DB, table *schema.Table) (cols []*schem
 	cols = []*schema.Column{}
 	colIndex := 0
 	for rows.Next() {
-		var len int
-		var name, typeName string
+		var len, typeMod int
+		var name, typeName, typeKind, defaultExpression, identity, generated, elementTypeName, elementTypeKind, collation, fullType string
 		var notNull bool
-		rows.Scan(&name, &len, &typeName, &notNull)
-		thisCol := schema.Column{Position: colIndex, Name: name, Type: typeName, Nullable: !notNull}
+		var enumValues []string
+		rows.Scan(&name, &len, &typeName, &notNull, &defaultExpression, &identity, &generated, &typeMod, &typeKind, &elementTypeName, &elementTypeKind, &collation, pq.Array(&enumValues), &fullType)
+		var dataType schema.DataType
+		if elementTypeName != "" {
+			// the modifier of an array column applies to its elements, e.g. varchar(20)[]
+			elementType := getDataType(elementTypeName, typeMod)
+			setTypeKind(&elementType, elementTypeKind, enumValues)
+			dataType = schema.DataType{Name: typeName, ElementType: &elementType}
+		} else {
+			dataType = getDataType(typeName, typeMod)
+			setTypeKind(&dataType, typeKind, enumValues)
+		}
+		dataType.Collation = collation
+		// typname is what lib/pq reports and what values are decoded by, but it's shown the way psql shows it,
+		// e.g. bpchar is character(5) and timestamptz is timestamp(3) with time zone
+		dataType.FullName = fullType
+		thisCol := schema.Column{Position: colIndex, Name: name, Type: dataType, Nullable: !notNull}
+		if generated != "" { // 's' = stored, the expression lives in pg_attrdef alongside defaults
+			thisCol.IsGenerated = true
+			thisCol.GeneratedExpression = defaultExpression
+		} else {
+			thisCol.Default = defaultExpression
+		}
+		// identity columns have attidentity set, serial columns are just a default of nextval() on a sequence
+		thisCol.IsIdentity = identity != "" || strings.HasPrefix(defaultExpression, "nextval(")
 		cols = append(cols, &thisCol)
 		colIndex++
 	}
 	return
 }
 
+// Flags the structured types that need special decoding for display, based on pg_type.typtype
+// https://www.postgresql.org/docs/current/catalog-pg-type.html
+func setTypeKind(dataType *schema.DataType, typeKind string, enumValues []string) {
+	switch typeKind {
+	case "e":
+		dataType.EnumValues = enumValues
+	case "r":
+		dataType.IsRange = true
+	case "c":
+		dataType.IsComposite = true
+	}
+}
+
+// Unpacks pg's type modifier (atttypmod) into the sizes given in the column definition, -1 means there weren't any.
+// The encoding is internal to each type, see typmodout functions such as numerictypmodout in the pg source.
+func getDataType(typeName string, typeMod int) (dataType schema.DataType) {
+	dataType.Name = typeName
+	dataType.IsJson = typeName == "json" || typeName == "jsonb"
+	if typeName == "geometry" || typeName == "geography" { // PostGIS
+		dataType.Spatial = schema.PostgisHexEwkb
+	}
+	if typeMod < 0 {
+		return
+	}
+	const varHeaderSize = 4
+	switch typeName {
+	case "varchar", "bpchar":
+		length := typeMod - varHeaderSize
+		dataType.MaxLength = &length
+	case "bit", "varbit":
+		length := typeMod
+		dataType.MaxLength = &length
+	case "time", "timetz", "timestamp", "timestamptz":
+		// fractional digits of the seconds, the same as information_schema.columns.datetime_precision
+		precision := typeMod
+		dataType.Precision = &precision
+	case "numeric":
+		precision := ((typeMod - varHeaderSize) >> 16) & 0xffff
+		scale := (typeMod - varHeaderSize) & 0xffff
+		dataType.Precision = &precision
+		dataType.Scale = &scale
+	}
+	return
+}
+
+// e.g. 120001 for 12.1, see https://www.postgresql.org/docs/current/runtime-config-preset.html
+func getServerVersion(dbc *sql.DB) (version int, err error) {
+	err = dbc.QueryRow("select current_setting('server_version_num')::int").Scan(&version)
+	return
+}
+
 func (model pgModel) SetTableDescription(database string, table string, description string) (err error) {
 	return
 }
@@ -362,3 +362,159 @@ create table coz(
 );
 insert into coz(id, name, poke_id) values (1, 'andy', 11);
 insert into coz(id, name, poke_id) values (2, 'bob', 11);
+
+create table constraint_test(
+  id serial primary key,
+  size int default 10,
+  code varchar(10),
+  constraint "CK_size" check (size > 0),
+  constraint "UQ_code" unique (code)
+);
+insert into constraint_test(size, code) values (5, 'abc');
+
+create table type_test(
+  id int primary key,
+  amount decimal(10,2),
+  code varchar(10)
+);
+insert into type_test(id, amount, code) values (1, 12.34, 'abc');
+
+create table pg_type_test(
+  id int primary key,
+  initials char(3),
+  stamp timestamp(3) with time zone,
+  whole_seconds time(0)
+);
+insert into pg_type_test(id, initials, stamp, whole_seconds) values (1, 'abc', '2020-01-02 03:04:05.678+00', '03:04:05');
+
+create type mood as enum ('sad', 'ok', 'happy');
+create table enum_test(
+  id int primary key,
+  mood mood
+);
+insert into enum_test(id, mood) values (1, 'happy'), (2, 'sad');
+
+create extension if not exists hstore;
+create type address as (street varchar(50), city varchar(50));
+create table structured_test(
+  id int primary key,
+  tags text[],
+  moods mood[],
+  attributes hstore,
+  available int4range,
+  home address
+);
+insert into structured_test(id, tags, moods, attributes, available, home)
+  values (1, '{"red", "big cat", NULL}', '{happy,sad}', 'colour=>red, size=>NULL', '[1,10)', row('1 High St', 'London'));
+insert into structured_test(id, tags) values (2, '{blue}');
+
+create table json_test(
+  id int primary key,
+  payload jsonb
+);
+insert into json_test(id, payload) values (1, '{"status": "shipped", "customer": {"name": "bob"}, "items": [{"sku": "a1"}]}');
+insert into json_test(id, payload) values (2, '{"status": "pending", "customer": {"name": "fred"}, "items": []}');
+
+create table binary_test(
+  id int primary key,
+  content bytea
+);
+insert into binary_test(id, content) values (1, decode('89504E470D0A1A0A0000000D', 'hex'));
+insert into binary_test(id, content) values (2, decode('68656C6C6F', 'hex'));
+insert into binary_test(id, content) values (3, null);
+
+-- no declared fks, for testing inferring them from column names
+create table infer_customers(
+  id int primary key,
+  name varchar(50)
+);
+insert into infer_customers(id, name) values (1, 'alice');
+insert into infer_customers(id, name) values (2, 'bob');
+create table infer_orders(
+  id int primary key,
+  infer_customer_id int
+);
+insert into infer_orders(id, infer_customer_id) values (10, 1);
+insert into infer_orders(id, infer_customer_id) values (11, 2);
+insert into infer_orders(id, infer_customer_id) values (12, 1);
+-- name matches but the values don't, so shouldn't survive validation
+create table infer_order_notes(
+  id int primary key,
+  infer_order_id int
+);
+insert into infer_order_notes(id, infer_order_id) values (1, 98);
+insert into infer_order_notes(id, infer_order_id) values (2, 99);
+
+-- no declared fk, for testing relationships from the virtual fks config
+create table virtual_parent(
+  id int primary key,
+  name varchar(50)
+);
+insert into virtual_parent(id, name) values (1, 'first');
+insert into virtual_parent(id, name) values (2, 'second');
+create table virtual_child(
+  id int primary key,
+  parent_ref int
+);
+insert into virtual_child(id, parent_ref) values (1, 1);
+insert into virtual_child(id, parent_ref) values (2, 2);
+insert into virtual_child(id, parent_ref) values (3, 1);
+-- orphans, parent 99 doesn't exist
+insert into virtual_child(id, parent_ref) values (4, 99);
+insert into virtual_child(id, parent_ref) values (5, 99);
+insert into virtual_child(id, parent_ref) values (6, null);
+-- pg only, an array of references to virtual_parent, orphaned if any of its values are missing
+create table virtual_array_child(
+  id int primary key,
+  parent_refs int[]
+);
+insert into virtual_array_child(id, parent_refs) values (1, '{1,2}');
+insert into virtual_array_child(id, parent_refs) values (2, '{1,99}');
+insert into virtual_array_child(id, parent_refs) values (3, '{98,99}');
+insert into virtual_array_child(id, parent_refs) values (4, null);
+insert into virtual_array_child(id, parent_refs) values (5, '{}');
+
+-- pg only, an fk added without checking the existing rows
+create table not_valid_parent(
+  id int primary key
+);
+create table not_valid_child(
+  id int primary key,
+  nv_parent int
+);
+insert into not_valid_child(id, nv_parent) values (1, 99);
+alter table not_valid_child add constraint fk_not_valid_child_parent foreign key (nv_parent) references not_valid_parent(id) not valid;
+
+create table analysis_stats_test(
+  id int primary key,
+  amount int,
+  label varchar(20),
+  created date
+);
+insert into analysis_stats_test(id, amount, label, created) values (1, 10, 'a', '2020-01-15');
+insert into analysis_stats_test(id, amount, label, created) values (2, 20, 'bb', '2020-01-20');
+insert into analysis_stats_test(id, amount, label, created) values (3, 30, 'ccc', '2020-03-01');
+insert into analysis_stats_test(id, amount, label, created) values (4, null, 'bb', null);
+
+create table group_owner(
+  id int primary key,
+  name varchar(50)
+);
+insert into group_owner(id, name) values (1, 'alice');
+insert into group_owner(id, name) values (2, 'bob');
+create table group_test(
+  id int primary key,
+  status varchar(10),
+  owner_id int,
+  foreign key (owner_id) references group_owner(id)
+);
+insert into group_test(id, status, owner_id) values (1, 'open', 1);
+insert into group_test(id, status, owner_id) values (2, 'open', 1);
+insert into group_test(id, status, owner_id) values (3, 'closed', 1);
+insert into group_test(id, status, owner_id) values (4, 'open', 2);
+insert into group_test(id, status, owner_id) values (5, 'closed', null);
+create table search_test(
+  id int primary key,
+  label varchar(50)
+);
+insert into search_test(id, label) values (1, 'quokka');
@@ -0,0 +1,120 @@
+package reader
+
+// Column analysis runs a handful of group-by queries per column which can take minutes on wide or large tables,
+// so it is run in the background one column at a time and the results are kept until re-run.
+
+import (
+	"github.com/timabell/schema-explorer/driver_interface"
+	"github.com/timabell/schema-explorer/schema"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+type AnalysisStatus int
+
+const (
+	AnalysisNotStarted AnalysisStatus = iota
+	AnalysisQueued
+	AnalysisRunning
+	AnalysisDone
+	AnalysisFailed
+)
+
+func (status AnalysisStatus) String() string {
+	switch status {
+	case AnalysisQueued:
+		return "queued"
+	case AnalysisRunning:
+		return "running"
+	case AnalysisDone:
+		return "done"
+	case AnalysisFailed:
+		return "failed"
+	}
+	return "not started"
+}
+
+// True once there is a result or an error to show
+func (status AnalysisStatus) IsFinished() bool {
+	return status == AnalysisDone || status == AnalysisFailed
+}
+
+type AnalysisJob struct {
+	Column   *schema.Column
+	Status   AnalysisStatus
+	Queued   time.Time
+	Finished time.Time
+	Result   schema.ColumnAnalysis
+	Error    error
+}
+
+// keyed by analysisKey(), guarded by analysisLock
+var analysisJobs = map[string]*AnalysisJob{}
+var analysisLock sync.Mutex
+
+// Each sample's results are kept separately so that changing the sample doesn't show the results of the last one
+func analysisKey(databaseName string, table *schema.Table, col *schema.Column, sample schema.AnalysisSample) string {
+	return fmt.Sprintf("%s/%s/%s/%d/%d", databaseName, table, col.Name, sample.FirstRows, sample.Percent)
+}
+
+// Queues background analysis of the given columns. Columns with a cached result are skipped unless rerun is set,
+// columns that are already queued or running are always skipped.
+func StartAnalysis(dbReader driver_interface.DbReader, databaseName string, table *schema.Table, columns []*schema.Column, rerun bool, sample schema.AnalysisSample) {
+	analysisLock.Lock()
+	var queued []*AnalysisJob
+	for _, col := range columns {
+		existing := analysisJobs[analysisKey(databaseName, table, col, sample)]
+		if existing != nil && (!rerun || !existing.Status.IsFinished()) {
+			continue
+		}
+		job := &AnalysisJob{Column: col, Status: AnalysisQueued, Queued: time.Now()}
+		analysisJobs[analysisKey(databaseName, table, col, sample)] = job
+		queued = append(queued, job)
+	}
+	analysisLock.Unlock()
+	if len(queued) > 0 {
+		go runAnalysisJobs(dbReader, databaseName, table, queued, sample)
+	}
+}
+
+// One column at a time so as not to swamp the database
+func runAnalysisJobs(dbReader driver_interface.DbReader, databaseName string, table *schema.Table, jobs []*AnalysisJob, sample schema.AnalysisSample) {
+	for _, job := range jobs {
+		analysisLock.Lock()
+		job.Status = AnalysisRunning
+		analysisLock.Unlock()
+
+		result, err := dbReader.GetColumnAnalysis(databaseName, table, job.Column, sample)
+
+		analysisLock.Lock()
+		job.Finished = time.Now()
+		job.Result = result
+		job.Error = err
+		if err != nil {
+			job.Status = AnalysisFailed
+			log.Printf("Analysis of %s.%s failed: %s", table, job.Column, err)
+		} else {
+			job.Status = AnalysisDone
+		}
+		analysisLock.Unlock()
+	}
+}
+
+// Snapshot of the analysis of each column of the table with the sample, in column order
+func GetAnalysisJobs(databaseName string, table *schema.Table, sample schema.AnalysisSample) (jobs []AnalysisJob) {
+	analysisLock.Lock()
+	defer analysisLock.Unlock()
+	for _, col := range table.Columns {
+		job := AnalysisJob{}
+		if existing := analysisJobs[analysisKey(databaseName, table, col, sample)]; existing != nil {
+			job = *existing
+		}
+		// the schema may have been re-read since the job was queued
+		job.Column = col
+		job.Result.Column = col
+		jobs = append(jobs, job)
+	}
+	return
+}
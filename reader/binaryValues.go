@@ -0,0 +1,56 @@
+package reader
+
+// Recognition of common file formats stored in binary columns from their leading "magic" bytes.
+// https://en.wikipedia.org/wiki/List_of_file_signatures
+
+import (
+	"bytes"
+	"encoding/hex"
+)
+
+type FileType struct {
+	Name      string // short label for display, e.g. "PNG"
+	MimeType  string
+	Extension string
+	IsImage   bool // browsers can show it in an img tag
+}
+
+var fileSignatures = []struct {
+	signature []byte
+	fileType  FileType
+}{
+	{[]byte{0x89, 'P', 'N', 'G', 0x0d, 0x0a, 0x1a, 0x0a}, FileType{Name: "PNG", MimeType: "image/png", Extension: "png", IsImage: true}},
+	{[]byte{0xff, 0xd8, 0xff}, FileType{Name: "JPEG", MimeType: "image/jpeg", Extension: "jpg", IsImage: true}},
+	{[]byte("%PDF-"), FileType{Name: "PDF", MimeType: "application/pdf", Extension: "pdf"}},
+	{[]byte{0x1f, 0x8b}, FileType{Name: "gzip", MimeType: "application/gzip", Extension: "gz"}},
+}
+
+// Returns nil if the data doesn't start with a known signature
+func DetectFileType(data []byte) *FileType {
+	for _, known := range fileSignatures {
+		if bytes.HasPrefix(data, known.signature) {
+			fileType := known.fileType
+			return &fileType
+		}
+	}
+	return nil
+}
+
+// Lower case hex of the first maxBytes of data, truncated is true if there was more
+func HexPreview(data []byte, maxBytes int) (preview string, truncated bool) {
+	if len(data) > maxBytes {
+		return hex.EncodeToString(data[:maxBytes]), true
+	}
+	return hex.EncodeToString(data), false
+}
+
+// Drivers give us []byte for binary columns, but sqlite will hand back a string if text was stored in a blob column
+func BinaryValue(colData interface{}) (data []byte, ok bool) {
+	switch value := colData.(type) {
+	case []byte:
+		return value, true
+	case string:
+		return []byte(value), true
+	}
+	return nil, false
+}
@@ -55,6 +55,8 @@ func InitializeDatabase(databaseName string) (err error) {
 		return
 	}
 	Databases[databaseName].Name = databaseName
+	setupVirtualFks(Databases[databaseName])
+	setupInferredFks(dbReader, Databases[databaseName])
 	setupPeekList(Databases[databaseName])
 	return
 }
@@ -112,6 +114,40 @@ func GetDbReader() driver_interface.DbReader {
 }
 
 func GetRows(reader driver_interface.DbReader, databaseName string, table *schema.Table, params *params.TableParams) (rowsData []RowData, peekFinder *driver_interface.PeekLookup, err error) {
+	peekFinder, columnCount := buildPeekFinder(table, params)
+
+	rows, err := reader.GetSqlRows(databaseName, table, params, peekFinder)
+	if rows == nil {
+		panic("GetSqlRows() returned nil")
+	}
+	defer rows.Close()
+	if len(table.Columns) == 0 {
+		panic("No columns found when reading table data table")
+	}
+	rowsData, err = getAllData(columnCount+peekFinder.PeekColumnCount, rows)
+	if err != nil {
+		return nil, nil, err
+	}
+	if params.UsesCursor(table) && params.Cursor.Backwards {
+		// previous pages are read in reverse order to find the rows nearest the cursor
+		for i, j := 0, len(rowsData)-1; i < j; i, j = i+1, j-1 {
+			rowsData[i], rowsData[j] = rowsData[j], rowsData[i]
+		}
+	}
+	return
+}
+
+// How the database would run the statement that GetRows runs, and that statement as shown to users
+func GetQueryPlan(reader driver_interface.DbReader, databaseName string, table *schema.Table, params *params.TableParams) (plan *driver_interface.PlanNode, sqlText string, err error) {
+	peekFinder, _ := buildPeekFinder(table, params)
+	sqlText = reader.GetSqlText(databaseName, table, params, peekFinder)
+	plan, err = reader.GetQueryPlan(databaseName, table, params, peekFinder)
+	return
+}
+
+// Which columns are selected and where the peek columns are in the results.
+// columnCount is the number of the table's own columns selected.
+func buildPeekFinder(table *schema.Table, params *params.TableParams) (peekFinder *driver_interface.PeekLookup, columnCount int) {
 	// load up all the fks that we have peek info for
 	peekFinder = &driver_interface.PeekLookup{}
 	inboundPeekCount := 0
@@ -119,29 +155,62 @@ func GetRows(reader driver_interface.DbReader, databaseName string, table *schem
 		if len(fk.DestinationTable.PeekColumns) == 0 {
 			continue
 		}
+		if hasArrayColumn(fk.SourceColumns) {
+			continue // can't join an array to a single row to peek at it
+		}
 		peekFinder.Fks = append(peekFinder.Fks, fk)
 		inboundPeekCount += len(fk.DestinationTable.PeekColumns)
 	}
-	peekFinder.OutboundPeekStartIndex = len(table.Columns)
+	peekFinder.Columns = params.SelectColumns(table)
+	columnCount = len(table.Columns)
+	if len(peekFinder.Columns) > 0 {
+		columnCount = len(peekFinder.Columns)
+	}
+	peekFinder.OutboundPeekStartIndex = columnCount
 	peekFinder.InboundPeekStartIndex = peekFinder.OutboundPeekStartIndex + inboundPeekCount
 	peekFinder.PeekColumnCount = inboundPeekCount + len(table.InboundFks)
 	peekFinder.Table = table
+	return
+}
 
-	rows, err := reader.GetSqlRows(databaseName, table, params, peekFinder)
-	if rows == nil {
-		panic("GetSqlRows() returned nil")
+// Reads the value of a single cell, the row is identified by filters on every primary key column.
+func GetCellValue(reader driver_interface.DbReader, databaseName string, table *schema.Table, column *schema.Column, rowParams *params.TableParams) (value interface{}, err error) {
+	if table.Pk == nil {
+		err = errors.New(fmt.Sprintf("table %s has no primary key to identify the row by", table))
+		return
 	}
-	defer rows.Close()
-	if len(table.Columns) == 0 {
-		panic("No columns found when reading table data table")
+	if len(rowParams.Filter) != len(table.Pk.Columns) {
+		err = errors.New(fmt.Sprintf("expected a single value for each of the primary key columns (%s) of %s", table.Pk.Columns, table))
+		return
 	}
-	rowsData, err = getAllData(len(table.Columns)+peekFinder.PeekColumnCount, rows)
+	for _, filter := range rowParams.Filter {
+		if filter.Field == nil || !filter.Field.IsInPrimaryKey || len(filter.Values) != 1 || filter.ArrayContains || filter.JsonPath != nil {
+			err = errors.New(fmt.Sprintf("expected a single value for each of the primary key columns (%s) of %s", table.Pk.Columns, table))
+			return
+		}
+	}
+	rowParams.RowLimit = 2 // one more than we need so that we can tell if the key matched more than one row
+	rowsData, peekFinder, err := GetRows(reader, databaseName, table, rowParams)
 	if err != nil {
-		return nil, nil, err
+		return
 	}
+	if len(rowsData) != 1 {
+		err = errors.New(fmt.Sprintf("expected one row of %s, found %d", table, len(rowsData)))
+		return
+	}
+	value = rowsData[0][peekFinder.ColumnIndex(column)]
 	return
 }
 
+func hasArrayColumn(columns schema.ColumnList) bool {
+	for _, col := range columns {
+		if col.Type.IsArray() {
+			return true
+		}
+	}
+	return false
+}
+
 func getAllData(colCount int, rows *sql.Rows) (rowsData []RowData, err error) {
 	for rows.Next() {
 		row, err := getRow(colCount, rows)
@@ -168,18 +237,36 @@ func getRow(colCount int, rows *sql.Rows) (rowsData RowData, err error) {
 	return singleRow, err
 }
 
-func DbValueToString(colData interface{}, dataType string) *string {
+func DbValueToString(colData interface{}, dataType schema.DataType) *string {
 	// todo: check type of colData matches type of dataTyoe - sqlite will let you insert anything into anything
 	var stringValue string
-	dataType = strings.ToLower(dataType)
+	typeName := strings.ToLower(dataType.Name)
 	uuidLen := 16
 	// todo: optimise order for speed, also consider possible fuzzy clashes and which one would win
 	switch {
 	// === // NULLs ...
 	case colData == nil:
 		return nil
+	// === // structured type info ...
+	case dataType.IsArray(): // pg - driver gives us the text representation, e.g. {1,2,3}
+		stringValue = fmt.Sprintf("%s", colData)
+	case len(dataType.EnumValues) > 0: // pg enum / mysql enum & set, always text
+		fallthrough
+	case dataType.IsRange: // pg - e.g. [1,10)
+		fallthrough
+	case dataType.IsComposite: // pg - e.g. (1,"a b")
+		fallthrough
+	case typeName == "hstore": // pg extension - e.g. "a"=>"1", "b"=>NULL
+		stringValue = fmt.Sprintf("%s", colData)
+	case dataType.IsSpatial(): // binary from the driver, decoded to well-known text e.g. POINT (1 2)
+		if geometry, err := DecodeSpatialValue(colData, dataType); err == nil {
+			stringValue = geometry.Wkt()
+		} else {
+			log.Printf("failed to decode %s value: %s", dataType.Name, err)
+			stringValue = fmt.Sprintf("%v", colData)
+		}
 	// === // exact matches only ...
-	case dataType == "uniqueidentifier": // mssql guid
+	case typeName == "uniqueidentifier": // mssql guid
 		bytes := colData.([]byte)
 		if len(bytes) != uuidLen {
 			panic(fmt.Sprintf("Unexpected byte-count for uniqueidentifier, expected %d, got %d. Value: %+v", uuidLen, len(bytes), colData))
@@ -187,46 +274,50 @@ func DbValueToString(colData interface{}, dataType string) *string {
 		stringValue = fmt.Sprintf("%x%x%x%x-%x%x-%x%x-%x%x-%x%x%x%x%x%x",
 			bytes[3], bytes[2], bytes[1], bytes[0], bytes[5], bytes[4], bytes[7], bytes[6], bytes[8], bytes[9], bytes[10], bytes[11], bytes[12], bytes[13], bytes[14], bytes[15])
 	// === //
-	case dataType == "numeric": // sqlite - best type for number. needs casting for pg
-		stringValue = fmt.Sprintf("%v", colData.(float64))
-	case dataType == "varbinary":
+	case typeName == "numeric": // sqlite - best type for number. pg/mysql give us the digits as text
 		fallthrough
-	case dataType == "blob":
+	case typeName == "decimal":
+		if bytes, ok := colData.([]byte); ok {
+			stringValue = string(bytes)
+		} else {
+			stringValue = fmt.Sprintf("%v", colData)
+		}
+	case typeName == "varbinary":
+		fallthrough
+	case typeName == "blob":
 		fallthrough
 	// === //
-	case dataType == "boolean":
+	case typeName == "boolean":
 		fallthrough
 	// === //
-	case dataType == "date":
+	case typeName == "date":
 		fallthrough
-	case dataType == "datetime":
+	case typeName == "datetime":
 		fallthrough
 	// === // more expensive fuzzy type name matches from here ...
-	case dataType == "money":
-		fallthrough
-	case dataType == "real":
+	case typeName == "money":
 		fallthrough
-	case dataType == "float":
+	case typeName == "real":
 		fallthrough
-	case strings.HasPrefix(dataType, "double"):
+	case typeName == "float":
 		fallthrough
-	case strings.HasPrefix(dataType, "decimal"): // todo: don't allow "decimal(10,5)"
+	case strings.HasPrefix(typeName, "double"):
 		fallthrough
-	case strings.Contains(dataType, "int"): // todo: expensive, optimise for supported values
+	case strings.Contains(typeName, "int"): // todo: expensive, optimise for supported values
 		stringValue = fmt.Sprintf("%v", colData)
 	// === //
-	case dataType == "text": // sqlite
+	case typeName == "text": // sqlite
 		fallthrough
-	case dataType == "jsonb":
+	case typeName == "jsonb":
 		fallthrough
-	case dataType == "json":
+	case typeName == "json":
 		fallthrough
-	case dataType == "clob": // sqlite - char large object
+	case typeName == "clob": // sqlite - char large object
 		fallthrough
-	case strings.Contains(dataType, "char"): // See test sql files for things this should cover. // todo: expensive, optimise for supported values
+	case strings.Contains(typeName, "char"): // See test sql files for things this should cover. // todo: expensive, optimise for supported values
 		stringValue = fmt.Sprintf("%s", colData)
 	// === //
-	case strings.Contains(dataType, "text"): // mssql // todo: expensive, optimise for supported values
+	case strings.Contains(typeName, "text"): // mssql // todo: expensive, optimise for supported values
 		// https://stackoverflow.com/a/18615786/10245
 		bytes := colData.([]uint8)
 		stringValue = fmt.Sprintf("%s", bytes)
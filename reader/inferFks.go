@@ -0,0 +1,244 @@
+package reader
+
+// Guessing relationships that aren't declared in the database from column naming conventions,
+// e.g. orders.customer_id => customers.id, so that databases without fk constraints can still be navigated.
+
+import (
+	"github.com/timabell/schema-explorer/driver_interface"
+	"github.com/timabell/schema-explorer/options"
+	"github.com/timabell/schema-explorer/params"
+	"github.com/timabell/schema-explorer/resources"
+	"github.com/timabell/schema-explorer/schema"
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// A naming rule such as "^(.+)_id$ => ${1}s.id"
+type FkInferenceRule struct {
+	ColumnPattern *regexp.Regexp // matched against the lower-cased column name
+	Target        string         // table.column, expanded with the groups captured by ColumnPattern
+}
+
+const (
+	inferredFkSampleRows   = 100 // rows read from the source table when validating
+	inferredFkSampleValues = 20  // distinct values looked up in the destination table
+	inferredFkMinOverlap   = 0.5 // fraction of the sampled values that must exist, legacy data is rarely perfect
+)
+
+func setupInferredFks(dbReader driver_interface.DbReader, database *schema.Database) {
+	if options.Options == nil {
+		panic("options is nil")
+	}
+	if !options.Options.InferFks {
+		return
+	}
+	var rulesFilename string
+	if options.Options.InferFksConfigPath == "" {
+		rulesFilename = path.Join(resources.BasePath, "config/infer-fks-config.txt")
+	} else {
+		rulesFilename = options.Options.InferFksConfigPath
+	}
+	log.Printf("Loading fk inference rules from %s ...", rulesFilename)
+	rules, err := LoadFkInferenceRules(rulesFilename)
+	if err != nil {
+		log.Printf("Failed to load %s, not inferring fks, check infer-fks-config-path configuration. %s", rulesFilename, err)
+		return
+	}
+	_, err = InferFks(dbReader, database, rules, options.Options.ValidateInferredFks)
+	if err != nil {
+		log.Printf("Error inferring fks: %s", err)
+	}
+}
+
+func LoadFkInferenceRules(filename string) (rules []FkInferenceRule, err error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return ParseFkInferenceRules(lines)
+}
+
+// Skips blank lines and # comments
+func ParseFkInferenceRules(lines []string) (rules []FkInferenceRule, err error) {
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, "=>", 2)
+		if len(parts) != 2 || !strings.Contains(parts[1], ".") {
+			return nil, errors.New(fmt.Sprintf("fk inference rule '%s' should be in the form: column-regex => table.column", line))
+		}
+		pattern, err := regexp.Compile(strings.TrimSpace(parts[0]))
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, FkInferenceRule{ColumnPattern: pattern, Target: strings.TrimSpace(parts[1])})
+	}
+	return
+}
+
+// Adds an inferred fk for each column without a declared fk that a rule maps to a unique column of another table.
+// If validate is set then candidates are only kept if enough of a sample of their values exist in the destination.
+func InferFks(dbReader driver_interface.DbReader, database *schema.Database, rules []FkInferenceRule, validate bool) (inferred []*schema.Fk, err error) {
+	// collect candidates before adding any so that rules don't see earlier inferences
+	var candidates []*schema.Fk
+	for _, table := range database.Tables {
+		for _, col := range table.Columns {
+			if len(col.Fks) > 0 {
+				continue
+			}
+			if fk := findInferredFk(database, table, col, rules); fk != nil {
+				candidates = append(candidates, fk)
+			}
+		}
+	}
+	for _, fk := range candidates {
+		if validate {
+			var overlaps bool
+			overlaps, err = hasValueOverlap(dbReader, database.Name, fk)
+			if err != nil {
+				return
+			}
+			if !overlaps {
+				log.Printf(" - fk not inferred, too few matching values: %s", fk)
+				continue
+			}
+		}
+		AddFk(database, fk)
+		inferred = append(inferred, fk)
+		log.Printf(" - inferred fk %s", fk)
+	}
+	return
+}
+
+// Links an fk into the tables and columns it joins, as the schema readers do for declared fks
+func AddFk(database *schema.Database, fk *schema.Fk) {
+	database.Fks = append(database.Fks, fk)
+	fk.SourceTable.Fks = append(fk.SourceTable.Fks, fk)
+	for _, col := range fk.SourceColumns {
+		col.Fks = append(col.Fks, fk)
+	}
+	fk.DestinationTable.InboundFks = append(fk.DestinationTable.InboundFks, fk)
+	for _, col := range fk.DestinationColumns {
+		col.InboundFks = append(col.InboundFks, fk)
+	}
+}
+
+// First rule that points at an existing unique column, nil if none do
+func findInferredFk(database *schema.Database, table *schema.Table, col *schema.Column, rules []FkInferenceRule) *schema.Fk {
+	columnName := strings.ToLower(col.Name)
+	for _, rule := range rules {
+		match := rule.ColumnPattern.FindStringSubmatchIndex(columnName)
+		if match == nil {
+			continue
+		}
+		target := string(rule.ColumnPattern.ExpandString(nil, rule.Target, columnName, match))
+		dotIndex := strings.LastIndex(target, ".")
+		destinationTable := findTableIgnoringCase(database, table.Schema, target[:dotIndex])
+		if destinationTable == nil {
+			continue
+		}
+		destinationCol := findColumnIgnoringCase(destinationTable, target[dotIndex+1:])
+		if destinationCol == nil || destinationCol == col || !isUniqueColumn(destinationTable, destinationCol) {
+			continue
+		}
+		return &schema.Fk{
+			Name:               fmt.Sprintf("inferred_%s_%s", table.Name, col.Name),
+			SourceTable:        table,
+			SourceColumns:      schema.ColumnList{col},
+			DestinationTable:   destinationTable,
+			DestinationColumns: schema.ColumnList{destinationCol},
+			Origin:             schema.InferredFk,
+		}
+	}
+	return nil
+}
+
+func findTableIgnoringCase(database *schema.Database, schemaName string, tableName string) *schema.Table {
+	for _, table := range database.Tables {
+		if (!database.Supports.Schema || table.Schema == schemaName) && strings.EqualFold(table.Name, tableName) {
+			return table
+		}
+	}
+	return nil
+}
+
+func findColumnIgnoringCase(table *schema.Table, columnName string) *schema.Column {
+	for _, col := range table.Columns {
+		if strings.EqualFold(col.Name, columnName) {
+			return col
+		}
+	}
+	return nil
+}
+
+// True if the column on its own is the primary key or has a unique index or constraint
+func isUniqueColumn(table *schema.Table, col *schema.Column) bool {
+	if table.Pk != nil && len(table.Pk.Columns) == 1 && table.Pk.Columns[0] == col {
+		return true
+	}
+	for _, index := range table.Indexes {
+		if index.IsUnique && len(index.Columns) == 1 && index.Columns[0] == col {
+			return true
+		}
+	}
+	for _, constraint := range table.UniqueConstraints {
+		if len(constraint.Columns) == 1 && constraint.Columns[0] == col {
+			return true
+		}
+	}
+	return false
+}
+
+// Looks up a sample of the source column's values in the destination table.
+// An empty source table can't disprove the relationship so counts as overlapping.
+func hasValueOverlap(dbReader driver_interface.DbReader, databaseName string, fk *schema.Fk) (overlaps bool, err error) {
+	sourceCol := fk.SourceColumns[0]
+	destinationCol := fk.DestinationColumns[0]
+	rowsData, peekFinder, err := GetRows(dbReader, databaseName, fk.SourceTable, &params.TableParams{RowLimit: inferredFkSampleRows})
+	if err != nil {
+		return
+	}
+	var values []string
+	seen := map[string]bool{}
+	for _, row := range rowsData {
+		value := DbValueToString(row[peekFinder.ColumnIndex(sourceCol)], sourceCol.Type)
+		if value == nil || seen[*value] {
+			continue
+		}
+		seen[*value] = true
+		values = append(values, *value)
+		if len(values) == inferredFkSampleValues {
+			break
+		}
+	}
+	if len(values) == 0 {
+		return true, nil
+	}
+	found := 0
+	for _, value := range values {
+		lookupParams := &params.TableParams{Filter: params.FieldFilterList{{Field: destinationCol, Values: []string{value}}}}
+		var count int
+		count, err = dbReader.GetRowCount(databaseName, fk.DestinationTable, lookupParams)
+		if err != nil {
+			return
+		}
+		if count > 0 {
+			found++
+		}
+	}
+	return float64(found)/float64(len(values)) >= inferredFkMinOverlap, nil
+}
@@ -0,0 +1,89 @@
+package reader
+
+// Checking for orphans runs a query per relationship, which for a whole database can take longer than a request
+// should, so like column analysis the checks are run in the background one at a time and the results kept until re-run.
+
+import (
+	"github.com/timabell/schema-explorer/driver_interface"
+	"github.com/timabell/schema-explorer/schema"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+type OrphanJob struct {
+	Fk       *schema.Fk
+	Status   AnalysisStatus // same lifecycle as a column analysis
+	Queued   time.Time
+	Finished time.Time
+	Result   schema.FkOrphans
+	Error    error
+}
+
+// keyed by orphanKey(), guarded by orphanLock
+var orphanJobs = map[string]*OrphanJob{}
+var orphanLock sync.Mutex
+
+func orphanKey(databaseName string, fk *schema.Fk) string {
+	return fmt.Sprintf("%s/%s", databaseName, fk)
+}
+
+// Queues background orphan checks of the given fks. Fks with a cached result are skipped unless rerun is set,
+// fks that are already queued or running are always skipped.
+func StartOrphanChecks(dbReader driver_interface.DbReader, databaseName string, fks []*schema.Fk, rerun bool) {
+	orphanLock.Lock()
+	var queued []*OrphanJob
+	for _, fk := range fks {
+		existing := orphanJobs[orphanKey(databaseName, fk)]
+		if existing != nil && (!rerun || !existing.Status.IsFinished()) {
+			continue
+		}
+		job := &OrphanJob{Fk: fk, Status: AnalysisQueued, Queued: time.Now()}
+		orphanJobs[orphanKey(databaseName, fk)] = job
+		queued = append(queued, job)
+	}
+	orphanLock.Unlock()
+	if len(queued) > 0 {
+		go runOrphanJobs(dbReader, databaseName, queued)
+	}
+}
+
+// One fk at a time so as not to swamp the database
+func runOrphanJobs(dbReader driver_interface.DbReader, databaseName string, jobs []*OrphanJob) {
+	for _, job := range jobs {
+		orphanLock.Lock()
+		job.Status = AnalysisRunning
+		orphanLock.Unlock()
+
+		result, err := dbReader.GetOrphans(databaseName, job.Fk)
+
+		orphanLock.Lock()
+		job.Finished = time.Now()
+		job.Result = result
+		job.Error = err
+		if err != nil {
+			job.Status = AnalysisFailed
+			log.Printf("Orphan check of %s failed: %s", job.Fk, err)
+		} else {
+			job.Status = AnalysisDone
+		}
+		orphanLock.Unlock()
+	}
+}
+
+// Snapshot of the orphan check of each of the fks, in the order given
+func GetOrphanJobs(databaseName string, fks []*schema.Fk) (jobs []OrphanJob) {
+	orphanLock.Lock()
+	defer orphanLock.Unlock()
+	for _, fk := range fks {
+		job := OrphanJob{}
+		if existing := orphanJobs[orphanKey(databaseName, fk)]; existing != nil {
+			job = *existing
+		}
+		// the schema may have been re-read since the job was queued
+		job.Fk = fk
+		jobs = append(jobs, job)
+	}
+	return
+}
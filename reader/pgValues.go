@@ -0,0 +1,205 @@
+package reader
+
+// Decoding of the text representations postgres uses for its structured types.
+// lib/pq hands these back as raw bytes so it's up to us to make sense of them.
+// https://www.postgresql.org/docs/current/arrays.html#ARRAYS-IO
+// https://www.postgresql.org/docs/current/rowtypes.html#ROWTYPES-IO-SYNTAX
+// https://www.postgresql.org/docs/current/rangetypes.html#RANGETYPES-IO
+// https://www.postgresql.org/docs/current/hstore.html
+
+import (
+	"strings"
+)
+
+type HstorePair struct {
+	Key   string
+	Value *string // nil for NULL
+}
+
+type PgRange struct {
+	IsEmpty        bool
+	Lower          *string // nil for unbounded
+	Upper          *string // nil for unbounded
+	LowerInclusive bool
+	UpperInclusive bool
+}
+
+// an item from a delimited list, quoted items can't be NULL
+type pgListItem struct {
+	value  string
+	quoted bool
+}
+
+// Top level elements of an array such as {1,"a b",NULL}, nil for NULL elements.
+// Elements of multi-dimensional arrays are returned as the text of the inner array, e.g. {1,2}
+func ParsePgArray(text string) (elements []*string) {
+	// strip optional dimension decoration e.g. [0:1]={1,2}
+	if strings.HasPrefix(text, "[") {
+		if equalsIndex := strings.Index(text, "="); equalsIndex >= 0 {
+			text = text[equalsIndex+1:]
+		}
+	}
+	text = strings.TrimSpace(text)
+	if !strings.HasPrefix(text, "{") || !strings.HasSuffix(text, "}") {
+		return nil
+	}
+	inner := text[1 : len(text)-1]
+	if strings.TrimSpace(inner) == "" {
+		return []*string{}
+	}
+	for _, item := range splitPgList(inner, ',') {
+		if !item.quoted && strings.EqualFold(item.value, "NULL") {
+			elements = append(elements, nil)
+			continue
+		}
+		value := item.value
+		elements = append(elements, &value)
+	}
+	return
+}
+
+// Fields of a composite value such as (1,"a b",), nil for NULL fields which are left empty by pg
+func ParsePgComposite(text string) (fields []*string) {
+	text = strings.TrimSpace(text)
+	if !strings.HasPrefix(text, "(") || !strings.HasSuffix(text, ")") {
+		return nil
+	}
+	for _, item := range splitPgList(text[1:len(text)-1], ',') {
+		if !item.quoted && item.value == "" {
+			fields = append(fields, nil)
+			continue
+		}
+		value := item.value
+		fields = append(fields, &value)
+	}
+	return
+}
+
+// Pairs of an hstore value such as "a"=>"1", "b"=>NULL
+func ParseHstore(text string) (pairs []HstorePair) {
+	// keys and values are quoted separately so this needs its own tokenizer rather than splitPgList
+	var tokens []pgListItem
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case c == '"':
+			value, end := readQuoted(text, i)
+			tokens = append(tokens, pgListItem{value: value, quoted: true})
+			i = end
+		case c == ',' || c == ' ' || c == '=' || c == '>':
+			continue
+		default:
+			start := i
+			for i < len(text) && text[i] != ',' && text[i] != ' ' && text[i] != '=' {
+				i++
+			}
+			tokens = append(tokens, pgListItem{value: text[start:i]})
+		}
+	}
+	for i := 0; i+1 < len(tokens); i += 2 {
+		pair := HstorePair{Key: tokens[i].value}
+		if tokens[i+1].quoted || !strings.EqualFold(tokens[i+1].value, "NULL") {
+			value := tokens[i+1].value
+			pair.Value = &value
+		}
+		pairs = append(pairs, pair)
+	}
+	return
+}
+
+// Bounds of a range value such as [1,10) or ["2020-01-01 00:00:00",) or empty
+func ParsePgRange(text string) (pgRange PgRange, ok bool) {
+	text = strings.TrimSpace(text)
+	if strings.EqualFold(text, "empty") {
+		return PgRange{IsEmpty: true}, true
+	}
+	if len(text) < 3 {
+		return
+	}
+	first := text[0]
+	last := text[len(text)-1]
+	if (first != '[' && first != '(') || (last != ']' && last != ')') {
+		return
+	}
+	items := splitPgList(text[1:len(text)-1], ',')
+	if len(items) != 2 {
+		return
+	}
+	pgRange.LowerInclusive = first == '['
+	pgRange.UpperInclusive = last == ']'
+	if items[0].quoted || items[0].value != "" {
+		lower := items[0].value
+		pgRange.Lower = &lower
+	}
+	if items[1].quoted || items[1].value != "" {
+		upper := items[1].value
+		pgRange.Upper = &upper
+	}
+	return pgRange, true
+}
+
+// Splits on separator, ignoring separators in quotes or nested {} and () groups.
+// Quoted items are unescaped, unquoted items are trimmed.
+func splitPgList(text string, separator byte) (items []pgListItem) {
+	var current strings.Builder
+	quoted := false
+	depth := 0
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case c == '"' && depth == 0:
+			value, end := readQuoted(text, i)
+			current.WriteString(value)
+			quoted = true
+			i = end
+		case c == '"':
+			// quoted section within a nested group, keep it verbatim for the caller to parse
+			_, end := readQuoted(text, i)
+			current.WriteString(text[i : end+1])
+			i = end
+		case c == '{' || c == '(':
+			depth++
+			current.WriteByte(c)
+		case c == '}' || c == ')':
+			depth--
+			current.WriteByte(c)
+		case c == separator && depth == 0:
+			items = append(items, newPgListItem(current.String(), quoted))
+			current.Reset()
+			quoted = false
+		default:
+			current.WriteByte(c)
+		}
+	}
+	items = append(items, newPgListItem(current.String(), quoted))
+	return
+}
+
+func newPgListItem(value string, quoted bool) pgListItem {
+	if !quoted {
+		value = strings.TrimSpace(value)
+	}
+	return pgListItem{value: value, quoted: quoted}
+}
+
+// Reads a double-quoted string starting at openIndex, handling backslash escapes and doubled quotes.
+// Returns the unescaped value and the index of the closing quote.
+func readQuoted(text string, openIndex int) (value string, closeIndex int) {
+	var builder strings.Builder
+	for i := openIndex + 1; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case c == '\\' && i+1 < len(text):
+			i++
+			builder.WriteByte(text[i])
+		case c == '"' && i+1 < len(text) && text[i+1] == '"':
+			i++
+			builder.WriteByte('"')
+		case c == '"':
+			return builder.String(), i
+		default:
+			builder.WriteByte(c)
+		}
+	}
+	return builder.String(), len(text) - 1
+}
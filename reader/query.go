@@ -0,0 +1,131 @@
+package reader
+
+// Ad-hoc queries typed in by the user. The drivers run them so they can't change anything,
+// this side checks they look like a query and works out which columns of the schema the results came from
+// so that the values can be linked like they are on the table pages.
+
+import (
+	"github.com/timabell/schema-explorer/driver_interface"
+	"github.com/timabell/schema-explorer/schema"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const defaultQuerySeconds = 30
+const DefaultQueryRowLimit = 1000
+
+var leadingCommentRegex = regexp.MustCompile(`^(\s+|--[^\n]*(\n|$)|/\*(?s:.*?)\*/)*`)
+var queryStartRegex = regexp.MustCompile(`^(?i)(select|with)\b`)
+
+// Statements and clauses that could end the transaction or change something. Sql server batches can hold several
+// statements without semicolons between them, e.g. "select 1 commit delete from coz", and mysql's select into
+// writes files on the server, so they aren't allowed anywhere in a query.
+var unsafeQueryKeywordRegex = regexp.MustCompile(`(?i)\b(commit|rollback|begin|save|exec|execute|call|insert|update|delete|merge|truncate|drop|alter|create|grant|revoke|deny|use|set|declare|lock|dbcc|kill|shutdown|backup|restore|waitfor|reconfigure|bulk|checkpoint|into|outfile|dumpfile|openquery|openrowset|opendatasource|go)\b`)
+
+// table names following from or join, optionally quoted and schema qualified, e.g. from "sales"."orders" o
+var queryTableRegex = regexp.MustCompile("(?i)\\b(?:from|join)\\s+((?:[\\w$]+|\"[^\"]+\"|`[^`]+`|\\[[^\\]]+\\])(?:\\.(?:[\\w$]+|\"[^\"]+\"|`[^`]+`|\\[[^\\]]+\\]))?)")
+
+// Only single select statements are run, anything else is rejected before it gets to the database.
+// The drivers' read-only transactions stop most changes, this also catches what they don't and gives a clearer message.
+func ValidateQuery(query string) error {
+	statement := strings.TrimSpace(leadingCommentRegex.ReplaceAllString(query, ""))
+	if statement == "" {
+		return errors.New("the query is empty")
+	}
+	if !queryStartRegex.MatchString(statement) {
+		return errors.New("only select statements can be run, the query must start with select or with")
+	}
+	code := strings.TrimSpace(driver_interface.WithoutQuotedText(statement))
+	if strings.Contains(strings.TrimSuffix(code, ";"), ";") {
+		return errors.New("only a single statement can be run, remove the semicolons between statements")
+	}
+	if keyword := unsafeQueryKeywordRegex.FindString(code); keyword != "" {
+		return errors.New(fmt.Sprintf("only a single select statement can be run, \"%s\" isn't allowed outside quotes", keyword))
+	}
+	return nil
+}
+
+// Runs the query, with the timeout from the options
+func RunQuery(dbReader driver_interface.DbReader, databaseName string, query string, rowLimit int, seconds int) (result driver_interface.QueryResult, err error) {
+	err = ValidateQuery(query)
+	if err != nil {
+		return
+	}
+	if seconds <= 0 {
+		seconds = defaultQuerySeconds
+	}
+	if rowLimit <= 0 {
+		rowLimit = DefaultQueryRowLimit
+	}
+	return dbReader.RunQuery(databaseName, query, rowLimit, time.Duration(seconds)*time.Second)
+}
+
+// The tables named in the from and join clauses of the query that are in the schema, in the order they appear
+func QueryTables(database *schema.Database, query string) (tables []*schema.Table) {
+	for _, match := range queryTableRegex.FindAllStringSubmatch(query, -1) {
+		var parts []string
+		for _, part := range strings.SplitN(match[1], ".", 2) {
+			parts = append(parts, strings.Trim(part, "\"`[]"))
+		}
+		tableStub := schema.TableFromString(strings.Join(parts, "."))
+		if tableStub.Schema == "" {
+			tableStub.Schema = database.DefaultSchemaName
+		}
+		table := findTableIgnoringCase(database, tableStub.Schema, tableStub.Name)
+		if table == nil {
+			continue
+		}
+		seen := false
+		for _, existing := range tables {
+			seen = seen || existing == table
+		}
+		if !seen {
+			tables = append(tables, table)
+		}
+	}
+	return
+}
+
+// Where a column of a query's results came from, both nil if it couldn't be traced
+type QuerySource struct {
+	Table  *schema.Table
+	Column *schema.Column
+}
+
+// Traces each result column back to a column of the tables in the query by name,
+// leaving it untraced where no table has a column by that name or more than one does, e.g. "id" in a join.
+// A column of the same name but a different type is something else under an alias, e.g. "convert(varchar(36), id) as id",
+// and is left untraced too. Calculations that keep the type such as "id * 2 as id" can't be told apart.
+func QueryColumnSources(tables []*schema.Table, columnNames []string, typeNames []string) (sources []QuerySource) {
+	for ix, name := range columnNames {
+		var source QuerySource
+		matches := 0
+		for _, table := range tables {
+			for _, col := range table.Columns {
+				if strings.EqualFold(col.Name, name) && ix < len(typeNames) && sameTypeName(typeNames[ix], col.Type) {
+					source = QuerySource{Table: table, Column: col}
+					matches++
+				}
+			}
+		}
+		if matches != 1 {
+			source = QuerySource{}
+		}
+		sources = append(sources, source)
+	}
+	return
+}
+
+// Compares the type the driver reports for a result column, e.g. "varchar(50)" from sqlite or "unsigned int" from mysql,
+// with the type of a column as read from the schema. Drivers that don't report a type give an empty name, which never matches.
+func sameTypeName(resultTypeName string, dataType schema.DataType) bool {
+	name := strings.ToLower(resultTypeName)
+	if openIndex := strings.IndexByte(name, '('); openIndex >= 0 {
+		name = name[:openIndex]
+	}
+	name = strings.TrimSpace(strings.TrimPrefix(name, "unsigned "))
+	return name != "" && name == strings.ToLower(dataType.Name)
+}
@@ -0,0 +1,205 @@
+package reader
+
+// Looks for a value in every table, for when you have an identifier and no idea which table it came from.
+// Each column is counted separately with the normal filter so that the drivers' type handling applies,
+// with a few columns searched at a time until the time budget runs out.
+
+import (
+	"github.com/timabell/schema-explorer/driver_interface"
+	"github.com/timabell/schema-explorer/options"
+	"github.com/timabell/schema-explorer/params"
+	"github.com/timabell/schema-explorer/resources"
+	"github.com/timabell/schema-explorer/schema"
+	"bufio"
+	"context"
+	"log"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultSearchSeconds = 10
+
+// columns searched at once, enough to make use of the database without swamping it
+const searchWorkers = 4
+
+var uuidRegex = regexp.MustCompile(`^(?i)\{?[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}\}?$`)
+
+type SearchTarget struct {
+	Table  *schema.Table
+	Column *schema.Column
+}
+
+type SearchHit struct {
+	SearchTarget
+	RowCount int
+}
+
+type SearchFailure struct {
+	SearchTarget
+	Error error
+}
+
+type SearchResult struct {
+	Hits       []SearchHit // in table and column order
+	Failures   []SearchFailure
+	Searched   int            // columns that finished, with or without hits
+	Unfinished []SearchTarget // started or waiting when the time budget ran out
+}
+
+// Reads the include list from the search config file, an empty list means search everything
+func ReadSearchConfig() (patterns []*regexp.Regexp) {
+	var searchFilename string
+	if options.Options.SearchConfigPath == "" {
+		searchFilename = path.Join(resources.BasePath, "config/search-config.txt")
+	} else {
+		searchFilename = options.Options.SearchConfigPath
+	}
+	file, err := os.Open(searchFilename)
+	if err != nil {
+		log.Printf("Failed to load %s, searching all columns, check search-config-path configuration. %s", searchFilename, err)
+		return
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue // skip blanks and comments
+		}
+		regex, err := regexp.Compile(line)
+		if err != nil {
+			log.Printf(" - skipped search config line %s: %s", line, err)
+			continue
+		}
+		patterns = append(patterns, regex)
+	}
+	return
+}
+
+// The columns that are included by the patterns and could hold the value
+func SearchTargets(database *schema.Database, value string, patterns []*regexp.Regexp) (targets []SearchTarget) {
+	for _, table := range database.Tables {
+		for _, col := range table.Columns {
+			if !isSearchIncluded(table, col, patterns) || !canHoldValue(col.Type, value) {
+				continue
+			}
+			targets = append(targets, SearchTarget{Table: table, Column: col})
+		}
+	}
+	return
+}
+
+func isSearchIncluded(table *schema.Table, col *schema.Column, patterns []*regexp.Regexp) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	fullNameLower := strings.ToLower(table.String() + "." + col.Name)
+	for _, regex := range patterns {
+		if regex.MatchString(fullNameLower) {
+			return true
+		}
+	}
+	return false
+}
+
+// Avoids queries that can't match or that the database would reject, such as comparing an int column to "abc"
+func canHoldValue(dataType schema.DataType, value string) bool {
+	if dataType.IsArray() || dataType.IsRange || dataType.IsComposite || dataType.IsJson || dataType.IsSpatial() || dataType.IsBinary() {
+		return false
+	}
+	if len(dataType.EnumValues) > 0 {
+		for _, enumValue := range dataType.EnumValues {
+			if enumValue == value {
+				return true
+			}
+		}
+		return false
+	}
+	if dataType.IsText() {
+		return dataType.MaxLength == nil || *dataType.MaxLength <= 0 || len([]rune(value)) <= *dataType.MaxLength
+	}
+	if dataType.IsNumeric() {
+		if strings.Contains(strings.ToLower(dataType.Name), "int") {
+			_, err := strconv.ParseInt(value, 10, 64)
+			return err == nil
+		}
+		_, err := strconv.ParseFloat(value, 64)
+		return err == nil
+	}
+	switch strings.ToLower(dataType.Name) {
+	case "uuid", "uniqueidentifier":
+		return uuidRegex.MatchString(value)
+	case "date":
+		_, err := time.Parse("2006-01-02", value)
+		return err == nil
+	}
+	return false
+}
+
+// Counts the rows matching the value in each target column, giving up on whatever hasn't finished after seconds.
+// Queries that are still running when time is up are cancelled so they don't carry on using the database.
+func SearchValue(dbReader driver_interface.DbReader, databaseName string, value string, targets []SearchTarget, seconds int) (result SearchResult) {
+	if seconds <= 0 {
+		seconds = defaultSearchSeconds
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(seconds)*time.Second)
+	defer cancel()
+	type searchOutcome struct {
+		index    int
+		rowCount int
+		err      error
+	}
+	queue := make(chan int, len(targets))
+	for ix := range targets {
+		queue <- ix
+	}
+	close(queue)
+	// buffered so that late workers never block once nobody is listening
+	outcomes := make(chan searchOutcome, len(targets))
+	for worker := 0; worker < searchWorkers; worker++ {
+		go func() {
+			for ix := range queue {
+				if ctx.Err() != nil {
+					return
+				}
+				target := targets[ix]
+				filter := params.FieldFilterList{{Field: target.Column, Values: []string{value}}}
+				rowCount, err := dbReader.GetRowCountContext(ctx, databaseName, target.Table, &params.TableParams{Filter: filter})
+				outcomes <- searchOutcome{index: ix, rowCount: rowCount, err: err}
+			}
+		}()
+	}
+
+	finished := make([]*searchOutcome, len(targets))
+waiting:
+	for result.Searched < len(targets) {
+		select {
+		case outcome := <-outcomes:
+			if outcome.err != nil && ctx.Err() != nil {
+				// cancelled at the deadline rather than failed, counted as unfinished
+				continue
+			}
+			finished[outcome.index] = &outcome
+			result.Searched++
+		case <-ctx.Done():
+			break waiting
+		}
+	}
+
+	for ix, target := range targets {
+		outcome := finished[ix]
+		switch {
+		case outcome == nil:
+			result.Unfinished = append(result.Unfinished, target)
+		case outcome.err != nil:
+			result.Failures = append(result.Failures, SearchFailure{SearchTarget: target, Error: outcome.err})
+		case outcome.rowCount > 0:
+			result.Hits = append(result.Hits, SearchHit{SearchTarget: target, RowCount: outcome.rowCount})
+		}
+	}
+	return
+}
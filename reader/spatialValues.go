@@ -0,0 +1,516 @@
+package reader
+
+// Decoding of the binary formats geometry/geography values come back from the drivers in.
+// https://libgeos.org/specifications/wkb/
+// https://dev.mysql.com/doc/refman/8.0/en/gis-data-formats.html#gis-internal-format
+// https://docs.microsoft.com/en-us/openspecs/sql_server_protocols/ms-ssclrt/ (geometry/geography structures)
+
+import (
+	"github.com/timabell/schema-explorer/schema"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// A decoded geometry, type names and nesting follow GeoJSON.
+// Coordinates are x, y (longitude, latitude for geography) and z if HasZ, measures are dropped.
+type Geometry struct {
+	Type       string        // e.g. "Point", "MultiPolygon", "GeometryCollection"
+	Srid       int           // zero if unknown
+	HasZ       bool
+	Points     [][]float64   // Point (none for an empty point) and LineString
+	Rings      [][][]float64 // Polygon, exterior ring first
+	Geometries []*Geometry   // parts of the Multi* types and GeometryCollection
+}
+
+// wkb and sql server share the OpenGIS type codes
+var geometryTypeNames = map[uint32]string{
+	1: "Point",
+	2: "LineString",
+	3: "Polygon",
+	4: "MultiPoint",
+	5: "MultiLineString",
+	6: "MultiPolygon",
+	7: "GeometryCollection",
+}
+
+func DecodeSpatialValue(colData interface{}, dataType schema.DataType) (geometry *Geometry, err error) {
+	data, ok := BinaryValue(colData)
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("unexpected %T value for spatial type %s", colData, dataType.Name))
+	}
+	switch dataType.Spatial {
+	case schema.PostgisHexEwkb:
+		var wkb []byte
+		wkb, err = hex.DecodeString(string(data))
+		if err != nil {
+			return
+		}
+		return ParseWkb(wkb)
+	case schema.MysqlGeometry:
+		return ParseMysqlGeometry(data)
+	case schema.MssqlClrGeometry:
+		return ParseMssqlGeometry(data, strings.ToLower(dataType.Name) == "geography")
+	}
+	return nil, errors.New(fmt.Sprintf("%s is not a spatial type", dataType.Name))
+}
+
+// Well-known binary, including the PostGIS extensions for srid and z/m flags, and the ISO 1000s type codes for z/m
+func ParseWkb(data []byte) (geometry *Geometry, err error) {
+	reader := &spatialReader{data: data}
+	geometry = reader.readWkbGeometry()
+	if reader.err != nil {
+		return nil, reader.err
+	}
+	return
+}
+
+// mysql's internal format, a little-endian srid followed by well-known binary
+func ParseMysqlGeometry(data []byte) (geometry *Geometry, err error) {
+	if len(data) < 4 {
+		return nil, errors.New("mysql geometry value too short")
+	}
+	geometry, err = ParseWkb(data[4:])
+	if err != nil {
+		return
+	}
+	geometry.Srid = int(binary.LittleEndian.Uint32(data[:4]))
+	return
+}
+
+// Sql server's serialization of geometry and geography, geography points are stored latitude first.
+// Curves (version 2 segments) aren't supported.
+func ParseMssqlGeometry(data []byte, isGeography bool) (geometry *Geometry, err error) {
+	const (
+		hasZ              = 0x01
+		hasM              = 0x02
+		singlePoint       = 0x08
+		singleLineSegment = 0x10
+	)
+	reader := &spatialReader{data: data, order: binary.LittleEndian}
+	srid := int(int32(reader.readUint32()))
+	version := reader.readByte()
+	if reader.err == nil && version != 1 && version != 2 {
+		return nil, errors.New(fmt.Sprintf("unknown sql server spatial serialization version %d", version))
+	}
+	properties := reader.readByte()
+	var pointCount int
+	switch {
+	case properties&singlePoint != 0:
+		pointCount = 1
+	case properties&singleLineSegment != 0:
+		pointCount = 2
+	default:
+		pointCount = reader.readCount(16)
+	}
+	points := make([][]float64, pointCount)
+	for i := range points {
+		first := reader.readFloat64()
+		second := reader.readFloat64()
+		if isGeography {
+			points[i] = []float64{second, first}
+		} else {
+			points[i] = []float64{first, second}
+		}
+	}
+	if properties&hasZ != 0 {
+		for i := range points {
+			points[i] = append(points[i], reader.readFloat64())
+		}
+	}
+	if properties&hasM != 0 {
+		for range points {
+			reader.readFloat64()
+		}
+	}
+	if reader.err != nil {
+		return nil, reader.err
+	}
+	if properties&(singlePoint|singleLineSegment) != 0 {
+		geometry = &Geometry{Type: "Point", Points: points}
+		if pointCount == 2 {
+			geometry.Type = "LineString"
+		}
+		geometry.Srid = srid
+		geometry.HasZ = properties&hasZ != 0
+		return
+	}
+
+	// figures are runs of points (a ring, a line or a single point), shapes group the figures into a tree of geometries
+	figureCount := reader.readCount(5)
+	figureOffsets := make([]int, figureCount)
+	for i := range figureOffsets {
+		reader.readByte() // attribute, e.g. exterior vs interior ring, the order tells us that anyway
+		figureOffsets[i] = int(reader.readUint32())
+	}
+	type shape struct {
+		parentOffset int
+		figureOffset int
+		typeCode     uint32
+	}
+	shapeCount := reader.readCount(9)
+	shapes := make([]shape, shapeCount)
+	for i := range shapes {
+		shapes[i].parentOffset = int(int32(reader.readUint32()))
+		shapes[i].figureOffset = int(int32(reader.readUint32()))
+		shapes[i].typeCode = uint32(reader.readByte())
+	}
+	if reader.err != nil {
+		return nil, reader.err
+	}
+	if shapeCount == 0 {
+		return nil, errors.New("sql server spatial value has no shapes")
+	}
+
+	figurePoints := func(figure int) [][]float64 {
+		end := pointCount
+		if figure+1 < figureCount {
+			end = figureOffsets[figure+1]
+		}
+		if figureOffsets[figure] > end || end > pointCount {
+			return nil
+		}
+		return points[figureOffsets[figure]:end]
+	}
+	// a shape's figures run up to the first figure of the next shape that has any
+	shapeFigures := func(shapeIndex int) (figures []int) {
+		if shapes[shapeIndex].figureOffset < 0 {
+			return
+		}
+		end := figureCount
+		for next := shapeIndex + 1; next < shapeCount; next++ {
+			if shapes[next].figureOffset >= 0 {
+				end = shapes[next].figureOffset
+				break
+			}
+		}
+		for figure := shapes[shapeIndex].figureOffset; figure < end && figure < figureCount; figure++ {
+			figures = append(figures, figure)
+		}
+		return
+	}
+	var buildShape func(shapeIndex int) (*Geometry, error)
+	buildShape = func(shapeIndex int) (*Geometry, error) {
+		typeName, known := geometryTypeNames[shapes[shapeIndex].typeCode]
+		if !known {
+			return nil, errors.New(fmt.Sprintf("unsupported sql server spatial shape type %d", shapes[shapeIndex].typeCode))
+		}
+		shapeGeometry := &Geometry{Type: typeName, HasZ: properties&hasZ != 0}
+		switch typeName {
+		case "Point", "LineString":
+			shapeGeometry.Points = [][]float64{}
+			for _, figure := range shapeFigures(shapeIndex) {
+				shapeGeometry.Points = append(shapeGeometry.Points, figurePoints(figure)...)
+			}
+		case "Polygon":
+			shapeGeometry.Rings = [][][]float64{}
+			for _, figure := range shapeFigures(shapeIndex) {
+				shapeGeometry.Rings = append(shapeGeometry.Rings, figurePoints(figure))
+			}
+		default:
+			shapeGeometry.Geometries = []*Geometry{}
+			for child := shapeIndex + 1; child < shapeCount; child++ {
+				if shapes[child].parentOffset != shapeIndex {
+					continue
+				}
+				childGeometry, err := buildShape(child)
+				if err != nil {
+					return nil, err
+				}
+				shapeGeometry.Geometries = append(shapeGeometry.Geometries, childGeometry)
+			}
+		}
+		return shapeGeometry, nil
+	}
+	geometry, err = buildShape(0)
+	if err != nil {
+		return
+	}
+	geometry.Srid = srid
+	return
+}
+
+// Well-known text, e.g. "POINT (1 2)", "POLYGON Z ((0 0 1, 1 0 1, 1 1 1, 0 0 1))"
+func (geometry *Geometry) Wkt() string {
+	var builder strings.Builder
+	builder.WriteString(strings.ToUpper(geometry.Type))
+	if geometry.HasZ {
+		builder.WriteString(" Z")
+	}
+	builder.WriteString(" ")
+	geometry.writeWktBody(&builder)
+	return builder.String()
+}
+
+func (geometry *Geometry) IsEmpty() bool {
+	return len(geometry.Points) == 0 && len(geometry.Rings) == 0 && len(geometry.Geometries) == 0
+}
+
+func (geometry *Geometry) writeWktBody(builder *strings.Builder) {
+	if geometry.IsEmpty() {
+		builder.WriteString("EMPTY")
+		return
+	}
+	switch geometry.Type {
+	case "Point", "LineString":
+		writeWktPoints(builder, geometry.Points)
+	case "Polygon":
+		writeWktRings(builder, geometry.Rings)
+	case "GeometryCollection":
+		builder.WriteString("(")
+		for i, part := range geometry.Geometries {
+			if i > 0 {
+				builder.WriteString(", ")
+			}
+			builder.WriteString(part.Wkt())
+		}
+		builder.WriteString(")")
+	default: // multi types list the bodies of their parts without repeating the type
+		builder.WriteString("(")
+		for i, part := range geometry.Geometries {
+			if i > 0 {
+				builder.WriteString(", ")
+			}
+			part.writeWktBody(builder)
+		}
+		builder.WriteString(")")
+	}
+}
+
+func writeWktRings(builder *strings.Builder, rings [][][]float64) {
+	builder.WriteString("(")
+	for i, ring := range rings {
+		if i > 0 {
+			builder.WriteString(", ")
+		}
+		writeWktPoints(builder, ring)
+	}
+	builder.WriteString(")")
+}
+
+func writeWktPoints(builder *strings.Builder, points [][]float64) {
+	builder.WriteString("(")
+	for i, point := range points {
+		if i > 0 {
+			builder.WriteString(", ")
+		}
+		for j, ordinate := range point {
+			if j > 0 {
+				builder.WriteString(" ")
+			}
+			builder.WriteString(strconv.FormatFloat(ordinate, 'f', -1, 64))
+		}
+	}
+	builder.WriteString(")")
+}
+
+// GeoJSON geometry object, ready for json.Marshal
+func (geometry *Geometry) GeoJson() map[string]interface{} {
+	if geometry.Type == "GeometryCollection" {
+		parts := []interface{}{}
+		for _, part := range geometry.Geometries {
+			parts = append(parts, part.GeoJson())
+		}
+		return map[string]interface{}{"type": geometry.Type, "geometries": parts}
+	}
+	return map[string]interface{}{"type": geometry.Type, "coordinates": geometry.geoJsonCoordinates()}
+}
+
+func (geometry *Geometry) geoJsonCoordinates() interface{} {
+	switch geometry.Type {
+	case "Point":
+		if len(geometry.Points) == 0 {
+			return []float64{}
+		}
+		return geometry.Points[0]
+	case "LineString":
+		if geometry.Points == nil {
+			return [][]float64{}
+		}
+		return geometry.Points
+	case "Polygon":
+		if geometry.Rings == nil {
+			return [][][]float64{}
+		}
+		return geometry.Rings
+	}
+	parts := []interface{}{}
+	for _, part := range geometry.Geometries {
+		parts = append(parts, part.geoJsonCoordinates())
+	}
+	return parts
+}
+
+// Calls visit for every coordinate, e.g. to find the extent for drawing
+func (geometry *Geometry) EachPoint(visit func(point []float64)) {
+	for _, point := range geometry.Points {
+		visit(point)
+	}
+	for _, ring := range geometry.Rings {
+		for _, point := range ring {
+			visit(point)
+		}
+	}
+	for _, part := range geometry.Geometries {
+		part.EachPoint(visit)
+	}
+}
+
+// Sequential reads from a byte slice, remembering the first error so that callers can check once at the end
+type spatialReader struct {
+	data   []byte
+	offset int
+	order  binary.ByteOrder
+	err    error
+}
+
+func (reader *spatialReader) fail(message string) {
+	if reader.err == nil {
+		reader.err = errors.New(message)
+	}
+}
+
+func (reader *spatialReader) take(count int) []byte {
+	if reader.err != nil {
+		return nil
+	}
+	if reader.offset+count > len(reader.data) {
+		reader.fail("spatial value ended unexpectedly")
+		return nil
+	}
+	taken := reader.data[reader.offset : reader.offset+count]
+	reader.offset += count
+	return taken
+}
+
+func (reader *spatialReader) readByte() byte {
+	taken := reader.take(1)
+	if taken == nil {
+		return 0
+	}
+	return taken[0]
+}
+
+func (reader *spatialReader) readUint32() uint32 {
+	taken := reader.take(4)
+	if taken == nil {
+		return 0
+	}
+	return reader.order.Uint32(taken)
+}
+
+func (reader *spatialReader) readFloat64() float64 {
+	taken := reader.take(8)
+	if taken == nil {
+		return 0
+	}
+	return math.Float64frombits(reader.order.Uint64(taken))
+}
+
+// reads a count of items, checking there are enough bytes left for them so that bad data can't cause huge allocations
+func (reader *spatialReader) readCount(minItemSize int) int {
+	count := int(reader.readUint32())
+	if reader.err == nil && count*minItemSize > len(reader.data)-reader.offset {
+		reader.fail("spatial value count exceeds the data available")
+		return 0
+	}
+	return count
+}
+
+func (reader *spatialReader) readWkbGeometry() *Geometry {
+	const (
+		ewkbZ    = 0x80000000
+		ewkbM    = 0x40000000
+		ewkbSrid = 0x20000000
+	)
+	switch reader.readByte() {
+	case 0:
+		reader.order = binary.BigEndian
+	case 1:
+		reader.order = binary.LittleEndian
+	default:
+		reader.fail("invalid wkb byte order")
+	}
+	typeCode := reader.readUint32()
+	if reader.err != nil {
+		return nil
+	}
+	geometry := &Geometry{}
+	hasZ := typeCode&ewkbZ != 0
+	hasM := typeCode&ewkbM != 0
+	if typeCode&ewkbSrid != 0 {
+		geometry.Srid = int(int32(reader.readUint32()))
+	}
+	typeCode = typeCode &^ (ewkbZ | ewkbM | ewkbSrid)
+	switch typeCode / 1000 {
+	case 1:
+		hasZ = true
+	case 2:
+		hasM = true
+	case 3:
+		hasZ, hasM = true, true
+	}
+	typeCode = typeCode % 1000
+	typeName, known := geometryTypeNames[typeCode]
+	if !known {
+		reader.fail(fmt.Sprintf("unsupported wkb geometry type %d", typeCode))
+		return nil
+	}
+	geometry.Type = typeName
+	geometry.HasZ = hasZ
+	ordinateCount := 2
+	if hasZ {
+		ordinateCount++
+	}
+	if hasM {
+		ordinateCount++
+	}
+	switch typeName {
+	case "Point":
+		geometry.Points = [][]float64{}
+		point := reader.readWkbPoint(ordinateCount, hasZ)
+		if !math.IsNaN(point[0]) { // empty points are written as NaN coordinates
+			geometry.Points = append(geometry.Points, point)
+		}
+	case "LineString":
+		geometry.Points = reader.readWkbPoints(ordinateCount, hasZ)
+	case "Polygon":
+		ringCount := reader.readCount(4)
+		geometry.Rings = [][][]float64{}
+		for i := 0; i < ringCount; i++ {
+			geometry.Rings = append(geometry.Rings, reader.readWkbPoints(ordinateCount, hasZ))
+		}
+	default:
+		partCount := reader.readCount(5)
+		geometry.Geometries = []*Geometry{}
+		for i := 0; i < partCount && reader.err == nil; i++ {
+			geometry.Geometries = append(geometry.Geometries, reader.readWkbGeometry())
+		}
+	}
+	return geometry
+}
+
+func (reader *spatialReader) readWkbPoints(ordinateCount int, hasZ bool) (points [][]float64) {
+	pointCount := reader.readCount(ordinateCount * 8)
+	points = make([][]float64, pointCount)
+	for i := range points {
+		points[i] = reader.readWkbPoint(ordinateCount, hasZ)
+	}
+	return
+}
+
+// x, y and z if present, dropping m
+func (reader *spatialReader) readWkbPoint(ordinateCount int, hasZ bool) []float64 {
+	ordinates := make([]float64, ordinateCount)
+	for i := range ordinates {
+		ordinates[i] = reader.readFloat64()
+	}
+	if hasZ {
+		return ordinates[:3]
+	}
+	return ordinates[:2]
+}
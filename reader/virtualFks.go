@@ -0,0 +1,136 @@
+package reader
+
+// Relationships the database doesn't know about, such as polymorphic or application-enforced links,
+// listed in a config file so that they can be documented and navigated like declared foreign keys.
+
+import (
+	"github.com/timabell/schema-explorer/options"
+	"github.com/timabell/schema-explorer/resources"
+	"github.com/timabell/schema-explorer/schema"
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// e.g. sales.orders(customer_ref) => crm.customers(id)
+var virtualFkRegex = regexp.MustCompile(`^(\S+?)\s*\(([^)]+)\)\s*=>\s*(\S+?)\s*\(([^)]+)\)$`)
+
+func setupVirtualFks(database *schema.Database) {
+	if options.Options == nil {
+		panic("options is nil")
+	}
+	var virtualFilename string
+	if options.Options.VirtualFksConfigPath == "" {
+		virtualFilename = path.Join(resources.BasePath, "config/virtual-fks-config.txt")
+	} else {
+		virtualFilename = options.Options.VirtualFksConfigPath
+	}
+	log.Printf("Loading virtual relationships from %s ...", virtualFilename)
+	file, err := os.Open(virtualFilename)
+	if err != nil {
+		log.Printf("Failed to load %s, no virtual relationships added, check virtual-fks-config-path configuration. %s", virtualFilename, err)
+		return
+	}
+	defer file.Close()
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	_, errs := AddVirtualFks(database, lines)
+	for _, err := range errs {
+		log.Printf(" - skipped virtual relationship: %s", err)
+	}
+}
+
+// Adds an fk for each relationship line, skipping blanks and # comments.
+// Lines that can't be used are reported in errs rather than stopping the rest being added.
+func AddVirtualFks(database *schema.Database, lines []string) (added []*schema.Fk, errs []error) {
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fk, err := parseVirtualFk(database, line)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if hasMatchingFk(fk) {
+			errs = append(errs, errors.New(fmt.Sprintf("'%s' already exists", line)))
+			continue
+		}
+		AddFk(database, fk)
+		added = append(added, fk)
+		log.Printf(" - virtual fk %s", fk)
+	}
+	return
+}
+
+func parseVirtualFk(database *schema.Database, line string) (fk *schema.Fk, err error) {
+	match := virtualFkRegex.FindStringSubmatch(line)
+	if match == nil {
+		err = errors.New(fmt.Sprintf("'%s' should be in the form: schema.table(column,...) => schema.table(column,...)", line))
+		return
+	}
+	sourceTable, sourceColumns, err := findVirtualFkEnd(database, match[1], match[2])
+	if err != nil {
+		return
+	}
+	destinationTable, destinationColumns, err := findVirtualFkEnd(database, match[3], match[4])
+	if err != nil {
+		return
+	}
+	if len(sourceColumns) != len(destinationColumns) {
+		err = errors.New(fmt.Sprintf("'%s' has %d source columns but %d destination columns", line, len(sourceColumns), len(destinationColumns)))
+		return
+	}
+	fk = &schema.Fk{
+		Name:               fmt.Sprintf("virtual_%s_%s", sourceTable.Name, strings.Replace(sourceColumns.String(), ",", "_", -1)),
+		SourceTable:        sourceTable,
+		SourceColumns:      sourceColumns,
+		DestinationTable:   destinationTable,
+		DestinationColumns: destinationColumns,
+		Origin:             schema.VirtualFk,
+	}
+	return
+}
+
+// Finds a table and its columns by name ignoring case, the default schema is used if one isn't given
+func findVirtualFkEnd(database *schema.Database, tableName string, columnList string) (table *schema.Table, columns schema.ColumnList, err error) {
+	requested := schema.TableFromString(tableName)
+	if requested.Schema == "" {
+		requested.Schema = database.DefaultSchemaName
+	}
+	table = findTableIgnoringCase(database, requested.Schema, requested.Name)
+	if table == nil {
+		err = errors.New(fmt.Sprintf("table %s not found", tableName))
+		return
+	}
+	for _, columnName := range strings.Split(columnList, ",") {
+		col := findColumnIgnoringCase(table, strings.TrimSpace(columnName))
+		if col == nil {
+			err = errors.New(fmt.Sprintf("column %s not found in %s", strings.TrimSpace(columnName), table))
+			return
+		}
+		columns = append(columns, col)
+	}
+	return
+}
+
+// True if the database already has an fk between the same columns, e.g. once the real constraint has been added
+func hasMatchingFk(fk *schema.Fk) bool {
+	for _, existing := range fk.SourceTable.Fks {
+		if existing.DestinationTable == fk.DestinationTable &&
+			existing.SourceColumns.String() == fk.SourceColumns.String() &&
+			existing.DestinationColumns.String() == fk.DestinationColumns.String() {
+			return true
+		}
+	}
+	return false
+}
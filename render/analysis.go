@@ -0,0 +1,123 @@
+package render
+
+import (
+	"github.com/timabell/schema-explorer/reader"
+	"github.com/timabell/schema-explorer/schema"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// More months than this are shown as years so the chart stays readable
+const maxMonthBars = 60
+
+// Filled in to the sample choices on the analysis page until another sample is used
+const defaultSampleRows = 1000
+const defaultSamplePercent = 10
+
+type columnAnalysisViewModel struct {
+	schema.ColumnAnalysis
+	Status       reader.AnalysisStatus
+	Finished     string
+	Error        error
+	NullPercent  int
+	AverageValue string // formatted for display, empty if not numeric
+	StdDevValue  string
+	LengthChart  []chartBar
+	DateChart    []chartBar
+}
+
+// One bar of a histogram, Percent is relative to the tallest bar
+type chartBar struct {
+	Label    string
+	Quantity int
+	Percent  int
+}
+
+func buildColumnAnalysis(job reader.AnalysisJob) (viewModel columnAnalysisViewModel) {
+	columnAnalysis := job.Result
+	viewModel.ColumnAnalysis = columnAnalysis
+	viewModel.Status = job.Status
+	viewModel.Error = job.Error
+	if job.Status.IsFinished() {
+		viewModel.Finished = job.Finished.Format("2006-01-02 15:04:05")
+	}
+	if columnAnalysis.RowCount > 0 {
+		viewModel.NullPercent = columnAnalysis.NullCount * 100 / columnAnalysis.RowCount
+	}
+	if columnAnalysis.Average != nil {
+		viewModel.AverageValue = strconv.FormatFloat(*columnAnalysis.Average, 'g', 6, 64)
+	}
+	if columnAnalysis.StdDev != nil {
+		viewModel.StdDevValue = strconv.FormatFloat(*columnAnalysis.StdDev, 'g', 6, 64)
+	}
+
+	// the driver gives the most common lengths, show them shortest first
+	lengthCounts := append([]schema.ValueInfo{}, columnAnalysis.LengthCounts...)
+	sort.Slice(lengthCounts, func(i, j int) bool {
+		return lengthCounts[i].Value.(int) < lengthCounts[j].Value.(int)
+	})
+	viewModel.LengthChart = buildChart(lengthCounts)
+
+	dateCounts := columnAnalysis.DateCounts
+	if len(dateCounts) > maxMonthBars {
+		dateCounts = rollUpToYears(dateCounts)
+	}
+	viewModel.DateChart = buildChart(dateCounts)
+	return
+}
+
+func buildChart(counts []schema.ValueInfo) (bars []chartBar) {
+	largest := 0
+	for _, count := range counts {
+		if count.Quantity > largest {
+			largest = count.Quantity
+		}
+	}
+	for _, count := range counts {
+		bars = append(bars, chartBar{
+			Label:    fmt.Sprintf("%v", count.Value),
+			Quantity: count.Quantity,
+			Percent:  count.Quantity * 100 / largest,
+		})
+	}
+	return
+}
+
+// Merges yyyy-mm buckets into yyyy, relies on the months being in order
+func rollUpToYears(monthCounts []schema.ValueInfo) (yearCounts []schema.ValueInfo) {
+	for _, monthCount := range monthCounts {
+		year := strings.SplitN(fmt.Sprintf("%v", monthCount.Value), "-", 2)[0]
+		last := len(yearCounts) - 1
+		if last >= 0 && yearCounts[last].Value == year {
+			yearCounts[last].Quantity += monthCount.Quantity
+			continue
+		}
+		yearCounts = append(yearCounts, schema.ValueInfo{Value: year, Quantity: monthCount.Quantity})
+	}
+	return
+}
+
+type analysisStatusModel struct {
+	Column   string `json:"column"`
+	Status   string `json:"status"`
+	Finished bool   `json:"finished"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Progress of each column's analysis as json, for polling from the analysis page
+func ShowAnalysisStatus(resp http.ResponseWriter, jobs []reader.AnalysisJob) error {
+	var columns []analysisStatusModel
+	for _, job := range jobs {
+		status := analysisStatusModel{Column: job.Column.Name, Status: job.Status.String(), Finished: job.Status.IsFinished()}
+		if job.Error != nil {
+			status.Error = job.Error.Error()
+		}
+		columns = append(columns, status)
+	}
+	resp.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(resp).Encode(map[string]interface{}{"columns": columns})
+}
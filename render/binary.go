@@ -0,0 +1,54 @@
+package render
+
+import (
+	"github.com/timabell/schema-explorer/driver_interface"
+	"github.com/timabell/schema-explorer/reader"
+	"github.com/timabell/schema-explorer/schema"
+	"fmt"
+	"html/template"
+	"strings"
+)
+
+const binaryPreviewBytes = 16
+
+// Hex of the first few bytes and the size, with a thumbnail or badge for recognised file types.
+// Values can be downloaded if the table has a primary key to identify the row by.
+func buildBinaryCell(databaseName string, table *schema.Table, col *schema.Column, data []byte, rowData reader.RowData, peekFinder *driver_interface.PeekLookup) string {
+	preview, truncated := reader.HexPreview(data, binaryPreviewBytes)
+	if truncated {
+		preview = preview + "…"
+	}
+	cellUrl := buildCellUrl(databaseName, table, col, rowData, peekFinder)
+	valueHTML := "<span class='binary-value'>"
+	if fileType := reader.DetectFileType(data); fileType != nil {
+		if fileType.IsImage && cellUrl != "" {
+			valueHTML = valueHTML + fmt.Sprintf("<img src='%s' class='binary-thumbnail' alt='%s'/>", cellUrl, fileType.Name)
+		}
+		valueHTML = valueHTML + fmt.Sprintf("<span class='file-type' title='%s'>%s</span> ", fileType.MimeType, fileType.Name)
+	}
+	valueHTML = valueHTML + fmt.Sprintf("<code class='hex'>0x%s</code> <span class='byte-count'>%d bytes</span>", preview, len(data))
+	if cellUrl != "" {
+		valueHTML = valueHTML + fmt.Sprintf(" <a href='%s' class='download' title='Download value'><i class='fas fa-download'></i></a>", cellUrl)
+	}
+	return valueHTML + "</span>"
+}
+
+// Link to the raw value of a cell, empty if the row can't be identified by a primary key
+func buildCellUrl(databaseName string, table *schema.Table, col *schema.Column, rowData reader.RowData, peekFinder *driver_interface.PeekLookup) string {
+	if table.Pk == nil {
+		return ""
+	}
+	var queryData []string
+	for _, pkCol := range table.Pk.Columns {
+		pkCellData := rowData[peekFinder.ColumnIndex(pkCol)]
+		if pkCellData == nil {
+			return ""
+		}
+		escapedName := template.URLQueryEscaper(pkCol.Name)
+		escapedValue := template.URLQueryEscaper(*reader.DbValueToString(pkCellData, pkCol.Type))
+		queryData = append(queryData, fmt.Sprintf("%s=%s", escapedName, escapedValue))
+	}
+	var pairs = []string{"tableName", table.String(), "columnName", col.Name}
+	cellUrl := urlBuilder("route-database-tables-cell", databaseName, pairs)
+	return template.HTMLEscapeString(fmt.Sprintf("%s?%s", cellUrl, strings.Join(queryData, "&")))
+}
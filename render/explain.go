@@ -0,0 +1,42 @@
+package render
+
+import (
+	"github.com/timabell/schema-explorer/driver_interface"
+	"github.com/timabell/schema-explorer/params"
+	"github.com/timabell/schema-explorer/schema"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+type explainViewModel struct {
+	LayoutData  PageTemplateModel
+	Database    *schema.Database
+	Table       *schema.Table
+	TableParams *params.TableParams
+	Sql         string
+	Plan        *driver_interface.PlanNode
+	Error       string // why the database couldn't explain the query
+}
+
+func ShowQueryPlan(resp http.ResponseWriter, database *schema.Database, table *schema.Table, tableParams *params.TableParams, sqlText string, plan *driver_interface.PlanNode, planErr error, layoutData PageTemplateModel) error {
+	viewModel := explainViewModel{
+		LayoutData:  layoutData,
+		Database:    database,
+		Table:       table,
+		TableParams: tableParams,
+		Sql:         sqlText,
+		Plan:        plan,
+	}
+	if planErr != nil {
+		viewModel.Error = planErr.Error()
+	}
+
+	viewModel.LayoutData.Title = fmt.Sprintf("explain %s | %s", table.String(), viewModel.LayoutData.Title)
+
+	err := explainTemplate.ExecuteTemplate(resp, "layout", viewModel)
+	if err != nil {
+		log.Print("template execution error ", err)
+	}
+	return nil
+}
@@ -0,0 +1,200 @@
+package render
+
+import (
+	"github.com/timabell/schema-explorer/driver_interface"
+	"github.com/timabell/schema-explorer/params"
+	"github.com/timabell/schema-explorer/reader"
+	"github.com/timabell/schema-explorer/schema"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+// More distinct values of the second column than this are left out of the pivot table to keep it readable
+const maxPivotColumns = 20
+
+type groupByViewModel struct {
+	LayoutData  PageTemplateModel
+	Database    *schema.Database
+	Table       *schema.Table
+	TableParams *params.TableParams
+	Choices     []params.GroupByCol
+	GroupBy     []params.GroupByCol
+	TotalRows   int
+	Groups      []groupViewModel
+	Pivot       *pivotViewModel // only when grouping by two columns
+}
+
+type groupViewModel struct {
+	Labels   []groupLabel // one per group by column
+	Quantity int
+	Percent  string       // of the total rows matching the filters
+	Width    int          // bar width, relative to the largest group
+	RowsUrl  template.URL // empty if the group can't be filtered to, i.e. one of the values is null
+}
+
+type groupLabel struct {
+	Text   string
+	IsNull bool
+}
+
+// Cross tab of the first group by column down the side against the second across the top
+type pivotViewModel struct {
+	ColumnLabels  []groupLabel
+	Rows          []pivotRowViewModel
+	HiddenColumns int // distinct values of the second column beyond maxPivotColumns
+}
+
+type pivotRowViewModel struct {
+	Label groupLabel
+	Cells []*groupViewModel // nil where there are no rows for the combination
+	Total int
+}
+
+// distinguishes null from the text "[null]"
+func (label groupLabel) key() string {
+	if label.IsNull {
+		return "\x00null"
+	}
+	return label.Text
+}
+
+// Counts rows per combination of the group by values, keeping the filters in tableParams
+func ShowGroupBy(resp http.ResponseWriter, dbReader driver_interface.DbReader, database *schema.Database, table *schema.Table, groupBy []params.GroupByCol, tableParams *params.TableParams, layoutData PageTemplateModel) error {
+	viewModel := groupByViewModel{
+		LayoutData:  layoutData,
+		Database:    database,
+		Table:       table,
+		TableParams: tableParams,
+		Choices:     params.GroupByChoices(table),
+		GroupBy:     groupBy,
+	}
+
+	if len(groupBy) > 0 {
+		var err error
+		viewModel.TotalRows, err = dbReader.GetRowCount(database.Name, table, &params.TableParams{Filter: tableParams.Filter})
+		if err != nil {
+			return err
+		}
+		groups, err := dbReader.GetGroupCounts(database.Name, table, groupBy, tableParams)
+		if err != nil {
+			return err
+		}
+		largest := 0
+		for _, group := range groups {
+			if group.Quantity > largest {
+				largest = group.Quantity
+			}
+		}
+		for _, group := range groups {
+			viewModel.Groups = append(viewModel.Groups, buildGroup(database.Name, table, groupBy, tableParams, group, viewModel.TotalRows, largest))
+		}
+		if len(groupBy) == 2 {
+			viewModel.Pivot = buildPivot(viewModel.Groups)
+		}
+	}
+
+	viewModel.LayoutData.Title = fmt.Sprintf("%s group by | %s", table.String(), viewModel.LayoutData.Title)
+
+	err := groupByTemplate.ExecuteTemplate(resp, "layout", viewModel)
+	if err != nil {
+		log.Print("template execution error ", err)
+	}
+	return nil
+}
+
+// Labels the group with the peeked values where there are any and links to the rows in the group
+func buildGroup(databaseName string, table *schema.Table, groupBy []params.GroupByCol, tableParams *params.TableParams, group schema.GroupCount, totalRows int, largest int) (viewModel groupViewModel) {
+	viewModel.Quantity = group.Quantity
+	if totalRows > 0 {
+		viewModel.Percent = strconv.FormatFloat(float64(group.Quantity)*100/float64(totalRows), 'f', 1, 64)
+	}
+	if largest > 0 {
+		viewModel.Width = group.Quantity * 100 / largest
+	}
+	drillParams := *tableParams
+	drillParams.RowLimit = 100
+	canDrill := true
+	for ix, groupCol := range groupBy {
+		value := reader.DbValueToString(group.Values[ix], groupCol.Column.Type)
+		if value == nil {
+			canDrill = false
+			viewModel.Labels = append(viewModel.Labels, groupLabel{IsNull: true})
+			continue
+		}
+		drillParams = drillParams.SetFilter(groupCol.Column, *value)
+		label := *value
+		if groupCol.PeekFk != nil {
+			if peekValue := reader.DbValueToString(group.PeekValues[ix], groupCol.PeekCol.Type); peekValue != nil {
+				label = *peekValue
+			}
+		}
+		viewModel.Labels = append(viewModel.Labels, groupLabel{Text: label})
+	}
+	if canDrill {
+		var pairs = []string{"tableName", table.String()}
+		rowsUrl := urlBuilder("route-database-tables", databaseName, pairs)
+		viewModel.RowsUrl = template.URL(fmt.Sprintf("%s?%s#data", rowsUrl, drillParams.AsQueryString()))
+	}
+	return
+}
+
+// Rows and columns are ordered largest total first, as the groups are
+func buildPivot(groups []groupViewModel) *pivotViewModel {
+	pivot := &pivotViewModel{}
+	rowIndexes := map[string]int{}
+	columnTotals := map[string]int{}
+	columnLabels := map[string]groupLabel{}
+	for _, group := range groups {
+		rowKey := group.Labels[0].key()
+		columnKey := group.Labels[1].key()
+		if _, exists := rowIndexes[rowKey]; !exists {
+			rowIndexes[rowKey] = len(pivot.Rows)
+			pivot.Rows = append(pivot.Rows, pivotRowViewModel{Label: group.Labels[0]})
+		}
+		pivot.Rows[rowIndexes[rowKey]].Total += group.Quantity
+		columnTotals[columnKey] += group.Quantity
+		columnLabels[columnKey] = group.Labels[1]
+	}
+	sort.SliceStable(pivot.Rows, func(i, j int) bool {
+		return pivot.Rows[i].Total > pivot.Rows[j].Total
+	})
+	for ix, row := range pivot.Rows {
+		rowIndexes[row.Label.key()] = ix
+	}
+
+	var columnKeys []string
+	for key := range columnTotals {
+		columnKeys = append(columnKeys, key)
+	}
+	sort.Slice(columnKeys, func(i, j int) bool {
+		if columnTotals[columnKeys[i]] == columnTotals[columnKeys[j]] {
+			return columnKeys[i] < columnKeys[j]
+		}
+		return columnTotals[columnKeys[i]] > columnTotals[columnKeys[j]]
+	})
+	if len(columnKeys) > maxPivotColumns {
+		pivot.HiddenColumns = len(columnKeys) - maxPivotColumns
+		columnKeys = columnKeys[:maxPivotColumns]
+	}
+	columnIndexes := map[string]int{}
+	for ix, key := range columnKeys {
+		columnIndexes[key] = ix
+		pivot.ColumnLabels = append(pivot.ColumnLabels, columnLabels[key])
+	}
+
+	for ix := range pivot.Rows {
+		pivot.Rows[ix].Cells = make([]*groupViewModel, len(columnKeys))
+	}
+	for ix := range groups {
+		columnIndex, shown := columnIndexes[groups[ix].Labels[1].key()]
+		if !shown {
+			continue
+		}
+		pivot.Rows[rowIndexes[groups[ix].Labels[0].key()]].Cells[columnIndex] = &groups[ix]
+	}
+	return pivot
+}
@@ -0,0 +1,67 @@
+package render
+
+import (
+	"github.com/timabell/schema-explorer/schema"
+	"github.com/timabell/schema-explorer/trail"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// More steps than this are only on the history page
+const maxBreadcrumbs = 8
+
+type breadcrumbViewModel struct {
+	Index   int // of the step in the history, for going back to it
+	Step    trail.HistoryStep
+	Filters string // readable filter values, e.g. "poke_id=11, name=it's"
+}
+
+type historyViewModel struct {
+	LayoutData PageTemplateModel
+	Database   *schema.Database
+	Steps      []breadcrumbViewModel
+	Permalinks []string
+	Export     string
+}
+
+func newBreadcrumb(index int, step trail.HistoryStep) breadcrumbViewModel {
+	filters, err := url.QueryUnescape(step.Filters)
+	if err != nil {
+		filters = step.Filters
+	}
+	return breadcrumbViewModel{Index: index, Step: step, Filters: strings.Replace(filters, "&", ", ", -1)}
+}
+
+func buildBreadcrumbs(history trail.History) (breadcrumbs []breadcrumbViewModel, hiddenSteps int) {
+	if len(history.Steps) > maxBreadcrumbs {
+		hiddenSteps = len(history.Steps) - maxBreadcrumbs
+	}
+	for ix := hiddenSteps; ix < len(history.Steps); ix++ {
+		breadcrumbs = append(breadcrumbs, newBreadcrumb(ix, history.Steps[ix]))
+	}
+	return
+}
+
+// Lists every step of the history, with the permalinks of each for sharing
+func ShowHistory(resp http.ResponseWriter, database *schema.Database, history trail.History, permalinks []string, layoutData PageTemplateModel) error {
+	viewModel := historyViewModel{
+		LayoutData: layoutData,
+		Database:   database,
+		Permalinks: permalinks,
+		Export:     strings.Join(permalinks, "\n"),
+	}
+	for ix, step := range history.Steps {
+		viewModel.Steps = append(viewModel.Steps, newBreadcrumb(ix, step))
+	}
+
+	viewModel.LayoutData.Title = fmt.Sprintf("history | %s", viewModel.LayoutData.Title)
+
+	err := historyTemplate.ExecuteTemplate(resp, "layout", viewModel)
+	if err != nil {
+		log.Print("template execution error ", err)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package render
+
+import (
+	"github.com/timabell/schema-explorer/driver_interface"
+	"github.com/timabell/schema-explorer/schema"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// More shortest paths than this are left out, e.g. between tables with many fks to each other
+const maxJoinPaths = 10
+
+type joinPathsViewModel struct {
+	LayoutData PageTemplateModel
+	Database   *schema.Database
+	From       *schema.Table // nil until both tables are chosen
+	To         *schema.Table
+	Paths      []joinPathViewModel
+	Diagram    diagramViewModel
+}
+
+type joinPathViewModel struct {
+	Path schema.JoinPath
+	Sql  string
+}
+
+// Shows the shortest ways of joining the two tables, if they've been chosen
+func ShowJoinPaths(resp http.ResponseWriter, dbReader driver_interface.DbReader, database *schema.Database, from *schema.Table, to *schema.Table, layoutData PageTemplateModel) error {
+	viewModel := joinPathsViewModel{
+		LayoutData: layoutData,
+		Database:   database,
+		From:       from,
+		To:         to,
+	}
+	if from != nil && to != nil {
+		diagramTables := []*schema.Table{from}
+		var tableLinks []fkViewModel
+		seenTables := map[*schema.Table]bool{from: true}
+		seenLinks := map[string]bool{}
+		for _, path := range database.FindJoinPaths(from, to, maxJoinPaths) {
+			sql := dbReader.GetJoinSql(database.Name, driver_interface.JoinQueryFromPath(from, path))
+			viewModel.Paths = append(viewModel.Paths, joinPathViewModel{Path: path, Sql: sql})
+			for _, step := range path {
+				if !seenTables[step.To()] {
+					seenTables[step.To()] = true
+					diagramTables = append(diagramTables, step.To())
+				}
+				// the diagram can only draw one link between a pair of tables
+				linkId := step.Fk.SourceTable.String() + "_" + step.Fk.DestinationTable.String()
+				if !seenLinks[linkId] {
+					seenLinks[linkId] = true
+					tableLinks = append(tableLinks, newFkViewModel(step.Fk))
+				}
+			}
+		}
+		viewModel.Diagram = diagramViewModel{Tables: diagramTables, TableLinks: tableLinks, LayoutData: layoutData}
+	}
+
+	viewModel.LayoutData.Title = fmt.Sprintf("join path | %s", viewModel.LayoutData.Title)
+
+	err := joinPathTemplate.ExecuteTemplate(resp, "layout", viewModel)
+	if err != nil {
+		log.Print("template execution error ", err)
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package render
+
+import (
+	"github.com/timabell/schema-explorer/params"
+	"github.com/timabell/schema-explorer/schema"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"strings"
+	"unicode/utf8"
+)
+
+const previewLength = 60
+
+// Pretty prints json, collapsed to a one-line preview until it's clicked on.
+// If filterCol is set then scalar values link to rows that have the same value at the same path.
+func buildJsonCell(filterCol *schema.Column, stringValue string) string {
+	decoder := json.NewDecoder(strings.NewReader(stringValue))
+	decoder.UseNumber() // don't lose precision on big numbers by going via float64
+	var body strings.Builder
+	err := writeJsonValue(&body, decoder, filterCol, nil, 0)
+	if err != nil {
+		// not json after all, show it as is
+		return "<span class='bare-value'>" + template.HTMLEscapeString(stringValue) + "</span> "
+	}
+	preview, _ := truncatePreview(stringValue)
+	return fmt.Sprintf("<details class='json-value'><summary>%s</summary><pre>%s</pre></details>", template.HTMLEscapeString(preview), body.String())
+}
+
+// Reads the next value from the decoder and writes it out as indented html, recursing into objects and arrays.
+func writeJsonValue(out *strings.Builder, decoder *json.Decoder, filterCol *schema.Column, path []string, depth int) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	indent := strings.Repeat("  ", depth)
+	switch value := token.(type) {
+	case json.Delim:
+		out.WriteString(value.String())
+		count := 0
+		for decoder.More() {
+			if count > 0 {
+				out.WriteString(",")
+			}
+			out.WriteString("\n" + indent + "  ")
+			var key string
+			if value == '{' {
+				keyToken, err := decoder.Token()
+				if err != nil {
+					return err
+				}
+				key = fmt.Sprintf("%s", keyToken)
+				out.WriteString("<span class='json-key'>" + template.HTMLEscapeString(jsonQuote(key)) + "</span>: ")
+			} else {
+				key = fmt.Sprintf("%d", count)
+			}
+			// copy the path so that siblings don't share a backing array
+			childPath := append(append([]string{}, path...), key)
+			err = writeJsonValue(out, decoder, filterCol, childPath, depth+1)
+			if err != nil {
+				return err
+			}
+			count++
+		}
+		closing, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			out.WriteString("\n" + indent)
+		}
+		out.WriteString(closing.(json.Delim).String())
+	case nil:
+		out.WriteString("<span class='null'>null</span>")
+	case string:
+		writeJsonLeaf(out, filterCol, path, jsonQuote(value), value)
+	case json.Number:
+		writeJsonLeaf(out, filterCol, path, value.String(), value.String())
+	case bool:
+		writeJsonLeaf(out, filterCol, path, fmt.Sprintf("%t", value), fmt.Sprintf("%t", value))
+	}
+	return nil
+}
+
+func writeJsonLeaf(out *strings.Builder, filterCol *schema.Column, path []string, displayValue string, filterValue string) {
+	escapedDisplay := template.HTMLEscapeString(displayValue)
+	if filterCol == nil || len(path) == 0 || !canFilterOnJsonPath(path) {
+		out.WriteString("<span class='json-scalar'>" + escapedDisplay + "</span>")
+		return
+	}
+	key := template.HTMLEscapeString(template.URLQueryEscaper(params.JsonPathKey(filterCol, path)))
+	value := template.HTMLEscapeString(template.URLQueryEscaper(filterValue))
+	title := template.HTMLEscapeString("Rows with this value at " + strings.Join(path, "."))
+	out.WriteString(fmt.Sprintf("<a href='?%s=%s&_rowLimit=100#data' class='json-scalar json-filter' title='%s'>%s</a>", key, value, title, escapedDisplay))
+}
+
+// the path is passed around dot separated so keys containing dots can't be filtered on
+func canFilterOnJsonPath(path []string) bool {
+	for _, element := range path {
+		if element == "" || strings.Contains(element, ".") {
+			return false
+		}
+	}
+	return true
+}
+
+// shortens long values for showing in a summary that expands to the full value
+func truncatePreview(value string) (preview string, truncated bool) {
+	if utf8.RuneCountInString(value) > previewLength {
+		return string([]rune(value)[:previewLength]) + "…", true
+	}
+	return value, false
+}
+
+// quotes a string the way json does, without the escaping of html characters that json.Marshal does
+func jsonQuote(value string) string {
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(value)
+	return strings.TrimSuffix(buffer.String(), "\n")
+}
@@ -0,0 +1,97 @@
+package render
+
+import (
+	"github.com/timabell/schema-explorer/params"
+	"github.com/timabell/schema-explorer/reader"
+	"github.com/timabell/schema-explorer/schema"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+type orphansViewModel struct {
+	LayoutData PageTemplateModel
+	Database   *schema.Database
+	Table      *schema.Table // nil when checking the whole database
+	Results    []fkOrphansViewModel
+	InProgress bool
+}
+
+type fkOrphansViewModel struct {
+	Fk       *schema.Fk
+	Status   reader.AnalysisStatus
+	Finished string
+	RowCount int
+	Values   []orphanValueViewModel
+	Error    error // one failing check doesn't stop the rest being shown
+}
+
+type orphanValueViewModel struct {
+	Value    string
+	Quantity int
+	RowsUrl  string
+}
+
+// Shows the checks of each of the fks out of table (or every fk in the database if table is nil) for rows without a parent,
+// including the ones still queued or running
+func ShowOrphans(resp http.ResponseWriter, database *schema.Database, table *schema.Table, jobs []reader.OrphanJob, layoutData PageTemplateModel) error {
+	viewModel := orphansViewModel{
+		LayoutData: layoutData,
+		Database:   database,
+		Table:      table,
+	}
+	for _, job := range jobs {
+		result := fkOrphansViewModel{Fk: job.Fk, Status: job.Status, RowCount: job.Result.RowCount, Error: job.Error}
+		if job.Status.IsFinished() {
+			result.Finished = job.Finished.Format("2006-01-02 15:04:05")
+		} else {
+			viewModel.InProgress = true
+		}
+		for _, orphanValue := range job.Result.ValueCounts {
+			result.Values = append(result.Values, buildOrphanValue(database.Name, job.Fk, orphanValue))
+		}
+		viewModel.Results = append(viewModel.Results, result)
+	}
+
+	title := "orphans"
+	if table != nil {
+		title = fmt.Sprintf("%s orphans", table.String())
+	}
+	viewModel.LayoutData.Title = fmt.Sprintf("%s | %s", title, viewModel.LayoutData.Title)
+
+	err := orphansTemplate.ExecuteTemplate(resp, "layout", viewModel)
+	if err != nil {
+		log.Print("template execution error ", err)
+	}
+	return nil
+}
+
+// Display text and a link to the source rows filtered to the missing values
+func buildOrphanValue(databaseName string, fk *schema.Fk, orphanValue schema.OrphanValue) orphanValueViewModel {
+	var displayValues, queryData []string
+	for ix, col := range fk.SourceColumns {
+		// arrays are checked a value at a time, so link to the rows containing the missing one
+		valueType := col.Type
+		key := col.Name
+		if col.Type.IsArray() {
+			valueType = fk.DestinationColumns[ix].Type
+			key = params.ArrayContainsKey(col)
+		}
+		value := reader.DbValueToString(orphanValue.Values[ix], valueType)
+		if value == nil {
+			// excluded by the orphan queries, but don't fall over if a driver returns one
+			value = new(string)
+		}
+		displayValues = append(displayValues, *value)
+		queryData = append(queryData, fmt.Sprintf("%s=%s", url.QueryEscape(key), url.QueryEscape(*value)))
+	}
+	var pairs = []string{"tableName", fk.SourceTable.String()}
+	rowsUrl := urlBuilder("route-database-tables", databaseName, pairs)
+	return orphanValueViewModel{
+		Value:    strings.Join(displayValues, ", "),
+		Quantity: orphanValue.Quantity,
+		RowsUrl:  fmt.Sprintf("%s?%s&_rowLimit=100#data", rowsUrl, strings.Join(queryData, "&")),
+	}
+}
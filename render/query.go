@@ -0,0 +1,129 @@
+package render
+
+import (
+	"github.com/timabell/schema-explorer/driver_interface"
+	"github.com/timabell/schema-explorer/reader"
+	"github.com/timabell/schema-explorer/schema"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+)
+
+type queryViewModel struct {
+	LayoutData PageTemplateModel
+	Database   *schema.Database
+	Query      string
+	RowLimit   int
+	Ran        bool   // false until a query has been posted
+	Error      string // why the query was rejected or failed
+	Columns    []queryColumnViewModel
+	Rows       []cells
+	Truncated  bool
+}
+
+type queryColumnViewModel struct {
+	Name   string
+	Source reader.QuerySource
+}
+
+// Shows the query form, and the results if a query was run. The query is ignored if it's empty.
+func ShowQuery(resp http.ResponseWriter, database *schema.Database, query string, rowLimit int, ran bool, result driver_interface.QueryResult, queryErr error, layoutData PageTemplateModel) error {
+	viewModel := queryViewModel{
+		LayoutData: layoutData,
+		Database:   database,
+		Query:      query,
+		RowLimit:   rowLimit,
+		Ran:        ran,
+		Truncated:  result.Truncated,
+	}
+	if queryErr != nil {
+		viewModel.Error = queryErr.Error()
+	} else if viewModel.Ran {
+		sources := reader.QueryColumnSources(reader.QueryTables(database, query), result.Columns, result.TypeNames)
+		// lets the fk link builders find the other columns of a compound key in the row
+		peekFinder := &driver_interface.PeekLookup{}
+		for ix, name := range result.Columns {
+			viewModel.Columns = append(viewModel.Columns, queryColumnViewModel{Name: name, Source: sources[ix]})
+			peekFinder.Columns = append(peekFinder.Columns, sources[ix].Column)
+		}
+		for _, rowData := range result.Rows {
+			row := cells{}
+			for ix, cellData := range rowData {
+				row = append(row, template.HTML(buildQueryCell(database, sources[ix], result.TypeNames[ix], cellData, rowData, peekFinder)))
+			}
+			viewModel.Rows = append(viewModel.Rows, row)
+		}
+	}
+
+	viewModel.LayoutData.Title = fmt.Sprintf("sql | %s", viewModel.LayoutData.Title)
+
+	err := queryTemplate.ExecuteTemplate(resp, "layout", viewModel)
+	if err != nil {
+		log.Print("template execution error ", err)
+	}
+	return nil
+}
+
+// Formats a value like buildCell does, linking to the row it refers to if the column could be traced back to
+// a foreign key or primary key and all of the key's columns are in the results
+func buildQueryCell(database *schema.Database, source reader.QuerySource, typeName string, cellData interface{}, rowData reader.RowData, peekFinder *driver_interface.PeekLookup) string {
+	if cellData == nil {
+		return "<span class='null bare-value'>[null]</span>"
+	}
+	col := source.Column
+	if col == nil {
+		col = &schema.Column{Type: schema.DataType{Name: typeName, IsJson: strings.Contains(typeName, "json")}}
+	}
+	if source.Column != nil && !col.Type.IsArray() {
+		stringValue := *reader.DbValueToString(cellData, col.Type)
+		for _, fk := range col.Fks {
+			if hasQueryColumns(peekFinder, fk.SourceColumns) {
+				return buildFkHref(database.Name, fk.DestinationTable, buildQueryData(fk, rowData, peekFinder), buildFkCss(fk, false), stringValue, "")
+			}
+		}
+		if col.IsInPrimaryKey && hasQueryColumns(peekFinder, source.Table.Pk.Columns) {
+			var queryData []string
+			for _, pkCol := range source.Table.Pk.Columns {
+				pkValue := reader.DbValueToString(rowData[peekFinder.ColumnIndex(pkCol)], pkCol.Type)
+				if pkValue == nil {
+					return "<span class='bare-value'>" + template.HTMLEscapeString(stringValue) + "</span> "
+				}
+				queryData = append(queryData, fmt.Sprintf("%s=%s", template.URLQueryEscaper(pkCol.Name), template.URLQueryEscaper(*pkValue)))
+			}
+			return buildFkHref(database.Name, source.Table, template.HTMLEscapeString(strings.Join(queryData, "&")), "pk-link", stringValue, "")
+		}
+	}
+
+	// formatted as on the table pages, without the links that need the rest of the table's row
+	switch {
+	case col.Type.IsSpatial():
+		return buildSpatialCell(cellData, col.Type)
+	case col.Type.IsBinary():
+		if data, ok := reader.BinaryValue(cellData); ok {
+			return buildBinaryCell(database.Name, &schema.Table{}, col, data, rowData, peekFinder)
+		}
+	}
+	stringValue := *reader.DbValueToString(cellData, col.Type)
+	switch {
+	case col.Type.IsJson:
+		return buildJsonCell(nil, stringValue)
+	case col.Type.IsRange:
+		return buildRangeCell(stringValue)
+	case col.Type.IsComposite:
+		return buildCompositeCell(stringValue)
+	case col.Type.Name == "hstore":
+		return buildHstoreCell(stringValue)
+	}
+	return "<span class='bare-value'>" + template.HTMLEscapeString(stringValue) + "</span> "
+}
+
+func hasQueryColumns(peekFinder *driver_interface.PeekLookup, columns schema.ColumnList) bool {
+	for _, col := range columns {
+		if !peekFinder.Columns.Contains(col) {
+			return false
+		}
+	}
+	return true
+}
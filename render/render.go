@@ -62,6 +62,11 @@ type diagramViewModel struct {
 type fkViewModel struct {
 	Source      schema.Table
 	Destination schema.Table
+	Inferred    bool
+}
+
+func newFkViewModel(fk *schema.Fk) fkViewModel {
+	return fkViewModel{Source: *fk.SourceTable, Destination: *fk.DestinationTable, Inferred: fk.IsInferred()}
 }
 
 type cells []template.HTML
@@ -76,19 +81,31 @@ type tableDataViewModel struct {
 	Database          *schema.Database
 	Table             *schema.Table
 	TableParams       *params.TableParams
+	Columns           schema.ColumnList // shown columns in display order
+	HiddenColumns     schema.ColumnList
+	RelatedValues     []params.RelatedValue // peek columns and inbound counts that can be sorted and filtered on
+	Sql               string                // the statement run for the rows, for users to take to their own sql tools
+	History           []breadcrumbViewModel // the latest steps of the navigation history, ending with this page
+	HiddenSteps       int                   // earlier steps of the history left out of the breadcrumbs
 	Rows              []cells
 	TotalRowCount     int
 	FilteredRowCount  int
 	DisplayedRowCount int
 	HasPrevPage       bool
 	HasNextPage       bool
+	PrevPageParams    params.TableParams
+	NextPageParams    params.TableParams
 	Diagram           diagramViewModel
 }
 type tableAnalysisDataViewModel struct {
 	LayoutData PageTemplateModel
 	Database   *schema.Database
 	Table      *schema.Table
-	Analysis   []schema.ColumnAnalysis
+	Analysis   []columnAnalysisViewModel
+	InProgress bool                  // some columns are still queued or running
+	Sample     schema.AnalysisSample // selected for re-running
+	SampleRows int                   // shown in the sample inputs even when not selected
+	SamplePct  int
 }
 
 var databasesTemplate *template.Template
@@ -96,6 +113,16 @@ var tablesTemplate *template.Template
 var tableTemplate *template.Template
 var tableDataTemplate *template.Template
 var tableAnalysisTemplate *template.Template
+var orphansTemplate *template.Template
+var groupByTemplate *template.Template
+var searchTemplate *template.Template
+var queryTemplate *template.Template
+var savedViewsTemplate *template.Template
+var explainTemplate *template.Template
+var joinPathTemplate *template.Template
+var historyTemplate *template.Template
+var trailSqlTemplate *template.Template
+var schemaSearchTemplate *template.Template
 var tableTrailTemplate *template.Template
 var selectDriverTemplate *template.Template
 var setupDriverTemplate *template.Template
@@ -157,6 +184,46 @@ func SetupTemplates() {
 	if err != nil {
 		log.Fatal(err)
 	}
+	orphansTemplate, err = template.Must(templates.Clone()).ParseGlob(resources.TemplateFolder + "/orphans.tmpl")
+	if err != nil {
+		log.Fatal(err)
+	}
+	groupByTemplate, err = template.Must(templates.Clone()).ParseGlob(resources.TemplateFolder + "/group-by.tmpl")
+	if err != nil {
+		log.Fatal(err)
+	}
+	searchTemplate, err = template.Must(templates.Clone()).ParseGlob(resources.TemplateFolder + "/search.tmpl")
+	if err != nil {
+		log.Fatal(err)
+	}
+	schemaSearchTemplate, err = template.Must(templates.Clone()).ParseGlob(resources.TemplateFolder + "/schema-search.tmpl")
+	if err != nil {
+		log.Fatal(err)
+	}
+	queryTemplate, err = template.Must(templates.Clone()).ParseGlob(resources.TemplateFolder + "/query.tmpl")
+	if err != nil {
+		log.Fatal(err)
+	}
+	savedViewsTemplate, err = template.Must(templates.Clone()).ParseGlob(resources.TemplateFolder + "/saved.tmpl")
+	if err != nil {
+		log.Fatal(err)
+	}
+	explainTemplate, err = template.Must(templates.Clone()).ParseGlob(resources.TemplateFolder + "/explain.tmpl")
+	if err != nil {
+		log.Fatal(err)
+	}
+	joinPathTemplate, err = template.Must(templates.Clone()).ParseGlob(resources.TemplateFolder + "/join-path.tmpl")
+	if err != nil {
+		log.Fatal(err)
+	}
+	trailSqlTemplate, err = template.Must(templates.Clone()).ParseGlob(resources.TemplateFolder + "/trail-sql.tmpl")
+	if err != nil {
+		log.Fatal(err)
+	}
+	historyTemplate, err = template.Must(templates.Clone()).ParseGlob(resources.TemplateFolder + "/history.tmpl")
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	selectDriverTemplate, err = template.Must(templates.Clone()).ParseGlob(resources.TemplateFolder + "/select-driver.tmpl")
 	if err != nil {
@@ -219,7 +286,7 @@ func ShowDatabaseList(resp http.ResponseWriter, layoutData PageTemplateModel, da
 func ShowTableList(resp http.ResponseWriter, database *schema.Database, layoutData PageTemplateModel) {
 	var tableLinks []fkViewModel
 	for _, fk := range database.Fks {
-		tableLinks = append(tableLinks, fkViewModel{Source: *fk.SourceTable, Destination: *fk.DestinationTable})
+		tableLinks = append(tableLinks, newFkViewModel(fk))
 	}
 
 	model := tableListViewModel{
@@ -234,7 +301,7 @@ func ShowTableList(resp http.ResponseWriter, database *schema.Database, layoutDa
 	}
 }
 
-func ShowTable(resp http.ResponseWriter, dbReader driver_interface.DbReader, database *schema.Database, table *schema.Table, tableParams *params.TableParams, layoutData PageTemplateModel, dataOnly bool) error {
+func ShowTable(resp http.ResponseWriter, dbReader driver_interface.DbReader, database *schema.Database, table *schema.Table, tableParams *params.TableParams, history trail.History, layoutData PageTemplateModel, dataOnly bool) error {
 	unfilteredParams := tableParams.ClearPaging()
 	filteredRowCount, err := dbReader.GetRowCount(database.Name, table, &unfilteredParams)
 	totalRowCount, err := dbReader.GetRowCount(database.Name, table, &params.TableParams{})
@@ -245,7 +312,7 @@ func ShowTable(resp http.ResponseWriter, dbReader driver_interface.DbReader, dat
 
 	rows := []cells{}
 	for _, rowData := range rowsData {
-		row := buildRow(database.Name, rowData, peekFinder, table)
+		row := buildRow(database, rowData, peekFinder, table, tableParams.ShownColumns(table))
 		rows = append(rows, row)
 	}
 
@@ -254,11 +321,11 @@ func ShowTable(resp http.ResponseWriter, dbReader driver_interface.DbReader, dat
 	if !dataOnly {
 		for _, tableFks := range table.Fks {
 			diagramTables = append(diagramTables, tableFks.DestinationTable)
-			tableLinks = append(tableLinks, fkViewModel{Source: *tableFks.SourceTable, Destination: *tableFks.DestinationTable})
+			tableLinks = append(tableLinks, newFkViewModel(tableFks))
 		}
 		for _, inboundFks := range table.InboundFks {
 			diagramTables = append(diagramTables, inboundFks.SourceTable)
-			tableLinks = append(tableLinks, fkViewModel{Source: *inboundFks.SourceTable, Destination: *inboundFks.DestinationTable})
+			tableLinks = append(tableLinks, newFkViewModel(inboundFks))
 		}
 	}
 
@@ -267,15 +334,29 @@ func ShowTable(resp http.ResponseWriter, dbReader driver_interface.DbReader, dat
 		Database:          database,
 		Table:             table,
 		TableParams:       tableParams,
+		Columns:           tableParams.ShownColumns(table),
+		HiddenColumns:     tableParams.HiddenColumns(table),
+		RelatedValues:     params.RelatedValueChoices(table),
+		Sql:               dbReader.GetSqlText(database.Name, table, tableParams, peekFinder),
 		Rows:              rows,
 		TotalRowCount:     totalRowCount,
 		FilteredRowCount:  filteredRowCount,
 		DisplayedRowCount: len(rows),
 		HasPrevPage:       tableParams.SkipRows > 0,
 		HasNextPage:       tableParams.ToRow() < filteredRowCount,
+		PrevPageParams:    tableParams.PrevPage(),
+		NextPageParams:    tableParams.NextPage(),
 		Diagram:           diagramViewModel{Tables: diagramTables, TableLinks: tableLinks, LayoutData: layoutData},
 	}
 
+	viewModel.History, viewModel.HiddenSteps = buildBreadcrumbs(history)
+
+	// page from the rows either side so that deep pages don't have to skip all the rows before them
+	if keyset := tableParams.KeysetColumns(table); tableParams.ReadsInKeysetOrder(table) && len(rowsData) > 0 {
+		viewModel.PrevPageParams = tableParams.PrevPageBefore(keysetValues(keyset, rowsData[0], peekFinder))
+		viewModel.NextPageParams = tableParams.NextPageAfter(keysetValues(keyset, rowsData[len(rowsData)-1], peekFinder))
+	}
+
 	viewModel.LayoutData.Title = fmt.Sprintf("%s | %s", table.String(), viewModel.LayoutData.Title)
 
 	if dataOnly {
@@ -302,7 +383,7 @@ func ShowTableTrail(resp http.ResponseWriter, database *schema.Database, trailIn
 
 	var tableLinks []fkViewModel
 	for _, tableFks := range database.Fks {
-		tableLinks = append(tableLinks, fkViewModel{Source: *tableFks.SourceTable, Destination: *tableFks.DestinationTable})
+		tableLinks = append(tableLinks, newFkViewModel(tableFks))
 	}
 	// todo: Filter fks
 
@@ -323,22 +404,31 @@ func ShowTableTrail(resp http.ResponseWriter, database *schema.Database, trailIn
 	return nil
 }
 
-func ShowTableAnalysis(resp http.ResponseWriter, dbReader driver_interface.DbReader, database *schema.Database, table *schema.Table, layoutData PageTemplateModel) error {
-	analysis, err := dbReader.GetAnalysis(database.Name, table)
-	if err != nil {
-		return err
-	}
-
+func ShowTableAnalysis(resp http.ResponseWriter, database *schema.Database, table *schema.Table, jobs []reader.AnalysisJob, sample schema.AnalysisSample, layoutData PageTemplateModel) error {
 	viewModel := tableAnalysisDataViewModel{
 		LayoutData: layoutData,
 		Database:   database,
 		Table:      table,
-		Analysis:   analysis,
+		Sample:     sample,
+		SampleRows: defaultSampleRows,
+		SamplePct:  defaultSamplePercent,
+	}
+	if sample.FirstRows > 0 {
+		viewModel.SampleRows = sample.FirstRows
+	}
+	if sample.Percent > 0 {
+		viewModel.SamplePct = sample.Percent
+	}
+	for _, job := range jobs {
+		viewModel.Analysis = append(viewModel.Analysis, buildColumnAnalysis(job))
+		if !job.Status.IsFinished() {
+			viewModel.InProgress = true
+		}
 	}
 
 	viewModel.LayoutData.Title = fmt.Sprintf("%s analysis | %s", table.String(), viewModel.LayoutData.Title)
 
-	err = tableAnalysisTemplate.ExecuteTemplate(resp, "layout", viewModel)
+	err := tableAnalysisTemplate.ExecuteTemplate(resp, "layout", viewModel)
 	if err != nil {
 		log.Print("template execution error ", err)
 	}
@@ -346,14 +436,23 @@ func ShowTableAnalysis(resp http.ResponseWriter, dbReader driver_interface.DbRea
 	return nil
 }
 
-func buildRow(databaseName string, rowData reader.RowData, peekFinder *driver_interface.PeekLookup, table *schema.Table) cells {
+// values of the row's keyset columns, for the cursor of the page either side of it
+func keysetValues(keyset []params.SortCol, rowData reader.RowData, peekFinder *driver_interface.PeekLookup) (values []string) {
+	for _, sortCol := range keyset {
+		values = append(values, *reader.DbValueToString(rowData[peekFinder.ColumnIndex(sortCol.Column)], sortCol.Column.Type))
+	}
+	return
+}
+
+// Cells for the given columns in the order given, followed by the inbound links
+func buildRow(database *schema.Database, rowData reader.RowData, peekFinder *driver_interface.PeekLookup, table *schema.Table, columns schema.ColumnList) cells {
 	row := cells{}
-	for colIndex, col := range table.Columns {
-		cellData := rowData[colIndex]
-		valueHTML := buildCell(databaseName, col, cellData, rowData, peekFinder)
+	for _, col := range columns {
+		cellData := rowData[peekFinder.ColumnIndex(col)]
+		valueHTML := buildCell(database, table, col, cellData, rowData, peekFinder)
 		row = append(row, template.HTML(valueHTML))
 	}
-	parentHTML := buildInwardCell(databaseName, table.InboundFks, rowData, peekFinder)
+	parentHTML := buildInwardCell(database.Name, table.InboundFks, rowData, peekFinder)
 	row = append(row, template.HTML(parentHTML))
 	return row
 }
@@ -404,9 +503,13 @@ func buildInwardLink(databaseName string, fk *schema.Fk, rowData reader.RowData,
 	var queryData []string
 	for ix, fkCol := range fk.SourceColumns {
 		destinationCol := fk.DestinationColumns[ix]
-		fkCellData := rowData[destinationCol.Position]
-		escapedName := template.HTMLEscapeString(template.URLQueryEscaper(fkCol.String()))
-		escapedValue := template.HTMLEscapeString(template.URLQueryEscaper(reader.DbValueToString(fkCellData, fkCol.Type)))
+		fkCellData := rowData[peekFinder.ColumnIndex(destinationCol)]
+		filterKey := fkCol.String()
+		if fkCol.Type.IsArray() {
+			filterKey = params.ArrayContainsKey(fkCol)
+		}
+		escapedName := template.HTMLEscapeString(template.URLQueryEscaper(filterKey))
+		escapedValue := template.HTMLEscapeString(template.URLQueryEscaper(reader.DbValueToString(fkCellData, destinationCol.Type)))
 		queryData = append(queryData, fmt.Sprintf("%s=%s", escapedName, escapedValue))
 	}
 	var joinedQueryData = strings.Join(queryData, "&")
@@ -416,17 +519,46 @@ func buildInwardLink(databaseName string, fk *schema.Fk, rowData reader.RowData,
 	if rowCount > 0 {
 		var pairs = []string{"tableName", fk.SourceTable.String()}
 		fkUrl := urlBuilder("route-database-tables", databaseName, pairs)
-		return fmt.Sprintf("<a href='%s?%s%s' class='parent-fk-link'>%s - %d rows</a>", fkUrl, joinedQueryData, suffix, fk.SourceColumns, rowCount)
+		cssClass := "parent-fk-link"
+		if fk.IsInferred() {
+			cssClass = cssClass + " inferred"
+		}
+		return fmt.Sprintf("<a href='%s?%s%s' class='%s'>%s - %d rows</a>", fkUrl, joinedQueryData, suffix, cssClass, fk.SourceColumns, rowCount)
 	} else {
 		return fmt.Sprintf("%s - %d rows", fk.SourceColumns, rowCount)
 	}
 }
 
-func buildCell(databaseName string, col *schema.Column, cellData interface{}, rowData reader.RowData, peekFinder *driver_interface.PeekLookup) string {
+func buildCell(database *schema.Database, table *schema.Table, col *schema.Column, cellData interface{}, rowData reader.RowData, peekFinder *driver_interface.PeekLookup) string {
 	if cellData == nil {
 		return "<span class='null bare-value'>[null]</span>"
 	}
+	databaseName := database.Name
+	if col.Type.IsSpatial() {
+		return buildSpatialCell(cellData, col.Type)
+	}
+	if col.Type.IsBinary() && col.Fks == nil {
+		if data, ok := reader.BinaryValue(cellData); ok {
+			return buildBinaryCell(databaseName, table, col, data, rowData, peekFinder)
+		}
+	}
 	stringValue := *reader.DbValueToString(cellData, col.Type)
+	switch {
+	case col.Type.IsJson:
+		var filterCol *schema.Column
+		if database.Supports.JsonFilter {
+			filterCol = col
+		}
+		return buildJsonCell(filterCol, stringValue)
+	case col.Type.IsArray():
+		return buildArrayCell(databaseName, col, stringValue)
+	case col.Type.IsRange:
+		return buildRangeCell(stringValue)
+	case col.Type.IsComposite:
+		return buildCompositeCell(stringValue)
+	case col.Type.Name == "hstore":
+		return buildHstoreCell(stringValue)
+	}
 	if col.Fks != nil {
 		multiFk := len(col.Fks) > 1
 		if multiFk {
@@ -448,9 +580,98 @@ func buildCell(databaseName string, col *schema.Column, cellData interface{}, ro
 	}
 }
 
+// Lists the elements of an array, linking each to the row it references if the column has a foreign key,
+// otherwise to the rows of this table that contain the same element.
+func buildArrayCell(databaseName string, col *schema.Column, stringValue string) string {
+	elements := reader.ParsePgArray(stringValue)
+	if elements == nil {
+		return "<span class='bare-value'>" + template.HTMLEscapeString(stringValue) + "</span> "
+	}
+	var fk *schema.Fk
+	if len(col.Fks) > 0 && len(col.Fks[0].SourceColumns) == 1 {
+		fk = col.Fks[0]
+	}
+	containsKey := template.HTMLEscapeString(template.URLQueryEscaper(params.ArrayContainsKey(col)))
+	valueHTML := "<ul class='array-value'>"
+	for _, element := range elements {
+		valueHTML = valueHTML + "<li>"
+		switch {
+		case element == nil:
+			valueHTML = valueHTML + "<span class='null bare-value'>[null]</span>"
+		case strings.HasPrefix(*element, "{"): // inner array of a multi-dimensional array
+			valueHTML = valueHTML + "<span class='bare-value'>" + template.HTMLEscapeString(*element) + "</span>"
+		case fk != nil:
+			escapedValue := template.HTMLEscapeString(template.URLQueryEscaper(*element))
+			query := fmt.Sprintf("%s=%s", fk.DestinationColumns[0], escapedValue)
+			valueHTML = valueHTML + buildFkHref(databaseName, fk.DestinationTable, query, buildFkCss(fk, false), *element, "")
+		default:
+			escapedValue := template.HTMLEscapeString(template.URLQueryEscaper(*element))
+			valueHTML = valueHTML + fmt.Sprintf("<a href='?%s=%s&_rowLimit=100#data' class='array-contains' title='Rows containing this value'>%s</a>", containsKey, escapedValue, template.HTMLEscapeString(*element))
+		}
+		valueHTML = valueHTML + "</li>"
+	}
+	return valueHTML + "</ul>"
+}
+
+func buildRangeCell(stringValue string) string {
+	pgRange, ok := reader.ParsePgRange(stringValue)
+	if !ok {
+		return "<span class='bare-value'>" + template.HTMLEscapeString(stringValue) + "</span> "
+	}
+	if pgRange.IsEmpty {
+		return "<span class='bare-value range-value'>empty</span>"
+	}
+	lower := "-&infin;"
+	if pgRange.Lower != nil {
+		lower = template.HTMLEscapeString(*pgRange.Lower)
+	}
+	upper := "&infin;"
+	if pgRange.Upper != nil {
+		upper = template.HTMLEscapeString(*pgRange.Upper)
+	}
+	openBracket := "("
+	if pgRange.LowerInclusive {
+		openBracket = "["
+	}
+	closeBracket := ")"
+	if pgRange.UpperInclusive {
+		closeBracket = "]"
+	}
+	return fmt.Sprintf("<span class='bare-value range-value'>%s%s, %s%s</span>", openBracket, lower, upper, closeBracket)
+}
+
+func buildCompositeCell(stringValue string) string {
+	fields := reader.ParsePgComposite(stringValue)
+	if fields == nil {
+		return "<span class='bare-value'>" + template.HTMLEscapeString(stringValue) + "</span> "
+	}
+	var fieldsHTML []string
+	for _, field := range fields {
+		if field == nil {
+			fieldsHTML = append(fieldsHTML, "<span class='null'>[null]</span>")
+		} else {
+			fieldsHTML = append(fieldsHTML, template.HTMLEscapeString(*field))
+		}
+	}
+	return "<span class='bare-value composite-value'>(" + strings.Join(fieldsHTML, ", ") + ")</span>"
+}
+
+func buildHstoreCell(stringValue string) string {
+	valueHTML := "<dl class='hstore-value'>"
+	for _, pair := range reader.ParseHstore(stringValue) {
+		valueHTML = valueHTML + "<dt>" + template.HTMLEscapeString(pair.Key) + "</dt>"
+		if pair.Value == nil {
+			valueHTML = valueHTML + "<dd><span class='null bare-value'>[null]</span></dd>"
+		} else {
+			valueHTML = valueHTML + "<dd><span class='bare-value'>" + template.HTMLEscapeString(*pair.Value) + "</span></dd>"
+		}
+	}
+	return valueHTML + "</dl>"
+}
+
 func buildCompleteFkHref(databaseName string, fk *schema.Fk, multiFk bool, rowData reader.RowData, displayText string, peekFinder *driver_interface.PeekLookup) string {
 	cssClass := buildFkCss(fk, multiFk)
-	joinedQueryData := buildQueryData(fk, rowData)
+	joinedQueryData := buildQueryData(fk, rowData, peekFinder)
 
 	peekHtml := ""
 	for _, peekColumn := range fk.DestinationTable.PeekColumns {
@@ -475,6 +696,9 @@ func buildFkCss(fk *schema.Fk, multiFkCol bool) string {
 	if multiFkCol {
 		typeString = "multi"
 	}
+	if fk.IsInferred() {
+		typeString = typeString + " inferred"
+	}
 	if len(fk.SourceColumns) > 1 {
 		return "fk compound " + typeString
 	} else {
@@ -490,11 +714,11 @@ func buildFkHref(databaseName string, table *schema.Table, query string, cssClas
 	return fmt.Sprintf("<a href='%s?%s%s' class='%s'>%s%s</a> ", fkUrl, query, suffix, cssClass, template.HTMLEscapeString(displayText), peekHtml)
 }
 
-func buildQueryData(fk *schema.Fk, rowData reader.RowData) string {
+func buildQueryData(fk *schema.Fk, rowData reader.RowData, peekFinder *driver_interface.PeekLookup) string {
 	var queryData []string
 	for ix, fkCol := range fk.DestinationColumns {
 		sourceCol := fk.SourceColumns[ix]
-		fkCellData := rowData[sourceCol.Position]
+		fkCellData := rowData[peekFinder.ColumnIndex(sourceCol)]
 		fkStringValue := *reader.DbValueToString(fkCellData, fkCol.Type)
 		escapedValue := template.URLQueryEscaper(fkStringValue)
 		escapedValue = template.HTMLEscapeString(escapedValue)
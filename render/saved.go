@@ -0,0 +1,31 @@
+package render
+
+import (
+	"github.com/timabell/schema-explorer/saved"
+	"github.com/timabell/schema-explorer/schema"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+type savedViewsViewModel struct {
+	LayoutData PageTemplateModel
+	Database   *schema.Database
+	Views      []*saved.View
+}
+
+func ShowSavedViews(resp http.ResponseWriter, database *schema.Database, views []*saved.View, layoutData PageTemplateModel) error {
+	viewModel := savedViewsViewModel{
+		LayoutData: layoutData,
+		Database:   database,
+		Views:      views,
+	}
+
+	viewModel.LayoutData.Title = fmt.Sprintf("saved views | %s", viewModel.LayoutData.Title)
+
+	err := savedViewsTemplate.ExecuteTemplate(resp, "layout", viewModel)
+	if err != nil {
+		log.Print("template execution error ", err)
+	}
+	return nil
+}
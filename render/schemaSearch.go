@@ -0,0 +1,71 @@
+package render
+
+import (
+	"github.com/timabell/schema-explorer/schema"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+type schemaSearchViewModel struct {
+	LayoutData PageTemplateModel
+	Database   *schema.Database
+	Query      schema.SchemaQuery
+	Nullable   string // "yes", "no" or empty, as submitted
+	TypeNames  []string
+	Searched   bool
+	Matches    []schemaMatchViewModel
+	Error      error
+}
+
+type schemaMatchViewModel struct {
+	schema.SchemaMatch
+	Anchor string // id of the matching row on the table page
+	Label  string
+}
+
+// Shows schema items matching the query, nothing is searched until there is some text or a column filter
+func ShowSchemaSearch(resp http.ResponseWriter, database *schema.Database, query schema.SchemaQuery, nullable string, layoutData PageTemplateModel) error {
+	viewModel := schemaSearchViewModel{
+		LayoutData: layoutData,
+		Database:   database,
+		Query:      query,
+		Nullable:   nullable,
+		TypeNames:  database.TypeNames(),
+		Searched:   query.Text != "" || query.HasColumnFilters(),
+	}
+	if viewModel.Searched {
+		matches, err := database.SearchSchema(query)
+		viewModel.Error = err
+		for _, match := range matches {
+			label := match.Text
+			if match.Kind == schema.ColumnDescriptionMatch {
+				label = match.Column.Name + ": " + match.Text
+			}
+			viewModel.Matches = append(viewModel.Matches, schemaMatchViewModel{SchemaMatch: match, Anchor: schemaMatchAnchor(match), Label: label})
+		}
+	}
+
+	viewModel.LayoutData.Title = fmt.Sprintf("schema search | %s", viewModel.LayoutData.Title)
+
+	err := schemaSearchTemplate.ExecuteTemplate(resp, "layout", viewModel)
+	if err != nil {
+		log.Print("template execution error ", err)
+	}
+	return nil
+}
+
+// must match the row ids in table.tmpl
+func schemaMatchAnchor(match schema.SchemaMatch) string {
+	switch match.Kind {
+	case schema.ColumnMatch, schema.ColumnDescriptionMatch:
+		return "col_" + match.Column.Name
+	case schema.IndexMatch:
+		return "index_" + match.Index.Name
+	case schema.FkMatch:
+		return "fk_" + match.Fk.Name
+	case schema.TableDescriptionMatch:
+		return "description"
+	}
+	return ""
+}
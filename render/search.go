@@ -0,0 +1,55 @@
+package render
+
+import (
+	"github.com/timabell/schema-explorer/params"
+	"github.com/timabell/schema-explorer/reader"
+	"github.com/timabell/schema-explorer/schema"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+)
+
+type searchViewModel struct {
+	LayoutData PageTemplateModel
+	Database   *schema.Database
+	Value      string
+	Searched   bool // false until a value has been entered
+	Columns    int  // columns that could hold the value
+	Result     reader.SearchResult
+	Hits       []searchHitViewModel
+}
+
+type searchHitViewModel struct {
+	reader.SearchHit
+	RowsUrl template.URL
+}
+
+// Shows the columns holding the value, result is ignored if value is empty
+func ShowSearch(resp http.ResponseWriter, database *schema.Database, value string, columns int, result reader.SearchResult, layoutData PageTemplateModel) error {
+	viewModel := searchViewModel{
+		LayoutData: layoutData,
+		Database:   database,
+		Value:      value,
+		Searched:   value != "",
+		Columns:    columns,
+		Result:     result,
+	}
+	for _, hit := range result.Hits {
+		filter := params.FieldFilterList{{Field: hit.Column, Values: []string{value}}}
+		var pairs = []string{"tableName", hit.Table.String()}
+		rowsUrl := urlBuilder("route-database-tables", database.Name, pairs)
+		viewModel.Hits = append(viewModel.Hits, searchHitViewModel{
+			SearchHit: hit,
+			RowsUrl:   template.URL(fmt.Sprintf("%s?%s&_rowLimit=100#data", rowsUrl, filter.AsQueryString())),
+		})
+	}
+
+	viewModel.LayoutData.Title = fmt.Sprintf("search | %s", viewModel.LayoutData.Title)
+
+	err := searchTemplate.ExecuteTemplate(resp, "layout", viewModel)
+	if err != nil {
+		log.Print("template execution error ", err)
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package render
+
+import (
+	"github.com/timabell/schema-explorer/driver_interface"
+	"github.com/timabell/schema-explorer/params"
+	"github.com/timabell/schema-explorer/reader"
+	"github.com/timabell/schema-explorer/schema"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"math"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Small drawing of the shape alongside its well-known text
+func buildSpatialCell(cellData interface{}, dataType schema.DataType) string {
+	geometry, err := reader.DecodeSpatialValue(cellData, dataType)
+	if err != nil {
+		return "<span class='bare-value'>" + template.HTMLEscapeString(*reader.DbValueToString(cellData, dataType)) + "</span> "
+	}
+	wkt := geometry.Wkt()
+	valueHTML := "<span class='spatial-value'>" + buildSpatialSvg(geometry)
+	if preview, truncated := truncatePreview(wkt); truncated {
+		valueHTML = valueHTML + fmt.Sprintf("<details><summary>%s</summary><code>%s</code></details>", template.HTMLEscapeString(preview), template.HTMLEscapeString(wkt))
+	} else {
+		valueHTML = valueHTML + "<code>" + template.HTMLEscapeString(wkt) + "</code>"
+	}
+	if geometry.Srid != 0 {
+		valueHTML = valueHTML + fmt.Sprintf(" <span class='srid'>SRID %d</span>", geometry.Srid)
+	}
+	return valueHTML + "</span>"
+}
+
+// Svg scaled to fit the shape, empty if there's nothing to draw
+func buildSpatialSvg(geometry *reader.Geometry) string {
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	geometry.EachPoint(func(point []float64) {
+		minX = math.Min(minX, point[0])
+		minY = math.Min(minY, point[1])
+		maxX = math.Max(maxX, point[0])
+		maxY = math.Max(maxY, point[1])
+	})
+	if math.IsInf(minX, 1) {
+		return ""
+	}
+	size := math.Max(maxX-minX, maxY-minY)
+	if size == 0 {
+		size = 1 // a single point, any scale will do
+	}
+	padding := size * 0.1
+	// svg's y axis points down so y values are negated to keep north at the top
+	viewBox := []string{
+		formatSvgNumber(minX - padding),
+		formatSvgNumber(-maxY - padding),
+		formatSvgNumber(maxX - minX + 2*padding),
+		formatSvgNumber(maxY - minY + 2*padding),
+	}
+	pointRadius := (size + 2*padding) * 0.03
+	var shapes strings.Builder
+	writeSvgShapes(&shapes, geometry, pointRadius)
+	return fmt.Sprintf("<svg class='spatial-preview' viewBox='%s' preserveAspectRatio='xMidYMid meet'>%s</svg>", strings.Join(viewBox, " "), shapes.String())
+}
+
+func writeSvgShapes(shapes *strings.Builder, geometry *reader.Geometry, pointRadius float64) {
+	switch geometry.Type {
+	case "Point":
+		for _, point := range geometry.Points {
+			shapes.WriteString(fmt.Sprintf("<circle cx='%s' cy='%s' r='%s'/>", formatSvgNumber(point[0]), formatSvgNumber(-point[1]), formatSvgNumber(pointRadius)))
+		}
+	case "LineString":
+		shapes.WriteString("<polyline points='" + svgPointList(geometry.Points) + "' vector-effect='non-scaling-stroke'/>")
+	case "Polygon":
+		var path []string
+		for _, ring := range geometry.Rings {
+			path = append(path, "M"+svgPointList(ring)+"Z")
+		}
+		shapes.WriteString("<path d='" + strings.Join(path, " ") + "' fill-rule='evenodd' vector-effect='non-scaling-stroke'/>")
+	default:
+		for _, part := range geometry.Geometries {
+			writeSvgShapes(shapes, part, pointRadius)
+		}
+	}
+}
+
+func svgPointList(points [][]float64) string {
+	var pairs []string
+	for _, point := range points {
+		pairs = append(pairs, formatSvgNumber(point[0])+","+formatSvgNumber(-point[1]))
+	}
+	return strings.Join(pairs, " ")
+}
+
+func formatSvgNumber(value float64) string {
+	if value == 0 {
+		value = 0 // avoid "-0" from negating y values
+	}
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// Writes the filtered rows of a table as a GeoJSON FeatureCollection, using geometryColumn for the shapes
+// and the rest of the shown columns as properties.
+func ShowGeoJson(resp http.ResponseWriter, dbReader driver_interface.DbReader, database *schema.Database, table *schema.Table, geometryColumn *schema.Column, tableParams *params.TableParams) error {
+	exportParams := tableParams.ShowColumn(table, geometryColumn)
+	rowsData, peekFinder, err := reader.GetRows(dbReader, database.Name, table, &exportParams)
+	if err != nil {
+		return err
+	}
+	features := []interface{}{}
+	for _, rowData := range rowsData {
+		var geometry interface{} // null geometry is allowed for features without a location
+		geometryData := rowData[peekFinder.ColumnIndex(geometryColumn)]
+		if geometryData != nil {
+			decoded, err := reader.DecodeSpatialValue(geometryData, geometryColumn.Type)
+			if err != nil {
+				return err
+			}
+			geometry = decoded.GeoJson()
+		}
+		properties := map[string]interface{}{}
+		for _, col := range exportParams.ShownColumns(table) {
+			if col == geometryColumn || col.Type.IsBinary() {
+				continue
+			}
+			// any other spatial columns come out as well-known text as a feature can only have one geometry
+			properties[col.Name] = reader.DbValueToString(rowData[peekFinder.ColumnIndex(col)], col.Type)
+		}
+		features = append(features, map[string]interface{}{"type": "Feature", "geometry": geometry, "properties": properties})
+	}
+	fileName := fmt.Sprintf("%s.%s.geojson", table.Name, geometryColumn.Name)
+	resp.Header().Set("Content-Type", "application/geo+json")
+	resp.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": fileName}))
+	return json.NewEncoder(resp).Encode(map[string]interface{}{"type": "FeatureCollection", "features": features})
+}
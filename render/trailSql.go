@@ -0,0 +1,89 @@
+package render
+
+import (
+	"github.com/timabell/schema-explorer/driver_interface"
+	"github.com/timabell/schema-explorer/schema"
+	"github.com/timabell/schema-explorer/trail"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+)
+
+type trailSqlViewModel struct {
+	LayoutData     PageTemplateModel
+	Trail          *trail.TrailLog
+	WithFilters    bool
+	Tables         []driver_interface.JoinedTable
+	Unjoined       []*schema.Table
+	Filters        []driver_interface.JoinFilter
+	SkippedFilters []string     // filters of the last page that aren't plain column values, e.g. on peeked values
+	FiltersQuery   template.URL // for linking back to the filtered page
+	Sql            string
+}
+
+// Shows a select joining the trail's tables along fks, optionally filtered like the last data page visited
+func ShowTrailSql(resp http.ResponseWriter, dbReader driver_interface.DbReader, database *schema.Database, trailInfo *trail.TrailLog, withFilters bool, layoutData PageTemplateModel) error {
+	var tables []*schema.Table
+	for _, x := range trailInfo.Tables {
+		tableStub := schema.TableFromString(x)
+		table := database.FindTable(&tableStub)
+		if table != nil { // this will happen if schema has changed since cookie was set
+			tables = append(tables, table)
+		}
+	}
+	join, unjoined := driver_interface.JoinQueryForTables(database, tables)
+
+	viewModel := trailSqlViewModel{
+		LayoutData:  layoutData,
+		Trail:       trailInfo,
+		WithFilters: withFilters,
+		Tables:      join.Tables,
+		Unjoined:    unjoined,
+	}
+
+	if withFilters && trailInfo.Filters != "" {
+		filters, err := url.ParseQuery(trailInfo.Filters)
+		if err != nil {
+			log.Print("failed to read trail filters ", err)
+		}
+		tableStub := schema.TableFromString(trailInfo.FiltersTable)
+		filtersTable := database.FindTable(&tableStub)
+		tableIndex := -1
+		for ix, joined := range join.Tables {
+			if filtersTable != nil && joined.Table == filtersTable {
+				tableIndex = ix
+			}
+		}
+		for key, values := range filters {
+			var col *schema.Column
+			if tableIndex >= 0 {
+				_, col = filtersTable.FindColumn(key)
+			}
+			if col == nil || len(values) == 0 {
+				viewModel.SkippedFilters = append(viewModel.SkippedFilters, key)
+				continue
+			}
+			join.Filters = append(join.Filters, driver_interface.JoinFilter{TableIndex: tableIndex, Column: col, Value: values[0]})
+		}
+		// map order isn't stable, keep the sql the same each time
+		sort.Slice(join.Filters, func(i, j int) bool { return join.Filters[i].Column.Name < join.Filters[j].Column.Name })
+		sort.Strings(viewModel.SkippedFilters)
+		viewModel.Filters = join.Filters
+		viewModel.FiltersQuery = template.URL(trailInfo.Filters)
+	}
+
+	if len(join.Tables) > 0 {
+		viewModel.Sql = dbReader.GetJoinSql(database.Name, join)
+	}
+
+	viewModel.LayoutData.Title = fmt.Sprintf("trail sql | %s", viewModel.LayoutData.Title)
+
+	err := trailSqlTemplate.ExecuteTemplate(resp, "layout", viewModel)
+	if err != nil {
+		log.Print("template execution error ", err)
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+package saved
+
+// Table views and queries that users have saved under a name so they can get back to them or share them by url.
+// They are kept in a sqlite file on the machine running schema explorer rather than in the database being explored,
+// which is often read-only or not ours to add tables to.
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Either a table view or a query, a table view has Table set
+type View struct {
+	Id          string
+	Database    string // empty when the driver only connects to one database
+	Name        string
+	Description string
+	Table       string // schema qualified table name of a table view
+	TableParams string // filters, sort and columns of a table view as a query string
+	Sql         string // the query if this isn't a table view
+	Created     time.Time
+}
+
+func (view View) IsTableView() bool {
+	return view.Table != ""
+}
+
+type Store struct {
+	path string
+	dbc  *sql.DB
+}
+
+const createTableSql = `create table if not exists saved_view(
+	id text primary key,
+	database_name text not null,
+	name text not null,
+	description text not null,
+	table_name text not null,
+	table_params text not null,
+	sql text not null,
+	created datetime not null
+)`
+
+const selectViewSql = "select id, database_name, name, description, table_name, table_params, sql, created from saved_view"
+
+// The file used when the saved-views-path option isn't set
+func DefaultPath() string {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "schemaexplorer-saved-views.db"
+	}
+	return filepath.Join(configDir, "schemaexplorer", "saved-views.db")
+}
+
+// Opens the sqlite file at path, creating it if there isn't one yet
+func Open(path string) (store *Store, err error) {
+	if !sqliteLinked() {
+		return nil, errors.New("saved views are kept in sqlite, which isn't included in this build of schema explorer")
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return
+	}
+	dbc, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("failed to open saved views file %s: %s", path, err))
+	}
+	// one connection so saves from concurrent requests queue up instead of finding the file locked
+	dbc.SetMaxOpenConns(1)
+	_, err = dbc.Exec(createTableSql)
+	if err != nil {
+		dbc.Close()
+		return nil, errors.New(fmt.Sprintf("failed to read saved views from %s: %s", path, err))
+	}
+	return &Store{path: path, dbc: dbc}, nil
+}
+
+func (store *Store) Close() error {
+	return store.dbc.Close()
+}
+
+// The views saved for the database, by name
+func (store *Store) ForDatabase(databaseName string) (views []*View, err error) {
+	rows, err := store.dbc.Query(selectViewSql+" where database_name = ? order by lower(name), created", databaseName)
+	if err != nil {
+		log.Print("ForDatabase failed to read saved views from ", store.path)
+		log.Println(err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		view, err := scanView(rows)
+		if err != nil {
+			return nil, err
+		}
+		views = append(views, view)
+	}
+	err = rows.Err()
+	return
+}
+
+// nil if there's no view with the id saved for the database
+func (store *Store) Find(databaseName string, id string) (view *View, err error) {
+	rows, err := store.dbc.Query(selectViewSql+" where database_name = ? and id = ?", databaseName, id)
+	if err != nil {
+		log.Print("Find failed to read saved views from ", store.path)
+		log.Println(err)
+		return
+	}
+	defer rows.Close()
+	if rows.Next() {
+		return scanView(rows)
+	}
+	err = rows.Err()
+	return
+}
+
+// Gives the view a new id and saves it
+func (store *Store) Add(view View) (added *View, err error) {
+	view.Name = strings.TrimSpace(view.Name)
+	view.Description = strings.TrimSpace(view.Description)
+	if view.Name == "" {
+		return nil, errors.New("a saved view needs a name")
+	}
+	if view.Table == "" && strings.TrimSpace(view.Sql) == "" {
+		return nil, errors.New("a saved view needs a table or a query")
+	}
+	view.Id, err = newId()
+	if err != nil {
+		return
+	}
+	view.Created = time.Now()
+
+	_, err = store.dbc.Exec("insert into saved_view(id, database_name, name, description, table_name, table_params, sql, created) values (?, ?, ?, ?, ?, ?, ?, ?)",
+		view.Id, view.Database, view.Name, view.Description, view.Table, view.TableParams, view.Sql, view.Created)
+	if err != nil {
+		log.Print("Add failed to save view to ", store.path)
+		log.Println(err)
+		return
+	}
+	return &view, nil
+}
+
+// False if there was no such view
+func (store *Store) Delete(databaseName string, id string) (deleted bool, err error) {
+	result, err := store.dbc.Exec("delete from saved_view where database_name = ? and id = ?", databaseName, id)
+	if err != nil {
+		log.Print("Delete failed to delete view from ", store.path)
+		log.Println(err)
+		return
+	}
+	rowCount, err := result.RowsAffected()
+	return rowCount > 0, err
+}
+
+func scanView(rows *sql.Rows) (*View, error) {
+	view := &View{}
+	err := rows.Scan(&view.Id, &view.Database, &view.Name, &view.Description, &view.Table, &view.TableParams, &view.Sql, &view.Created)
+	if err != nil {
+		return nil, err
+	}
+	return view, nil
+}
+
+// The driver is only linked in where the sqlite package is, see sqlite.go
+func sqliteLinked() bool {
+	for _, driver := range sql.Drivers() {
+		if driver == "sqlite3" {
+			return true
+		}
+	}
+	return false
+}
+
+// Random rather than sequential so the urls of views can't be guessed from each other
+func newId() (string, error) {
+	bytes := make([]byte, 8)
+	_, err := rand.Read(bytes)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(bytes), nil
+}
@@ -0,0 +1,10 @@
+// +build !darwin
+// +build !skip_sqlite
+
+// go-sqlite3 is excluded the same way as the sqlite driver, without it saved views can't be opened.
+
+package saved
+
+import (
+	_ "github.com/mattn/go-sqlite3"
+)
@@ -1,11 +1,70 @@
 package schema
 
+import (
+	"fmt"
+)
+
 type ColumnAnalysis struct {
-	Column      *Column
-	ValueCounts []ValueInfo
+	Column        *Column
+	ValueCounts   []ValueInfo
+	Sample        AnalysisSample // the part of the table that was analysed
+	RowCount      int
+	NullCount     int
+	DistinctCount int
+	Min           interface{} // numeric, text and temporal columns only
+	Max           interface{}
+	Average       *float64 // numeric columns only
+	StdDev        *float64 // population standard deviation
+	MinLength     *int     // text columns only
+	MaxLength     *int
+	LengthCounts  []ValueInfo // text columns, rows per value length, most common 100 lengths
+	DateCounts    []ValueInfo // temporal columns, rows per month as yyyy-mm, earliest first
+}
+
+// How much of a table to analyse, the zero value is the whole table
+type AnalysisSample struct {
+	FirstRows int // just the first n rows as read, quick but biased towards whichever rows are stored first
+	Percent   int // a random percentage of the table's pages, where supported
+}
+
+// Seed for the drivers' tablesample so that the separate queries of an analysis, and each column, read the same pages
+const AnalysisSampleSeed = 1
+
+func (sample AnalysisSample) IsWholeTable() bool {
+	return sample.FirstRows == 0 && sample.Percent == 0
+}
+
+func (sample AnalysisSample) String() string {
+	switch {
+	case sample.Percent > 0:
+		return fmt.Sprintf("a random %d%% of the table", sample.Percent)
+	case sample.FirstRows > 0:
+		return fmt.Sprintf("the first %d rows", sample.FirstRows)
+	}
+	return "the whole table"
 }
 
 type ValueInfo struct {
 	Value    interface{}
 	Quantity int
 }
+
+// Rows whose fk values have no matching row in the destination table
+type FkOrphans struct {
+	Fk          *Fk
+	RowCount    int           // total orphaned rows
+	ValueCounts []OrphanValue // most common missing values first
+}
+
+// One combination of missing fk values, in the order of Fk.SourceColumns
+type OrphanValue struct {
+	Values   []interface{}
+	Quantity int
+}
+
+// Rows sharing one combination of group by values
+type GroupCount struct {
+	Values     []interface{} // value of each group by column
+	PeekValues []interface{} // value of the peek column for group by columns that peek through an fk, otherwise nil
+	Quantity   int
+}
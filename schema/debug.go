@@ -25,7 +25,7 @@ func (database Database) DebugString() string {
 			buffer.WriteString("  - '")
 			buffer.WriteString(col.Name)
 			buffer.WriteString("'\t")
-			buffer.WriteString(col.Type)
+			buffer.WriteString(col.Type.String())
 			buffer.WriteString("\t")
 			buffer.WriteString(fmt.Sprintf("%p", col))
 			buffer.WriteString("\t\"")
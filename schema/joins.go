@@ -0,0 +1,114 @@
+package schema
+
+// Finding how to get from one table to another along the fks, for writing queries that join them.
+
+// Joining along an fk, either from its source table to its destination (forward) or back the other way
+type JoinStep struct {
+	Fk      *Fk
+	Forward bool
+}
+
+type JoinPath []JoinStep
+
+func (step JoinStep) From() *Table {
+	if step.Forward {
+		return step.Fk.SourceTable
+	}
+	return step.Fk.DestinationTable
+}
+
+func (step JoinStep) To() *Table {
+	if step.Forward {
+		return step.Fk.DestinationTable
+	}
+	return step.Fk.SourceTable
+}
+
+// The columns of the From and To tables that are equal when joined, in matching order
+func (step JoinStep) FromColumns() ColumnList {
+	if step.Forward {
+		return step.Fk.SourceColumns
+	}
+	return step.Fk.DestinationColumns
+}
+
+func (step JoinStep) ToColumns() ColumnList {
+	if step.Forward {
+		return step.Fk.DestinationColumns
+	}
+	return step.Fk.SourceColumns
+}
+
+// The tables along the path, starting with the table it's from
+func (path JoinPath) Tables() (tables []*Table) {
+	for ix, step := range path {
+		if ix == 0 {
+			tables = append(tables, step.From())
+		}
+		tables = append(tables, step.To())
+	}
+	return
+}
+
+// The shortest paths from one table to another along fks in either direction, up to maxPaths of them
+// if there's more than one the same length, e.g. where two fks join the same tables.
+// Nil if the tables aren't connected, a single empty path if they're the same table.
+func (database Database) FindJoinPaths(from *Table, to *Table, maxPaths int) (paths []JoinPath) {
+	if from == to {
+		return []JoinPath{{}}
+	}
+	// each table's neighbours, with how to get there
+	steps := map[*Table][]JoinStep{}
+	for _, fk := range database.Fks {
+		if fk.SourceTable == fk.DestinationTable {
+			continue // never on a shortest path
+		}
+		steps[fk.SourceTable] = append(steps[fk.SourceTable], JoinStep{Fk: fk, Forward: true})
+		steps[fk.DestinationTable] = append(steps[fk.DestinationTable], JoinStep{Fk: fk, Forward: false})
+	}
+
+	// breadth first from the start, keeping every step that reaches a table at its shortest distance
+	distance := map[*Table]int{from: 0}
+	arrivals := map[*Table][]JoinStep{}
+	current := []*Table{from}
+	for len(current) > 0 {
+		if _, found := distance[to]; found {
+			break
+		}
+		var next []*Table
+		for _, table := range current {
+			for _, step := range steps[table] {
+				reached := step.To()
+				reachedDistance, seen := distance[reached]
+				if !seen {
+					distance[reached] = distance[table] + 1
+					next = append(next, reached)
+				} else if reachedDistance != distance[table]+1 {
+					continue
+				}
+				arrivals[reached] = append(arrivals[reached], step)
+			}
+		}
+		current = next
+	}
+	if _, found := distance[to]; !found {
+		return nil
+	}
+
+	// walk back from the destination through every way of arriving at each table
+	var walkBack func(table *Table, rest JoinPath)
+	walkBack = func(table *Table, rest JoinPath) {
+		if len(paths) >= maxPaths {
+			return
+		}
+		if table == from {
+			paths = append(paths, rest)
+			return
+		}
+		for _, step := range arrivals[table] {
+			walkBack(step.From(), append(JoinPath{step}, rest...))
+		}
+	}
+	walkBack(to, JoinPath{})
+	return
+}
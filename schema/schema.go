@@ -10,6 +10,8 @@ type SupportedFeatures struct {
 	Descriptions         bool
 	FkNames              bool
 	PagingWithoutSorting bool
+	JsonFilter           bool // can filter on a value inside a json column
+	TableSample          bool // can analyse a random sample of a table's pages
 }
 
 type Database struct {
@@ -44,17 +46,35 @@ func (index Index) String() string {
 	return fmt.Sprintf("%sIndex %s on %s(%s)", unique, index.Name, index.Table.String(), index.Columns.String())
 }
 
+type CheckConstraint struct {
+	Name   string
+	Clause string // the check expression as reported by the database, e.g. "(size > 0)"
+	Table  *Table
+}
+
+type UniqueConstraint struct {
+	Name    string
+	Columns ColumnList
+	Table   *Table
+}
+
+func (constraint UniqueConstraint) String() string {
+	return fmt.Sprintf("Unique constraint %s on %s(%s)", constraint.Name, constraint.Table.String(), constraint.Columns.String())
+}
+
 type Table struct {
-	Schema      string
-	Name        string
-	Columns     ColumnList
-	Pk          *Pk
-	Fks         []*Fk
-	InboundFks  []*Fk
-	Indexes     []*Index
-	Description string
-	RowCount    *int       // pointer to allow us to tell the difference between zero and unknown
-	PeekColumns ColumnList // list of columns to show as a preview when this is a target for a join, e.g. the "Name" column. The schema readers are not expected to populate this field.
+	Schema            string
+	Name              string
+	Columns           ColumnList
+	Pk                *Pk
+	Fks               []*Fk
+	InboundFks        []*Fk
+	Indexes           []*Index
+	CheckConstraints  []*CheckConstraint
+	UniqueConstraints []*UniqueConstraint
+	Description       string
+	RowCount          *int       // pointer to allow us to tell the difference between zero and unknown
+	PeekColumns       ColumnList // list of columns to show as a preview when this is a target for a join, e.g. the "Name" column. The schema readers are not expected to populate this field.
 }
 
 type TableList []*Table
@@ -72,16 +92,68 @@ func (tables TableList) Less(i, j int) bool {
 
 type ColumnList []*Column
 
+// How a driver hands back the values of geometry/geography columns
+type SpatialEncoding int
+
+const (
+	NotSpatial       SpatialEncoding = iota
+	PostgisHexEwkb                   // PostGIS, hex of extended well-known binary (wkb with the srid embedded)
+	MysqlGeometry                    // 4 byte srid followed by well-known binary
+	MssqlClrGeometry                 // sql server's own serialization of its geometry/geography clr types
+)
+
+// Type of a column as read from the database catalog.
+// Drivers only populate the size fields that would appear in the column definition,
+// e.g. Precision and Scale for "numeric(10,2)", but not the implied precision of an int.
+type DataType struct {
+	Name        string    // base type name without size info, as reported by the database, e.g. "varchar", "numeric", "int4"
+	MaxLength   *int      // character/byte length limit, nil if not applicable, negative for unbounded e.g. varchar(max)
+	Precision   *int      // total digits for exact numerics, nil if not applicable
+	Scale       *int      // digits after the decimal point, nil if not applicable (zero is a valid scale)
+	Collation   string    // only populated where the database reports one for the column
+	FullName    string    // the whole type as the database shows it, where that's more than Name and the sizes, e.g. pg's "timestamp(3) with time zone"
+	ElementType *DataType // non-nil for array types, the type of the items in the array
+	EnumValues  []string  // permitted values for enum types, in the order they were declared
+	IsSet       bool      // mysql SET, values are a comma separated combination of EnumValues
+	IsRange     bool      // pg range types such as int4range, values look like [1,10)
+	IsComposite bool      // pg composite (row) types, values look like (1,"a b")
+	IsJson      bool      // json types, and text columns known to hold json (mssql ISJSON check constraint)
+	Spatial     SpatialEncoding
+}
+
 type Column struct {
-	Position       int
-	Name           string
-	Type           string
-	Fks            []*Fk
-	InboundFks     []*Fk
-	Indexes        []*Index
-	Description    string
-	IsInPrimaryKey bool
-	Nullable       bool
+	Position            int
+	Name                string
+	Type                DataType
+	Fks                 []*Fk
+	InboundFks          []*Fk
+	Indexes             []*Index
+	Description         string
+	IsInPrimaryKey      bool
+	Nullable            bool
+	Default             string // default value expression as reported by the database, empty if there isn't one
+	IsIdentity          bool   // value is generated by the database on insert, i.e. identity / auto_increment / serial
+	IsGenerated         bool   // computed column, value is derived from GeneratedExpression
+	GeneratedExpression string
+}
+
+// Where a relationship came from
+type FkOrigin int
+
+const (
+	DeclaredFk FkOrigin = iota // a foreign key constraint in the database
+	InferredFk                 // guessed from column naming conventions, not enforced by the database
+	VirtualFk                  // listed in the virtual relationships config file, not enforced by the database
+)
+
+func (origin FkOrigin) String() string {
+	switch origin {
+	case InferredFk:
+		return "inferred"
+	case VirtualFk:
+		return "virtual"
+	}
+	return "declared"
 }
 
 type Fk struct {
@@ -91,6 +163,8 @@ type Fk struct {
 	SourceColumns      ColumnList
 	DestinationTable   *Table
 	DestinationColumns ColumnList
+	Origin             FkOrigin
+	NotTrusted         bool // disabled or added without checking existing rows, e.g. mssql "with nocheck"
 }
 
 // Simplified fk constructor for single-column foreign keys
@@ -122,10 +196,113 @@ func (columns ColumnList) String() string {
 	return strings.Join(columnNames, ",")
 }
 
+func (columns ColumnList) IndexOf(column *Column) int {
+	for index, col := range columns {
+		if col == column {
+			return index
+		}
+	}
+	return -1
+}
+
+func (columns ColumnList) Contains(column *Column) bool {
+	return columns.IndexOf(column) >= 0
+}
+
+// Full type as it would appear in a column definition, e.g. "varchar(50)", "numeric(10,2)", "int4[]"
+func (dataType DataType) String() string {
+	if dataType.FullName != "" {
+		return dataType.FullName
+	}
+	if dataType.ElementType != nil {
+		return dataType.ElementType.String() + "[]"
+	}
+	switch {
+	case dataType.Precision != nil && dataType.Scale != nil:
+		return fmt.Sprintf("%s(%d,%d)", dataType.Name, *dataType.Precision, *dataType.Scale)
+	case dataType.Precision != nil:
+		return fmt.Sprintf("%s(%d)", dataType.Name, *dataType.Precision)
+	case dataType.MaxLength != nil && *dataType.MaxLength < 0:
+		return fmt.Sprintf("%s(max)", dataType.Name)
+	case dataType.MaxLength != nil:
+		return fmt.Sprintf("%s(%d)", dataType.Name, *dataType.MaxLength)
+	}
+	return dataType.Name
+}
+
+func (dataType DataType) IsArray() bool {
+	return dataType.ElementType != nil
+}
+
+// True if a value must be exactly one of EnumValues, so it makes sense to offer them as a filter list
+func (dataType DataType) IsEnum() bool {
+	return len(dataType.EnumValues) > 0 && !dataType.IsSet
+}
+
+// Geometry/geography types, values are decoded to well-known text for display
+func (dataType DataType) IsSpatial() bool {
+	return dataType.Spatial != NotSpatial
+}
+
+// Raw byte types, shown as hex and offered as a download rather than displayed as text
+func (dataType DataType) IsBinary() bool {
+	switch strings.ToLower(dataType.Name) {
+	case "bytea", "blob", "tinyblob", "mediumblob", "longblob", "binary", "varbinary", "image":
+		return true
+	}
+	return false
+}
+
+// Number types that min/max/average make sense for
+func (dataType DataType) IsNumeric() bool {
+	if dataType.IsArray() {
+		return false
+	}
+	switch strings.ToLower(dataType.Name) {
+	case "int", "integer", "int2", "int4", "int8", "smallint", "mediumint", "bigint", "tinyint",
+		"decimal", "numeric", "real", "float", "float4", "float8", "double", "double precision", "money", "smallmoney":
+		return true
+	}
+	return false
+}
+
+// Character types, analysed by value length
+func (dataType DataType) IsText() bool {
+	if dataType.IsArray() || len(dataType.EnumValues) > 0 {
+		return false
+	}
+	switch strings.ToLower(dataType.Name) {
+	case "char", "varchar", "text", "nchar", "nvarchar", "bpchar", "character", "character varying",
+		"tinytext", "mediumtext", "longtext", "citext", "clob":
+		return true
+	}
+	return false
+}
+
+// Types holding a date (with or without a time), analysed by month
+func (dataType DataType) IsTemporal() bool {
+	if dataType.IsArray() {
+		return false
+	}
+	switch strings.ToLower(dataType.Name) {
+	case "date", "datetime", "datetime2", "smalldatetime", "datetimeoffset", "timestamp", "timestamptz":
+		return true
+	}
+	return false
+}
+
 func (column Column) String() string {
 	return column.Name
 }
 
+func (fk Fk) IsInferred() bool {
+	return fk.Origin == InferredFk
+}
+
+func (fk Fk) IsVirtual() bool {
+	return fk.Origin == VirtualFk
+}
+
 func (fk Fk) String() string {
 	return fmt.Sprintf("%s %s(%s) => %s(%s)", fk.Name, fk.SourceTable, fk.SourceColumns.String(), fk.DestinationTable, fk.DestinationColumns.String())
 }
@@ -141,6 +318,26 @@ func (database Database) FindTable(tableToFind *Table) (table *Table) {
 	return nil
 }
 
+// columns that are shown as json and can be filtered on a json path
+func (table Table) JsonColumns() (columns ColumnList) {
+	for _, col := range table.Columns {
+		if col.Type.IsJson {
+			columns = append(columns, col)
+		}
+	}
+	return
+}
+
+// columns that can be exported as GeoJSON
+func (table Table) SpatialColumns() (columns ColumnList) {
+	for _, col := range table.Columns {
+		if col.Type.IsSpatial() {
+			columns = append(columns, col)
+		}
+	}
+	return
+}
+
 func (table Table) FindColumn(columnName string) (index int, column *Column) {
 	for index, col := range table.Columns {
 		if col.Name == columnName {
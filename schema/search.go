@@ -0,0 +1,148 @@
+package schema
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+type SchemaMatchKind int
+
+const (
+	TableMatch SchemaMatchKind = iota
+	ColumnMatch
+	IndexMatch
+	FkMatch
+	TableDescriptionMatch
+	ColumnDescriptionMatch
+)
+
+func (kind SchemaMatchKind) String() string {
+	switch kind {
+	case ColumnMatch:
+		return "column"
+	case IndexMatch:
+		return "index"
+	case FkMatch:
+		return "foreign key"
+	case TableDescriptionMatch:
+		return "table description"
+	case ColumnDescriptionMatch:
+		return "column description"
+	}
+	return "table"
+}
+
+type SchemaQuery struct {
+	Text     string // substring to find, ignoring case, or a regex if IsRegex is set
+	IsRegex  bool
+	TypeName string // only columns whose type contains this, ignoring case, e.g. "char" for char/varchar/nvarchar
+	Nullable *bool  // only columns with this nullability
+}
+
+// Setting a type or nullability means only columns are of interest
+func (query SchemaQuery) HasColumnFilters() bool {
+	return query.TypeName != "" || query.Nullable != nil
+}
+
+type SchemaMatch struct {
+	Kind   SchemaMatchKind
+	Table  *Table
+	Column *Column // for column and column description matches
+	Index  *Index
+	Fk     *Fk
+	Text   string // the name or description that matched
+}
+
+// Finds tables, columns, indexes, fks and descriptions matching the query, in table order.
+// An empty Text matches everything, which is only useful along with the column filters.
+func (database Database) SearchSchema(query SchemaQuery) (matches []SchemaMatch, err error) {
+	isMatch, err := query.matcher()
+	if err != nil {
+		return
+	}
+	columnsOnly := query.HasColumnFilters()
+	for _, table := range database.Tables {
+		if !columnsOnly {
+			if isMatch(table.String()) {
+				matches = append(matches, SchemaMatch{Kind: TableMatch, Table: table, Text: table.String()})
+			}
+			if table.Description != "" && isMatch(table.Description) {
+				matches = append(matches, SchemaMatch{Kind: TableDescriptionMatch, Table: table, Text: table.Description})
+			}
+		}
+		for _, col := range table.Columns {
+			if !query.columnFiltersMatch(col) {
+				continue
+			}
+			if isMatch(col.Name) {
+				matches = append(matches, SchemaMatch{Kind: ColumnMatch, Table: table, Column: col, Text: col.Name})
+			}
+			if col.Description != "" && isMatch(col.Description) {
+				matches = append(matches, SchemaMatch{Kind: ColumnDescriptionMatch, Table: table, Column: col, Text: col.Description})
+			}
+		}
+		if columnsOnly {
+			continue
+		}
+		for _, index := range table.Indexes {
+			if isMatch(index.Name) {
+				matches = append(matches, SchemaMatch{Kind: IndexMatch, Table: table, Index: index, Text: index.Name})
+			}
+		}
+		for _, fk := range table.Fks {
+			if isMatch(fk.Name) {
+				matches = append(matches, SchemaMatch{Kind: FkMatch, Table: table, Fk: fk, Text: fk.Name})
+			}
+		}
+	}
+	return
+}
+
+func (query SchemaQuery) matcher() (isMatch func(string) bool, err error) {
+	if query.IsRegex {
+		regex, regexErr := regexp.Compile("(?i)" + query.Text)
+		if regexErr != nil {
+			err = errors.New(fmt.Sprintf("invalid regex %s: %s", query.Text, regexErr))
+			return
+		}
+		isMatch = regex.MatchString
+		return
+	}
+	text := strings.ToLower(query.Text)
+	isMatch = func(value string) bool {
+		return strings.Contains(strings.ToLower(value), text)
+	}
+	return
+}
+
+func (query SchemaQuery) columnFiltersMatch(col *Column) bool {
+	if query.Nullable != nil && col.Nullable != *query.Nullable {
+		return false
+	}
+	// either of pg's names for a type finds it, e.g. varchar or character varying
+	typeName := strings.ToLower(query.TypeName)
+	if typeName != "" && !strings.Contains(strings.ToLower(col.Type.String()), typeName) && !strings.Contains(strings.ToLower(col.Type.Name), typeName) {
+		return false
+	}
+	return true
+}
+
+// Distinct base type names of all the columns in alphabetical order, for suggesting type filters
+func (database Database) TypeNames() (typeNames []string) {
+	seen := map[string]bool{}
+	for _, table := range database.Tables {
+		for _, col := range table.Columns {
+			name := strings.ToLower(col.Type.Name)
+			if name == "" || seen[name] {
+				continue
+			}
+			seen[name] = true
+			typeNames = append(typeNames, name)
+		}
+	}
+	sort.Strings(typeNames)
+	return
+}
@@ -0,0 +1,171 @@
+package serve
+
+import (
+	"github.com/timabell/schema-explorer/params"
+	"github.com/timabell/schema-explorer/reader"
+	"github.com/timabell/schema-explorer/render"
+	"github.com/timabell/schema-explorer/schema"
+	"github.com/timabell/schema-explorer/trail"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"github.com/gorilla/mux"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Navigation history is kept in memory per browser session, too much for a cookie and not worth keeping past a restart
+const sessionCookieName = "sse-session"
+const historyLifetime = 24 * time.Hour
+const maxHistorySessions = 1000 // beyond this the least recently used are dropped
+
+type historySession struct {
+	histories map[string]*trail.History // by database name
+	lastUsed  time.Time
+}
+
+var historySessions = map[string]*historySession{}
+var historyMutex sync.Mutex
+
+// The session of the request's cookie, nil if it has none or it's been dropped
+func findHistorySession(req *http.Request) *historySession {
+	sessionCookie, _ := req.Cookie(sessionCookieName)
+	if sessionCookie == nil || sessionCookie.Value == "" {
+		return nil
+	}
+	return historySessions[sessionCookie.Value]
+}
+
+// Starts a session and sets its cookie, making room for it first if needed. Must hold historyMutex.
+func newHistorySession(resp http.ResponseWriter) *historySession {
+	now := time.Now()
+	var oldestId string
+	for id, session := range historySessions {
+		if now.Sub(session.lastUsed) > historyLifetime {
+			delete(historySessions, id)
+		} else if oldestId == "" || session.lastUsed.Before(historySessions[oldestId].lastUsed) {
+			oldestId = id
+		}
+	}
+	if len(historySessions) >= maxHistorySessions {
+		delete(historySessions, oldestId)
+	}
+
+	bytes := make([]byte, 16)
+	_, err := rand.Read(bytes)
+	if err != nil {
+		log.Print("failed to generate session id ", err)
+	}
+	id := hex.EncodeToString(bytes)
+	http.SetCookie(resp, &http.Cookie{Name: sessionCookieName, Value: id, Path: "/", HttpOnly: true})
+	session := &historySession{histories: map[string]*trail.History{}}
+	historySessions[id] = session
+	return session
+}
+
+// Changes the session's history of the database, returning a copy of it afterwards.
+// Requests without a session get an empty history and don't start one unless create is set.
+func updateHistory(resp http.ResponseWriter, req *http.Request, databaseName string, create bool, update func(history *trail.History)) trail.History {
+	historyMutex.Lock()
+	defer historyMutex.Unlock()
+	session := findHistorySession(req)
+	if session == nil || time.Since(session.lastUsed) > historyLifetime {
+		if !create {
+			return trail.History{}
+		}
+		session = newHistorySession(resp)
+	}
+	session.lastUsed = time.Now()
+	history := session.histories[databaseName]
+	if history == nil {
+		history = &trail.History{}
+		session.histories[databaseName] = history
+	}
+	update(history)
+	return trail.History{Steps: append([]trail.HistoryStep(nil), history.Steps...)}
+}
+
+func readHistory(resp http.ResponseWriter, req *http.Request, databaseName string) trail.History {
+	return updateHistory(resp, req, databaseName, false, func(history *trail.History) {})
+}
+
+// The only place sessions are started, so requests that don't look at tables don't fill up the sessions
+func addHistoryStep(resp http.ResponseWriter, req *http.Request, databaseName string, table *schema.Table, tableParams params.TableParams) trail.History {
+	return updateHistory(resp, req, databaseName, true, func(history *trail.History) {
+		history.AddStep(table, tableParams)
+	})
+}
+
+// Absolute so they still work pasted into a bug report
+func historyPermalinks(req *http.Request, databaseName string, history trail.History) (permalinks []string) {
+	scheme := "http"
+	if req.TLS != nil {
+		scheme = "https"
+	}
+	for _, step := range history.Steps {
+		permalinks = append(permalinks, fmt.Sprintf("%s://%s%s%s", scheme, req.Host, databaseUrlPrefix(databaseName), step.Url()))
+	}
+	return
+}
+
+func HistoryHandler(resp http.ResponseWriter, req *http.Request) {
+	databaseName := mux.Vars(req)["database"]
+	layoutData, _, err := dbRequestSetup(databaseName)
+	if err != nil {
+		serverError(resp, "setup error rendering history", err)
+		return
+	}
+	history := readHistory(resp, req, databaseName)
+	err = render.ShowHistory(resp, reader.Databases[databaseName], history, historyPermalinks(req, databaseName, history), layoutData)
+	if err != nil {
+		serverError(resp, "error rendering history", err)
+		return
+	}
+}
+
+// The steps as a numbered list of links, for pasting into a bug report
+func HistoryExportHandler(resp http.ResponseWriter, req *http.Request) {
+	databaseName := mux.Vars(req)["database"]
+	history := readHistory(resp, req, databaseName)
+	resp.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	for ix, permalink := range historyPermalinks(req, databaseName, history) {
+		step := history.Steps[ix]
+		fmt.Fprintf(resp, "%d. %s", ix+1, step.Table)
+		if step.ViaFk != "" {
+			fmt.Fprintf(resp, " via %s", step.ViaFk)
+		}
+		fmt.Fprintf(resp, "\n   %s\n", permalink)
+	}
+}
+
+// Goes back to an earlier step, forgetting the ones after it
+func HistoryStepHandler(resp http.ResponseWriter, req *http.Request) {
+	databaseName := mux.Vars(req)["database"]
+	stepIndex, err := strconv.Atoi(mux.Vars(req)["step"])
+	var step *trail.HistoryStep
+	if err == nil {
+		updateHistory(resp, req, databaseName, false, func(history *trail.History) {
+			if history.BackTo(stepIndex) {
+				found := history.Steps[stepIndex]
+				step = &found
+			}
+		})
+	}
+	if step == nil {
+		resp.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(resp, "Alas, thou hast not taken that step of late. 404 my friend.")
+		return
+	}
+	http.Redirect(resp, req, databaseUrlPrefix(databaseName)+step.Url(), http.StatusFound)
+}
+
+func ClearHistoryHandler(resp http.ResponseWriter, req *http.Request) {
+	databaseName := mux.Vars(req)["database"]
+	updateHistory(resp, req, databaseName, false, func(history *trail.History) {
+		history.Steps = nil
+	})
+	http.Redirect(resp, req, databaseUrlPrefix(databaseName)+"/history", http.StatusFound)
+}
@@ -41,14 +41,39 @@ func Router() (r *mux.Router) {
 func registerDatbaseRoutes(routerBase *mux.Router, namePrefix string) {
 	// db info
 	routerBase.HandleFunc("/", TableListHandler)
+	routerBase.HandleFunc("/orphans", OrphansHandler)
+	routerBase.HandleFunc("/orphans/rerun", RerunOrphansHandler).Methods("POST")
+	routerBase.HandleFunc("/search", SearchHandler)
+	routerBase.HandleFunc("/schema-search", SchemaSearchHandler)
+	routerBase.HandleFunc("/join-path", JoinPathHandler)
+	routerBase.HandleFunc("/query", QueryHandler)
+	saved := routerBase.PathPrefix("/saved").Subrouter()
+	saved.HandleFunc("", SavedViewsHandler).Methods("GET")
+	saved.HandleFunc("", SaveViewHandler).Methods("POST")
+	saved.HandleFunc("/{id}", SavedViewHandler).Methods("GET")
+	saved.HandleFunc("/{id}/delete", DeleteSavedViewHandler).Methods("POST")
 	// db/table/*
 	tables := routerBase.PathPrefix("/tables/{tableName}").Subrouter()
 	tables.HandleFunc("", TableInfoHandler).Name(namePrefix + "route-database-tables")
 	tables.HandleFunc("/data", TableDataHandler)
 	tables.HandleFunc("/analyse-data", AnalyseTableHandler)
+	tables.HandleFunc("/analyse-data/status", AnalysisStatusHandler)
+	tables.HandleFunc("/analyse-data/rerun", RerunAnalysisHandler).Methods("POST")
+	tables.HandleFunc("/orphans", TableOrphansHandler)
+	tables.HandleFunc("/orphans/rerun", RerunTableOrphansHandler).Methods("POST")
+	tables.HandleFunc("/group-by", GroupByHandler)
+	tables.HandleFunc("/explain", ExplainHandler)
+	tables.HandleFunc("/geojson/{columnName}", GeoJsonHandler)
+	tables.HandleFunc("/cell/{columnName}", CellDownloadHandler).Name(namePrefix + "route-database-tables-cell")
 	tables.HandleFunc("/description", TableDescriptionHandler).Methods("POST")
 	tables.HandleFunc("/columns/{columnName}/description", ColumnDescriptionHandler).Methods("POST")
 	trail := routerBase.PathPrefix("/table-trail").Subrouter()
 	trail.HandleFunc("", TableTrailHandler)
+	trail.HandleFunc("/sql", TableTrailSqlHandler)
 	trail.HandleFunc("/clear", ClearTableTrailHandler)
+	history := routerBase.PathPrefix("/history").Subrouter()
+	history.HandleFunc("", HistoryHandler)
+	history.HandleFunc("/export", HistoryExportHandler)
+	history.HandleFunc("/clear", ClearHistoryHandler)
+	history.HandleFunc("/{step:[0-9]+}", HistoryStepHandler)
 }
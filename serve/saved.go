@@ -0,0 +1,184 @@
+package serve
+
+import (
+	"github.com/timabell/schema-explorer/options"
+	"github.com/timabell/schema-explorer/params"
+	"github.com/timabell/schema-explorer/reader"
+	"github.com/timabell/schema-explorer/render"
+	"github.com/timabell/schema-explorer/saved"
+	"fmt"
+	"github.com/gorilla/mux"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+var savedViews *saved.Store
+var savedViewsPath string
+var savedViewsMutex sync.Mutex
+
+// Opened on first use, and again if the path option has changed
+func getSavedViews() (*saved.Store, error) {
+	savedViewsMutex.Lock()
+	defer savedViewsMutex.Unlock()
+	path := options.Options.SavedViewsPath
+	if path == "" {
+		path = saved.DefaultPath()
+	}
+	if savedViews == nil || savedViewsPath != path {
+		store, err := saved.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		if savedViews != nil {
+			savedViews.Close()
+		}
+		savedViews = store
+		savedViewsPath = path
+	}
+	return savedViews, nil
+}
+
+func SavedViewsHandler(resp http.ResponseWriter, req *http.Request) {
+	databaseName := mux.Vars(req)["database"]
+	layoutData, _, err := dbRequestSetup(databaseName)
+	if err != nil {
+		serverError(resp, "setup error listing saved views", err)
+		return
+	}
+	store, err := getSavedViews()
+	if err != nil {
+		serverError(resp, "error reading saved views", err)
+		return
+	}
+	views, err := store.ForDatabase(databaseName)
+	if err != nil {
+		serverError(resp, "error reading saved views", err)
+		return
+	}
+	err = render.ShowSavedViews(resp, reader.Databases[databaseName], views, layoutData)
+	if err != nil {
+		serverError(resp, "error rendering saved views", err)
+		return
+	}
+}
+
+// Saves the table view or query posted from the table and sql pages
+func SaveViewHandler(resp http.ResponseWriter, req *http.Request) {
+	databaseName := mux.Vars(req)["database"]
+	_, _, err := dbRequestSetup(databaseName)
+	if err != nil {
+		serverError(resp, "setup error saving view", err)
+		return
+	}
+	err = req.ParseForm()
+	if err != nil {
+		resp.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(resp, "Failed to read the form.")
+		return
+	}
+	view := saved.View{
+		Database:    databaseName,
+		Name:        req.PostForm.Get("name"),
+		Description: req.PostForm.Get("description"),
+		Sql:         strings.TrimSpace(req.PostForm.Get("sql")),
+	}
+	if tableName := req.PostForm.Get("table"); tableName != "" {
+		requestedTable := parseTableName(tableName)
+		table := reader.Databases[databaseName].FindTable(&requestedTable)
+		if table == nil {
+			resp.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(resp, "Alas, thy table hast not been seen of late. 404 my friend.")
+			return
+		}
+		query, err := url.ParseQuery(req.PostForm.Get("tableParams"))
+		if err != nil {
+			resp.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(resp, "The table view's parameters couldn't be read.")
+			return
+		}
+		// saved without the page so that the view always opens at the start
+		view.Table = table.String()
+		view.TableParams = string(params.ParseTableParams(query, table).ClearPaging().AsQueryString())
+		view.Sql = ""
+	}
+	store, err := getSavedViews()
+	if err != nil {
+		serverError(resp, "error reading saved views", err)
+		return
+	}
+	_, err = store.Add(view)
+	if err != nil {
+		resp.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(resp, "The view couldn't be saved: %s.", err)
+		return
+	}
+	http.Redirect(resp, req, databaseUrlPrefix(databaseName)+"/saved", http.StatusSeeOther)
+}
+
+// The stable url of a saved view, sends the user on to the table or sql page with what was saved
+func SavedViewHandler(resp http.ResponseWriter, req *http.Request) {
+	databaseName := mux.Vars(req)["database"]
+	view, ok := findSavedView(resp, req, databaseName)
+	if !ok {
+		return
+	}
+	urlPrefix := databaseUrlPrefix(databaseName)
+	if view.IsTableView() {
+		http.Redirect(resp, req, fmt.Sprintf("%s/tables/%s?%s#data", urlPrefix, view.Table, view.TableParams), http.StatusFound)
+		return
+	}
+	http.Redirect(resp, req, fmt.Sprintf("%s/query?sql=%s", urlPrefix, url.QueryEscape(view.Sql)), http.StatusFound)
+}
+
+func DeleteSavedViewHandler(resp http.ResponseWriter, req *http.Request) {
+	databaseName := mux.Vars(req)["database"]
+	view, ok := findSavedView(resp, req, databaseName)
+	if !ok {
+		return
+	}
+	store, err := getSavedViews()
+	if err != nil {
+		serverError(resp, "error reading saved views", err)
+		return
+	}
+	_, err = store.Delete(databaseName, view.Id)
+	if err != nil {
+		serverError(resp, "error deleting saved view", err)
+		return
+	}
+	http.Redirect(resp, req, databaseUrlPrefix(databaseName)+"/saved", http.StatusSeeOther)
+}
+
+// Writes the error response if the view can't be found, ok is false if so
+func findSavedView(resp http.ResponseWriter, req *http.Request, databaseName string) (view *saved.View, ok bool) {
+	_, _, err := dbRequestSetup(databaseName)
+	if err != nil {
+		serverError(resp, "setup error finding saved view", err)
+		return
+	}
+	store, err := getSavedViews()
+	if err != nil {
+		serverError(resp, "error reading saved views", err)
+		return
+	}
+	view, err = store.Find(databaseName, mux.Vars(req)["id"])
+	if err != nil {
+		serverError(resp, "error reading saved view", err)
+		return
+	}
+	if view == nil {
+		resp.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(resp, "Alas, that view hast not been saved, or hast since been deleted. 404 my friend.")
+		return
+	}
+	return view, true
+}
+
+func databaseUrlPrefix(databaseName string) string {
+	if databaseName != "" {
+		return "/" + databaseName
+	}
+	return ""
+}
@@ -1,17 +1,21 @@
 package serve
 
 import (
+	"github.com/timabell/schema-explorer/driver_interface"
 	"github.com/timabell/schema-explorer/options"
 	"github.com/timabell/schema-explorer/params"
 	"github.com/timabell/schema-explorer/reader"
 	"github.com/timabell/schema-explorer/render"
 	"github.com/timabell/schema-explorer/schema"
+	"errors"
 	"fmt"
 	"github.com/gorilla/mux"
 	"io"
 	"io/ioutil"
 	"log"
+	"mime"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 )
@@ -69,9 +73,11 @@ func TableHandler(resp http.ResponseWriter, req *http.Request, dataOnly bool) {
 
 	trail := ReadTrail(databaseName, req)
 	trail.AddTable(table)
+	trail.SetFilters(table, string(params.Filter.AsQueryString()))
 	SetTrailCookie(databaseName, trail, resp)
+	history := addHistoryStep(resp, req, databaseName, table, *params)
 
-	err = render.ShowTable(resp, dbReader, reader.Databases[databaseName], table, params, layoutData, dataOnly)
+	err = render.ShowTable(resp, dbReader, reader.Databases[databaseName], table, params, history, layoutData, dataOnly)
 	if err != nil {
 		fmt.Println("error rendering table: ", err)
 		return
@@ -161,12 +167,482 @@ func AnalyseTableHandler(resp http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	err = render.ShowTableAnalysis(resp, dbReader, reader.Databases[databaseName], table, layoutData)
+	sample, err := parseAnalysisSample(req, reader.Databases[databaseName])
+	if err != nil {
+		resp.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(resp, "The sample couldn't be read: %s.", err)
+		return
+	}
+	reader.StartAnalysis(dbReader, databaseName, table, table.Columns, false, sample)
+	jobs := reader.GetAnalysisJobs(databaseName, table, sample)
+	err = render.ShowTableAnalysis(resp, reader.Databases[databaseName], table, jobs, sample, layoutData)
 	if err != nil {
 		serverError(resp, "error rendering table analysis", err)
 		return
 	}
 }
+
+func AnalysisStatusHandler(resp http.ResponseWriter, req *http.Request) {
+	databaseName := mux.Vars(req)["database"]
+	_, _, err := dbRequestSetup(databaseName)
+	if err != nil {
+		serverError(resp, "setup error getting analysis status", err)
+		return
+	}
+
+	tableName := mux.Vars(req)["tableName"]
+	requestedTable := parseTableName(tableName)
+	table := reader.Databases[databaseName].FindTable(&requestedTable)
+	if table == nil {
+		resp.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(resp, "Alas, thy table hast not been seen of late. 404 my friend.")
+		return
+	}
+
+	sample, err := parseAnalysisSample(req, reader.Databases[databaseName])
+	if err != nil {
+		resp.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(resp, "The sample couldn't be read: %s.", err)
+		return
+	}
+	err = render.ShowAnalysisStatus(resp, reader.GetAnalysisJobs(databaseName, table, sample))
+	if err != nil {
+		serverError(resp, "error rendering analysis status", err)
+		return
+	}
+}
+
+// Discards cached analysis of the table with the sample, or of one column if given, and starts again
+func RerunAnalysisHandler(resp http.ResponseWriter, req *http.Request) {
+	databaseName := mux.Vars(req)["database"]
+	_, dbReader, err := dbRequestSetup(databaseName)
+	if err != nil {
+		serverError(resp, "setup error re-running analysis", err)
+		return
+	}
+
+	tableName := mux.Vars(req)["tableName"]
+	requestedTable := parseTableName(tableName)
+	table := reader.Databases[databaseName].FindTable(&requestedTable)
+	if table == nil {
+		resp.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(resp, "Alas, thy table hast not been seen of late. 404 my friend.")
+		return
+	}
+
+	columns := table.Columns
+	if columnName := req.FormValue("column"); columnName != "" {
+		_, col := table.FindColumn(columnName)
+		if col == nil {
+			resp.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(resp, "Alas, thy column hast not been seen of late. 404 my friend.")
+			return
+		}
+		columns = []*schema.Column{col}
+	}
+	sample, err := parseAnalysisSample(req, reader.Databases[databaseName])
+	if err != nil {
+		resp.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(resp, "The sample couldn't be read: %s.", err)
+		return
+	}
+	reader.StartAnalysis(dbReader, databaseName, table, columns, true, sample)
+	// keeps the chosen sample selected for the next re-run
+	http.Redirect(resp, req, "../analyse-data?"+analysisSampleQuery(sample).Encode(), http.StatusSeeOther)
+}
+
+// The sample chosen on the analysis page, or the analysis-sample-rows option if there wasn't a choice
+func parseAnalysisSample(req *http.Request, database *schema.Database) (sample schema.AnalysisSample, err error) {
+	switch req.FormValue("sample") {
+	case "":
+		sample.FirstRows = options.Options.AnalysisSampleRows
+	case "all":
+	case "rows":
+		rows, parseErr := strconv.Atoi(req.FormValue("sampleRows"))
+		if parseErr != nil || rows < 1 {
+			err = errors.New("the number of rows must be a positive number")
+			return
+		}
+		sample.FirstRows = rows
+	case "percent":
+		if !database.Supports.TableSample {
+			err = errors.New("this database can't sample a percentage of a table")
+			return
+		}
+		percent, parseErr := strconv.Atoi(req.FormValue("samplePercent"))
+		if parseErr != nil || percent < 1 || percent > 100 {
+			err = errors.New("the percentage must be a number from 1 to 100")
+			return
+		}
+		sample.Percent = percent
+	default:
+		err = errors.New(fmt.Sprintf("there's no %s sample", req.FormValue("sample")))
+	}
+	return
+}
+
+func analysisSampleQuery(sample schema.AnalysisSample) url.Values {
+	switch {
+	case sample.Percent > 0:
+		return url.Values{"sample": {"percent"}, "samplePercent": {strconv.Itoa(sample.Percent)}}
+	case sample.FirstRows > 0:
+		return url.Values{"sample": {"rows"}, "sampleRows": {strconv.Itoa(sample.FirstRows)}}
+	}
+	return url.Values{"sample": {"all"}}
+}
+
+func OrphansHandler(resp http.ResponseWriter, req *http.Request) {
+	databaseName := mux.Vars(req)["database"]
+	layoutData, dbReader, err := dbRequestSetup(databaseName)
+	if err != nil {
+		serverError(resp, "setup error finding orphans", err)
+		return
+	}
+
+	database := reader.Databases[databaseName]
+	reader.StartOrphanChecks(dbReader, databaseName, database.Fks, false)
+	err = render.ShowOrphans(resp, database, nil, reader.GetOrphanJobs(databaseName, database.Fks), layoutData)
+	if err != nil {
+		serverError(resp, "error rendering orphans", err)
+		return
+	}
+}
+
+// Discards the cached orphan checks of the whole database and starts again
+func RerunOrphansHandler(resp http.ResponseWriter, req *http.Request) {
+	databaseName := mux.Vars(req)["database"]
+	_, dbReader, err := dbRequestSetup(databaseName)
+	if err != nil {
+		serverError(resp, "setup error re-running orphan checks", err)
+		return
+	}
+
+	reader.StartOrphanChecks(dbReader, databaseName, reader.Databases[databaseName].Fks, true)
+	http.Redirect(resp, req, "../orphans", http.StatusSeeOther)
+}
+
+func SearchHandler(resp http.ResponseWriter, req *http.Request) {
+	databaseName := mux.Vars(req)["database"]
+	layoutData, dbReader, err := dbRequestSetup(databaseName)
+	if err != nil {
+		serverError(resp, "setup error searching", err)
+		return
+	}
+
+	database := reader.Databases[databaseName]
+	value := strings.TrimSpace(req.URL.Query().Get("q"))
+	var columns int
+	var result reader.SearchResult
+	if value != "" {
+		targets := reader.SearchTargets(database, value, reader.ReadSearchConfig())
+		columns = len(targets)
+		result = reader.SearchValue(dbReader, databaseName, value, targets, options.Options.SearchSeconds)
+	}
+	err = render.ShowSearch(resp, database, value, columns, result, layoutData)
+	if err != nil {
+		serverError(resp, "error rendering search", err)
+		return
+	}
+}
+
+// Runs an ad-hoc select given in the sql query string parameter, read-only so GET is fine and results can be linked to
+func QueryHandler(resp http.ResponseWriter, req *http.Request) {
+	databaseName := mux.Vars(req)["database"]
+	layoutData, dbReader, err := dbRequestSetup(databaseName)
+	if err != nil {
+		serverError(resp, "setup error running query", err)
+		return
+	}
+
+	err = req.ParseForm()
+	if err != nil {
+		resp.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(resp, "Failed to read the query form.")
+		return
+	}
+	query := strings.TrimSpace(req.FormValue("sql"))
+	rowLimit := reader.DefaultQueryRowLimit
+	if rowLimitString := req.FormValue("rowLimit"); rowLimitString != "" {
+		rowLimit, err = strconv.Atoi(rowLimitString)
+		if err != nil || rowLimit < 1 {
+			resp.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(resp, "The row limit must be a positive number.")
+			return
+		}
+	}
+	// links only fill in the form, so that visiting a url can't run anything
+	ran := req.Method == "POST" && query != ""
+	var result driver_interface.QueryResult
+	var queryErr error
+	if ran {
+		result, queryErr = reader.RunQuery(dbReader, databaseName, query, rowLimit, options.Options.QuerySeconds)
+	}
+	err = render.ShowQuery(resp, reader.Databases[databaseName], query, rowLimit, ran, result, queryErr, layoutData)
+	if err != nil {
+		serverError(resp, "error rendering query", err)
+		return
+	}
+}
+
+func JoinPathHandler(resp http.ResponseWriter, req *http.Request) {
+	databaseName := mux.Vars(req)["database"]
+	layoutData, dbReader, err := dbRequestSetup(databaseName)
+	if err != nil {
+		serverError(resp, "setup error finding join path", err)
+		return
+	}
+
+	database := reader.Databases[databaseName]
+	var from, to *schema.Table
+	fromName := req.URL.Query().Get("from")
+	toName := req.URL.Query().Get("to")
+	if fromName != "" && toName != "" {
+		requestedFrom := parseTableName(fromName)
+		requestedTo := parseTableName(toName)
+		from = database.FindTable(&requestedFrom)
+		to = database.FindTable(&requestedTo)
+		if from == nil || to == nil {
+			resp.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(resp, "Alas, thy table hast not been seen of late. 404 my friend.")
+			return
+		}
+	}
+	err = render.ShowJoinPaths(resp, dbReader, database, from, to, layoutData)
+	if err != nil {
+		serverError(resp, "error rendering join paths", err)
+		return
+	}
+}
+
+func SchemaSearchHandler(resp http.ResponseWriter, req *http.Request) {
+	databaseName := mux.Vars(req)["database"]
+	layoutData, _, err := dbRequestSetup(databaseName)
+	if err != nil {
+		serverError(resp, "setup error searching schema", err)
+		return
+	}
+
+	query := req.URL.Query()
+	schemaQuery := schema.SchemaQuery{
+		Text:     strings.TrimSpace(query.Get("q")),
+		IsRegex:  query.Get("regex") != "",
+		TypeName: strings.TrimSpace(query.Get("type")),
+	}
+	nullable := query.Get("nullable")
+	switch nullable {
+	case "yes":
+		schemaQuery.Nullable = new(bool)
+		*schemaQuery.Nullable = true
+	case "no":
+		schemaQuery.Nullable = new(bool)
+	}
+	err = render.ShowSchemaSearch(resp, reader.Databases[databaseName], schemaQuery, nullable, layoutData)
+	if err != nil {
+		serverError(resp, "error rendering schema search", err)
+		return
+	}
+}
+
+func TableOrphansHandler(resp http.ResponseWriter, req *http.Request) {
+	databaseName := mux.Vars(req)["database"]
+	layoutData, dbReader, err := dbRequestSetup(databaseName)
+	if err != nil {
+		serverError(resp, "setup error finding orphans", err)
+		return
+	}
+
+	tableName := mux.Vars(req)["tableName"]
+	requestedTable := parseTableName(tableName)
+	table := reader.Databases[databaseName].FindTable(&requestedTable)
+	if table == nil {
+		resp.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(resp, "Alas, thy table hast not been seen of late. 404 my friend.")
+		return
+	}
+
+	reader.StartOrphanChecks(dbReader, databaseName, table.Fks, false)
+	err = render.ShowOrphans(resp, reader.Databases[databaseName], table, reader.GetOrphanJobs(databaseName, table.Fks), layoutData)
+	if err != nil {
+		serverError(resp, "error rendering table orphans", err)
+		return
+	}
+}
+
+// Discards the cached orphan checks of the fks out of the table and starts again
+func RerunTableOrphansHandler(resp http.ResponseWriter, req *http.Request) {
+	databaseName := mux.Vars(req)["database"]
+	_, dbReader, err := dbRequestSetup(databaseName)
+	if err != nil {
+		serverError(resp, "setup error re-running orphan checks", err)
+		return
+	}
+
+	tableName := mux.Vars(req)["tableName"]
+	requestedTable := parseTableName(tableName)
+	table := reader.Databases[databaseName].FindTable(&requestedTable)
+	if table == nil {
+		resp.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(resp, "Alas, thy table hast not been seen of late. 404 my friend.")
+		return
+	}
+
+	reader.StartOrphanChecks(dbReader, databaseName, table.Fks, true)
+	http.Redirect(resp, req, "../orphans", http.StatusSeeOther)
+}
+
+func GroupByHandler(resp http.ResponseWriter, req *http.Request) {
+	databaseName := mux.Vars(req)["database"]
+	layoutData, dbReader, err := dbRequestSetup(databaseName)
+	if err != nil {
+		serverError(resp, "setup error grouping table", err)
+		return
+	}
+
+	tableName := mux.Vars(req)["tableName"]
+	requestedTable := parseTableName(tableName)
+	table := reader.Databases[databaseName].FindTable(&requestedTable)
+	if table == nil {
+		resp.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(resp, "Alas, thy table hast not been seen of late. 404 my friend.")
+		return
+	}
+
+	query := req.URL.Query()
+	groupBy := params.ParseGroupBy(query, table)
+	if len(groupBy) > 2 {
+		resp.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(resp, "Group by one or two columns at a time.")
+		return
+	}
+	tableParams := params.ParseTableParams(query, table)
+
+	err = render.ShowGroupBy(resp, dbReader, reader.Databases[databaseName], table, groupBy, tableParams, layoutData)
+	if err != nil {
+		serverError(resp, "error rendering group by", err)
+		return
+	}
+}
+
+// Shows how the database would run the query for the table's data page with the same params
+func ExplainHandler(resp http.ResponseWriter, req *http.Request) {
+	databaseName := mux.Vars(req)["database"]
+	layoutData, dbReader, err := dbRequestSetup(databaseName)
+	if err != nil {
+		serverError(resp, "setup error explaining query", err)
+		return
+	}
+
+	requestedTable := parseTableName(mux.Vars(req)["tableName"])
+	table := reader.Databases[databaseName].FindTable(&requestedTable)
+	if table == nil {
+		resp.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(resp, "Alas, thy table hast not been seen of late. 404 my friend.")
+		return
+	}
+	tableParams := params.ParseTableParams(req.URL.Query(), table)
+
+	plan, sqlText, planErr := reader.GetQueryPlan(dbReader, databaseName, table, tableParams)
+	err = render.ShowQueryPlan(resp, reader.Databases[databaseName], table, tableParams, sqlText, plan, planErr, layoutData)
+	if err != nil {
+		serverError(resp, "error rendering query plan", err)
+		return
+	}
+}
+
+// Sends the raw value of one cell as a file, the row is identified by its primary key values in the query string
+func CellDownloadHandler(resp http.ResponseWriter, req *http.Request) {
+	databaseName := mux.Vars(req)["database"]
+	_, dbReader, err := dbRequestSetup(databaseName)
+	if err != nil {
+		serverError(resp, "setup error downloading cell", err)
+		return
+	}
+
+	tableName := mux.Vars(req)["tableName"]
+	requestedTable := parseTableName(tableName)
+	table := reader.Databases[databaseName].FindTable(&requestedTable)
+	if table == nil {
+		resp.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(resp, "Alas, thy table hast not been seen of late. 404 my friend.")
+		return
+	}
+	columnName := mux.Vars(req)["columnName"]
+	_, column := table.FindColumn(columnName)
+	if column == nil {
+		resp.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(resp, "Alas, thy column hast not been seen of late. 404 my friend.")
+		return
+	}
+
+	rowParams := params.ParseTableParams(req.URL.Query(), table)
+	// only the row's key is wanted from the url, a column list could leave out the column being downloaded
+	rowParams.Columns = nil
+	value, err := reader.GetCellValue(dbReader, databaseName, table, column, rowParams)
+	if err != nil {
+		resp.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(resp, err)
+		return
+	}
+	if value == nil {
+		resp.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(resp, "The value is null, there's nothing to download.")
+		return
+	}
+	data, isBinary := reader.BinaryValue(value)
+	if !isBinary {
+		data = []byte(*reader.DbValueToString(value, column.Type))
+	}
+
+	contentType := "application/octet-stream"
+	extension := "bin"
+	if fileType := reader.DetectFileType(data); fileType != nil {
+		contentType = fileType.MimeType
+		extension = fileType.Extension
+	}
+	var keyValues []string
+	for _, pkCol := range table.Pk.Columns {
+		keyValues = append(keyValues, rowParams.FilterValue(pkCol))
+	}
+	fileName := fmt.Sprintf("%s.%s.%s.%s", table.Name, strings.Join(keyValues, "-"), column.Name, extension)
+	resp.Header().Set("Content-Type", contentType)
+	resp.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": fileName}))
+	resp.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	resp.Write(data)
+}
+
+// Filtered rows of a table as GeoJSON, with the shapes from the given geometry/geography column
+func GeoJsonHandler(resp http.ResponseWriter, req *http.Request) {
+	databaseName := mux.Vars(req)["database"]
+	_, dbReader, err := dbRequestSetup(databaseName)
+	if err != nil {
+		serverError(resp, "setup error exporting geojson", err)
+		return
+	}
+
+	tableName := mux.Vars(req)["tableName"]
+	requestedTable := parseTableName(tableName)
+	table := reader.Databases[databaseName].FindTable(&requestedTable)
+	if table == nil {
+		resp.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(resp, "Alas, thy table hast not been seen of late. 404 my friend.")
+		return
+	}
+	columnName := mux.Vars(req)["columnName"]
+	_, column := table.FindColumn(columnName)
+	if column == nil || !column.Type.IsSpatial() {
+		resp.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(resp, "Alas, thy spatial column hast not been seen of late. 404 my friend.")
+		return
+	}
+
+	tableParams := params.ParseTableParams(req.URL.Query(), table)
+	err = render.ShowGeoJson(resp, dbReader, reader.Databases[databaseName], table, column, tableParams)
+	if err != nil {
+		serverError(resp, "error exporting geojson", err)
+		return
+	}
+}
+
 func TableDescriptionHandler(resp http.ResponseWriter, req *http.Request) {
 	databaseName := mux.Vars(req)["database"]
 	tableName := mux.Vars(req)["tableName"]
@@ -3,27 +3,46 @@ package serve
 import (
 	"github.com/timabell/schema-explorer/trail"
 	"net/http"
+	"net/url"
 	"strings"
 	"time"
 )
 
 const trailCookieName = "table-trail-"
+const trailFiltersCookieName = "table-trail-filters-"
 
 func ReadTrail(databaseName string, req *http.Request) *trail.TrailLog {
+	trailLog := &trail.TrailLog{}
 	trailCookie, _ := req.Cookie(trailCookieName + databaseName)
 	if trailCookie != nil && trailCookie.Value != "" {
-		return trailFromCsv(trailCookie.Value)
+		trailLog = trailFromCsv(trailCookie.Value)
 	}
-	return &trail.TrailLog{}
+	filtersCookie, _ := req.Cookie(trailFiltersCookieName + databaseName)
+	if filtersCookie != nil && filtersCookie.Value != "" {
+		// stored escaped as "table?filters" as cookie values can't hold everything a filter can
+		unescaped, err := url.QueryUnescape(filtersCookie.Value)
+		if err == nil {
+			parts := strings.SplitN(unescaped, "?", 2)
+			if len(parts) == 2 {
+				trailLog.FiltersTable = parts[0]
+				trailLog.Filters = parts[1]
+			}
+		}
+	}
+	return trailLog
 }
 
 func SetTrailCookie(databaseName string, trail *trail.TrailLog, resp http.ResponseWriter) {
 	trailCookie := &http.Cookie{Name: trailCookieName + databaseName, Value: trailString(trail), Path: "/"}
 	http.SetCookie(resp, trailCookie)
+	filtersCookie := &http.Cookie{Name: trailFiltersCookieName + databaseName, Value: url.QueryEscape(trail.FiltersTable + "?" + trail.Filters), Path: "/"}
+	http.SetCookie(resp, filtersCookie)
 }
 func ClearTrailCookie(databaseName string, resp http.ResponseWriter) {
 	trailCookie := &http.Cookie{Name: trailCookieName + databaseName, Value: "", Path: "/", Expires: time.Now().Add(-10000)}
 	http.SetCookie(resp, trailCookie)
+	filtersCookie := &http.Cookie{Name: trailFiltersCookieName + databaseName, Value: "", Path: "/", Expires: time.Now().Add(-10000)}
+	http.SetCookie(resp, filtersCookie)
 }
 
 func trailString(trail *trail.TrailLog) string {
@@ -33,6 +33,34 @@ func TableTrailHandler(resp http.ResponseWriter, req *http.Request) {
 	}
 }
 
+func TableTrailSqlHandler(resp http.ResponseWriter, req *http.Request) {
+	databaseName := mux.Vars(req)["database"]
+	layoutData, dbReader, err := dbRequestSetup(databaseName)
+	if err != nil {
+		serverError(resp, "setup error rendering trail sql", err)
+		return
+	}
+	// permalinks carry the filters along with the tables, otherwise they're from cookies if asked for
+	query := req.URL.Query()
+	tablesCsv := query.Get("tables")
+	var trail *trail.TrailLog
+	withFilters := query.Get("withFilters") != ""
+	if tablesCsv != "" {
+		trail = trailFromCsv(tablesCsv)
+		trail.FiltersTable = query.Get("filterTable")
+		trail.Filters = query.Get("filter")
+		withFilters = trail.Filters != ""
+	} else {
+		trail = ReadTrail(databaseName, req)
+		trail.Dynamic = true
+	}
+	err = render.ShowTrailSql(resp, dbReader, reader.Databases[databaseName], trail, withFilters, layoutData)
+	if err != nil {
+		fmt.Println("error rendering trail sql: ", err)
+		return
+	}
+}
+
 func ClearTableTrailHandler(resp http.ResponseWriter, req *http.Request) {
 	databaseName := mux.Vars(req)["database"]
 	ClearTrailCookie(databaseName, resp)
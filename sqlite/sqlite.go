@@ -14,12 +14,16 @@ import (
 	"github.com/timabell/schema-explorer/params"
 	"github.com/timabell/schema-explorer/reader"
 	"github.com/timabell/schema-explorer/schema"
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
 	_ "github.com/mattn/go-sqlite3"
 	"log"
+	"math"
+	"strconv"
 	"strings"
+	"time"
 )
 
 var pathVal = ""
@@ -58,6 +62,8 @@ func (model sqliteModel) ReadSchema(databaseName string) (database *schema.Datab
 			Descriptions:         false,
 			FkNames:              false, // todo: Get sqlite fk names https://stackoverflow.com/a/42365021/10245
 			PagingWithoutSorting: true,
+			JsonFilter:           false, // json_extract needs the json1 extension which go-sqlite3 doesn't build by default
+			TableSample:          false,
 		},
 	}
 
@@ -111,6 +117,14 @@ func (model sqliteModel) ReadSchema(databaseName string) (database *schema.Datab
 		database.Indexes = append(database.Indexes, indexes...)
 	}
 
+	// check constraints
+	for _, table := range database.Tables {
+		err = getCheckConstraints(dbc, table)
+		if err != nil {
+			return
+		}
+	}
+
 	//log.Print(database.DebugString())
 	return
 }
@@ -277,6 +291,15 @@ func getIndexes(dbc *sql.DB, table *schema.Table, database *schema.Database) (in
 		var name, origin string
 		var unique, partial bool
 		rows.Scan(&seq, &name, &unique, &origin, &partial)
+		if origin == "u" { // created by a unique constraint rather than a create index statement
+			var columns schema.ColumnList
+			columns, err = getIndexColumns(dbc, name, table)
+			if err != nil {
+				return
+			}
+			table.UniqueConstraints = append(table.UniqueConstraints, &schema.UniqueConstraint{Columns: columns, Table: table})
+			continue
+		}
 		if strings.HasPrefix(name, "sqlite_autoindex") {
 			continue
 		}
@@ -296,7 +319,19 @@ func getIndexes(dbc *sql.DB, table *schema.Table, database *schema.Database) (in
 }
 
 func getIndexInfo(dbc *sql.DB, index *schema.Index, table *schema.Table) (err error) {
-	rows, err := dbc.Query("PRAGMA index_info('" + index.Name + "');")
+	columns, err := getIndexColumns(dbc, index.Name, table)
+	if err != nil {
+		return
+	}
+	for _, col := range columns {
+		col.Indexes = append(col.Indexes, index)
+		index.Columns = append(index.Columns, col)
+	}
+	return
+}
+
+func getIndexColumns(dbc *sql.DB, indexName string, table *schema.Table) (columns schema.ColumnList, err error) {
+	rows, err := dbc.Query("PRAGMA index_info('" + indexName + "');")
 	if err != nil {
 		return
 	}
@@ -308,11 +343,10 @@ func getIndexInfo(dbc *sql.DB, index *schema.Index, table *schema.Table) (err er
 		if colName != "" {
 			_, col := table.FindColumn(colName)
 			if col == nil {
-				err = errors.New(fmt.Sprintf("can't find col '%s' specified in index %s", colName, index.String()))
+				err = errors.New(fmt.Sprintf("can't find col '%s' specified in index %s on table %s", colName, indexName, table.String()))
 				return
 			}
-			col.Indexes = append(col.Indexes, index)
-			index.Columns = append(index.Columns, col)
+			columns = append(columns, col)
 		}
 	}
 	return
@@ -336,7 +370,62 @@ func (model sqliteModel) GetSqlRows(databaseName string, table *schema.Table, pa
 	return
 }
 
+func (model sqliteModel) GetSqlText(databaseName string, table *schema.Table, params *params.TableParams, peekFinder *driver_interface.PeekLookup) string {
+	sql, values := buildQuery(table, params, peekFinder)
+	return driver_interface.InlineValues(sql, values, driver_interface.StandardStrings)
+}
+
+func (model sqliteModel) GetQueryPlan(databaseName string, table *schema.Table, params *params.TableParams, peekFinder *driver_interface.PeekLookup) (plan *driver_interface.PlanNode, err error) {
+	dbc, err := getConnection(model.path)
+	if err != nil {
+		log.Print("GetQueryPlan failed to get connection")
+		return
+	}
+	defer dbc.Close()
+
+	sql, values := buildQuery(table, params, peekFinder)
+	sql = "explain query plan " + sql
+	rows, err := dbc.Query(sql, values...)
+	if err != nil {
+		log.Print("GetQueryPlan failed to get query")
+		log.Println(sql)
+		log.Println(err)
+		return
+	}
+	defer rows.Close()
+
+	// each step has the id of the step it's part of, zero for the top level
+	plan = &driver_interface.PlanNode{Label: "Query Plan"}
+	nodes := map[int]*driver_interface.PlanNode{0: plan}
+	for rows.Next() {
+		var id, parent, notUsed int
+		var detail string
+		err = rows.Scan(&id, &parent, &notUsed, &detail)
+		if err != nil {
+			return
+		}
+		node := &driver_interface.PlanNode{Label: detail}
+		nodes[id] = node
+		parentNode := nodes[parent]
+		if parentNode == nil {
+			parentNode = plan
+		}
+		parentNode.Children = append(parentNode.Children, node)
+	}
+	err = rows.Err()
+	return
+}
+
+func (model sqliteModel) GetJoinSql(databaseName string, join driver_interface.JoinQuery) string {
+	sql, values := buildJoinQuery(join)
+	return driver_interface.InlineValues(sql, values, driver_interface.StandardStrings)
+}
+
 func (model sqliteModel) GetRowCount(databaseName string, table *schema.Table, params *params.TableParams) (rowCount int, err error) {
+	return model.GetRowCountContext(context.Background(), databaseName, table, params)
+}
+
+func (model sqliteModel) GetRowCountContext(ctx context.Context, databaseName string, table *schema.Table, params *params.TableParams) (rowCount int, err error) {
 	dbc, err := getConnection(model.path)
 	if err != nil {
 		log.Print("GetRows failed to get connection")
@@ -346,13 +435,14 @@ func (model sqliteModel) GetRowCount(databaseName string, table *schema.Table, p
 
 	sql, values := buildQuery(table, params, &driver_interface.PeekLookup{})
 	sql = "select count(*) from (" + sql + ")"
-	rows, err := dbc.Query(sql, values...)
+	rows, err := dbc.QueryContext(ctx, sql, values...)
 	if err != nil {
 		log.Print("GetRowCount failed to get query")
 		log.Println(sql)
 		log.Println(err)
 		return
 	}
+	defer rows.Close()
 	if !rows.Next() {
 		err = errors.New("GetRowCount query returned no rows")
 		return
@@ -361,38 +451,278 @@ func (model sqliteModel) GetRowCount(databaseName string, table *schema.Table, p
 	return
 }
 
-func (model sqliteModel) GetAnalysis(databaseName string, table *schema.Table) (analysis []schema.ColumnAnalysis, err error) {
-	// todo, might be good to stream this all the way to the http response
+func (model sqliteModel) GetColumnAnalysis(databaseName string, table *schema.Table, col *schema.Column, sample schema.AnalysisSample) (columnAnalysis schema.ColumnAnalysis, err error) {
 	dbc, err := getConnection(model.path)
 	if err != nil {
-		log.Print("GetAnalysis failed to get connection")
+		log.Print("GetColumnAnalysis failed to get connection")
 		return
 	}
 	defer dbc.Close()
 
-	analysis = []schema.ColumnAnalysis{}
-	for _, col := range table.Columns {
-		sql := "select " + col.Name + ", count(*) qty from " + table.Name + " group by " + col.Name + " order by count(*) desc, " + col.Name + " limit 100;"
-		rows, err := dbc.Query(sql)
-		if err != nil {
-			log.Print("GetAnalysis failed to get query")
-			log.Println(sql)
-			log.Println(err)
-			return nil, err
-		}
-		var valueInfos []schema.ValueInfo
-		for rows.Next() {
-			var value interface{}
-			var quantity int
-			rows.Scan(&value, &quantity)
-			valueInfos = append(valueInfos, schema.ValueInfo{
-				Value:    value,
-				Quantity: quantity,
-			})
-		}
-		analysis = append(analysis, schema.ColumnAnalysis{
-			Column:      col,
-			ValueCounts: valueInfos,
+	if sample.Percent > 0 {
+		err = errors.New("sqlite has no tablesample to analyse a percentage of a table with")
+		return
+	}
+	fromSql := " from [" + table.Name + "]"
+	if sample.FirstRows > 0 {
+		fromSql = fmt.Sprintf(" from (select * from [%s] limit %d)", table.Name, sample.FirstRows)
+	}
+	colSql := "[" + col.Name + "]"
+	sql := "select " + colSql + ", count(*) qty" + fromSql + " group by " + colSql + " order by count(*) desc, " + colSql + " limit 100;"
+	rows, err := dbc.Query(sql)
+	if err != nil {
+		log.Print("GetColumnAnalysis failed to get query")
+		log.Println(sql)
+		log.Println(err)
+		return
+	}
+	var valueInfos []schema.ValueInfo
+	for rows.Next() {
+		var value interface{}
+		var quantity int
+		rows.Scan(&value, &quantity)
+		valueInfos = append(valueInfos, schema.ValueInfo{
+			Value:    value,
+			Quantity: quantity,
+		})
+	}
+	rows.Close()
+	columnAnalysis = schema.ColumnAnalysis{
+		Column:      col,
+		ValueCounts: valueInfos,
+		Sample:      sample,
+	}
+	err = addColumnStats(dbc, col, fromSql, &columnAnalysis)
+	return
+}
+
+// Adds summary statistics for the column, plus a length or month histogram for text and temporal columns
+func addColumnStats(dbc *sql.DB, col *schema.Column, fromSql string, columnAnalysis *schema.ColumnAnalysis) (err error) {
+	var nonNullCount int
+	var average, averageOfSquares sql.NullFloat64
+	var minLength, maxLength sql.NullInt64
+	colSql := "[" + col.Name + "]"
+	statsSql := "select count(*), count(" + colSql + "), count(distinct " + colSql + ")"
+	scanTargets := []interface{}{&columnAnalysis.RowCount, &nonNullCount, &columnAnalysis.DistinctCount}
+	switch {
+	case col.Type.IsNumeric():
+		statsSql = statsSql + ", min(" + colSql + "), max(" + colSql + "), avg(cast(" + colSql + " as real)), avg(cast(" + colSql + " as real) * cast(" + colSql + " as real))"
+		scanTargets = append(scanTargets, &columnAnalysis.Min, &columnAnalysis.Max, &average, &averageOfSquares)
+	case col.Type.IsText():
+		statsSql = statsSql + ", min(" + colSql + "), max(" + colSql + "), min(length(" + colSql + ")), max(length(" + colSql + "))"
+		scanTargets = append(scanTargets, &columnAnalysis.Min, &columnAnalysis.Max, &minLength, &maxLength)
+	case col.Type.IsTemporal():
+		statsSql = statsSql + ", min(" + colSql + "), max(" + colSql + ")"
+		scanTargets = append(scanTargets, &columnAnalysis.Min, &columnAnalysis.Max)
+	}
+	statsSql = statsSql + fromSql
+	rows, err := dbc.Query(statsSql)
+	if err != nil {
+		log.Print("GetColumnAnalysis failed to get column stats")
+		log.Println(statsSql)
+		log.Println(err)
+		return
+	}
+	if rows.Next() {
+		rows.Scan(scanTargets...)
+	}
+	rows.Close()
+	columnAnalysis.NullCount = columnAnalysis.RowCount - nonNullCount
+	if average.Valid {
+		columnAnalysis.Average = &average.Float64
+		// sqlite has no stddev function so derive it from the average of the squares
+		stdDev := math.Sqrt(math.Max(0, averageOfSquares.Float64-average.Float64*average.Float64))
+		columnAnalysis.StdDev = &stdDev
+	}
+	if minLength.Valid && maxLength.Valid {
+		minLengthInt, maxLengthInt := int(minLength.Int64), int(maxLength.Int64)
+		columnAnalysis.MinLength = &minLengthInt
+		columnAnalysis.MaxLength = &maxLengthInt
+	}
+
+	var bucketSql string
+	switch {
+	case col.Type.IsText():
+		lengthSql := "length(" + colSql + ")"
+		bucketSql = "select " + lengthSql + ", count(*)" + fromSql + " where " + colSql + " is not null group by " + lengthSql + " order by count(*) desc, " + lengthSql + " limit 100"
+	case col.Type.IsTemporal():
+		monthSql := "strftime('%Y-%m', " + colSql + ")"
+		bucketSql = "select " + monthSql + ", count(*)" + fromSql + " where " + monthSql + " is not null group by " + monthSql + " order by " + monthSql
+	default:
+		return
+	}
+	rows, err = dbc.Query(bucketSql)
+	if err != nil {
+		log.Print("GetColumnAnalysis failed to get column histogram")
+		log.Println(bucketSql)
+		log.Println(err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var bucket string
+		var quantity int
+		rows.Scan(&bucket, &quantity)
+		valueInfo := schema.ValueInfo{Value: bucket, Quantity: quantity}
+		if col.Type.IsText() {
+			length, _ := strconv.Atoi(bucket)
+			valueInfo.Value = length
+			columnAnalysis.LengthCounts = append(columnAnalysis.LengthCounts, valueInfo)
+		} else {
+			columnAnalysis.DateCounts = append(columnAnalysis.DateCounts, valueInfo)
+		}
+	}
+	return
+}
+
+func (model sqliteModel) GetGroupCounts(databaseName string, table *schema.Table, groupBy []params.GroupByCol, tableParams *params.TableParams) (groups []schema.GroupCount, err error) {
+	dbc, err := getConnection(model.path)
+	if err != nil {
+		log.Print("GetGroupCounts failed to get connection")
+		return
+	}
+	defer dbc.Close()
+
+	// only the filters apply, paging and sorting are meaningless for a count
+	innerSql, values := buildQuery(table, &params.TableParams{Filter: tableParams.Filter}, &driver_interface.PeekLookup{})
+	var groupCols []string
+	joinSql := ""
+	for ix, groupCol := range groupBy {
+		groupCols = append(groupCols, fmt.Sprintf("t.[%s]", groupCol.Column.Name))
+		if groupCol.PeekFk != nil {
+			groupCols = append(groupCols, fmt.Sprintf("g%d.[%s]", ix, groupCol.PeekCol.Name))
+			joinSql = joinSql + fmt.Sprintf(" left outer join %s g%d on g%d.[%s] = t.[%s]", "["+groupCol.PeekFk.DestinationTable.Name+"]", ix, ix, groupCol.PeekFk.DestinationColumns[0].Name, groupCol.Column.Name)
+		}
+	}
+	groupBySql := strings.Join(groupCols, ", ")
+	sql := "select " + groupBySql + ", count(*) qty from (" + innerSql + ") t" + joinSql + " group by " + groupBySql + " order by count(*) desc limit 1000"
+	rows, err := dbc.Query(sql, values...)
+	if err != nil {
+		log.Print("GetGroupCounts failed to get query")
+		log.Println(sql)
+		log.Println(err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		scanned := make([]interface{}, len(groupCols))
+		scanTargets := make([]interface{}, len(scanned)+1)
+		for ix := range scanned {
+			scanTargets[ix] = &scanned[ix]
+		}
+		group := schema.GroupCount{}
+		scanTargets[len(scanned)] = &group.Quantity
+		rows.Scan(scanTargets...)
+		scanIndex := 0
+		for _, groupCol := range groupBy {
+			group.Values = append(group.Values, scanned[scanIndex])
+			scanIndex++
+			var peekValue interface{}
+			if groupCol.PeekFk != nil {
+				peekValue = scanned[scanIndex]
+				scanIndex++
+			}
+			group.PeekValues = append(group.PeekValues, peekValue)
+		}
+		groups = append(groups, group)
+	}
+	return
+}
+
+func (model sqliteModel) RunQuery(databaseName string, query string, rowLimit int, timeout time.Duration) (result driver_interface.QueryResult, err error) {
+	dbc, err := getConnection(model.path)
+	if err != nil {
+		log.Print("RunQuery failed to get connection")
+		return
+	}
+	defer dbc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	// the driver ignores read-only transactions, query_only has to be set on the connection that runs the query
+	conn, err := dbc.Conn(ctx)
+	if err != nil {
+		log.Print("RunQuery failed to get connection")
+		return
+	}
+	defer conn.Close()
+	_, err = conn.ExecContext(ctx, "pragma query_only = 1")
+	if err != nil {
+		log.Print("RunQuery failed to make connection read-only")
+		log.Println(err)
+		return
+	}
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		log.Print("RunQuery failed to begin transaction")
+		return
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		log.Print("RunQuery failed to get query")
+		log.Println(query)
+		log.Println(err)
+		return
+	}
+	defer rows.Close()
+	return driver_interface.ReadQueryResult(rows, rowLimit)
+}
+
+func (model sqliteModel) GetOrphans(databaseName string, fk *schema.Fk) (orphans schema.FkOrphans, err error) {
+	dbc, err := getConnection(model.path)
+	if err != nil {
+		log.Print("GetOrphans failed to get connection")
+		return
+	}
+	defer dbc.Close()
+
+	orphans = schema.FkOrphans{Fk: fk}
+	var sourceCols, notNull, joinPredicates []string
+	for ix, sourceCol := range fk.SourceColumns {
+		sourceCols = append(sourceCols, "s.["+sourceCol.Name+"]")
+		notNull = append(notNull, "s.["+sourceCol.Name+"] is not null")
+		joinPredicates = append(joinPredicates, "d.["+fk.DestinationColumns[ix].Name+"] = s.["+sourceCol.Name+"]")
+	}
+	from := " from [" + fk.SourceTable.Name + "] s where " + strings.Join(notNull, " and ") +
+		" and not exists (select 1 from [" + fk.DestinationTable.Name + "] d where " + strings.Join(joinPredicates, " and ") + ")"
+	groupBy := strings.Join(sourceCols, ", ")
+
+	sql := "select count(*)" + from
+	rows, err := dbc.Query(sql)
+	if err != nil {
+		log.Print("GetOrphans failed to count orphans")
+		log.Println(sql)
+		log.Println(err)
+		return
+	}
+	if rows.Next() {
+		rows.Scan(&orphans.RowCount)
+	}
+	rows.Close()
+
+	sql = "select " + groupBy + ", count(*) qty" + from + " group by " + groupBy + " order by count(*) desc limit 100"
+	rows, err = dbc.Query(sql)
+	if err != nil {
+		log.Print("GetOrphans failed to get query")
+		log.Println(sql)
+		log.Println(err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		values := make([]interface{}, len(fk.SourceColumns))
+		scanTargets := make([]interface{}, len(values)+1)
+		for ix := range values {
+			scanTargets[ix] = &values[ix]
+		}
+		var quantity int
+		scanTargets[len(values)] = &quantity
+		rows.Scan(scanTargets...)
+		orphans.ValueCounts = append(orphans.ValueCounts, schema.OrphanValue{
+			Values:   values,
+			Quantity: quantity,
 		})
 	}
 	return
@@ -400,6 +730,14 @@ func (model sqliteModel) GetAnalysis(databaseName string, table *schema.Table) (
 
 func buildQuery(table *schema.Table, params *params.TableParams, peekFinder *driver_interface.PeekLookup) (sql string, values []interface{}) {
 	sql = "select t.*"
+	if len(peekFinder.Columns) > 0 {
+		// only the chosen columns, plus the ones needed for links
+		var selectCols []string
+		for _, col := range peekFinder.Columns {
+			selectCols = append(selectCols, "t.["+col.Name+"]")
+		}
+		sql = "select " + strings.Join(selectCols, ", ")
+	}
 
 	// peek cols
 	for fkIndex, fk := range peekFinder.Fks {
@@ -410,18 +748,14 @@ func buildQuery(table *schema.Table, params *params.TableParams, peekFinder *dri
 
 	// inbound fk counts
 	for inboundFkIndex, inboundFk := range table.InboundFks {
-		onPredicates := []string{}
-		for ix, sourceCol := range inboundFk.SourceColumns {
-			onPredicates = append(onPredicates, fmt.Sprintf("ifk%d.[%s] = t.[%s]", inboundFkIndex, sourceCol.Name, inboundFk.DestinationColumns[ix].Name))
-		}
-		onString := strings.Join(onPredicates, " and ")
-		sql = sql + fmt.Sprintf(", (select count(*) from [%s] ifk%d where %s) ifk%d_count", inboundFk.SourceTable, inboundFkIndex, onString, inboundFkIndex)
+		sql = sql + fmt.Sprintf(", %s ifk%d_count", inboundCountSql(inboundFkIndex, inboundFk), inboundFkIndex)
 	}
 
 	sql = sql + " from [" + table.Name + "] t"
 
 	// peek tables
-	for fkIndex, fk := range peekFinder.Fks {
+	joinFks := peekFinder.JoinFks(params)
+	for fkIndex, fk := range joinFks {
 		sql = sql + fmt.Sprintf(" left outer join [%s] fk%d on ", fk.DestinationTable.String(), fkIndex)
 		onPredicates := []string{}
 		for ix, sourceCol := range fk.SourceColumns {
@@ -438,17 +772,52 @@ func buildQuery(table *schema.Table, params *params.TableParams, peekFinder *dri
 		values = make([]interface{}, 0, len(query))
 		for _, v := range query {
 			col := v.Field
-			clauses = append(clauses, "t.["+col.Name+"] = ?")
+			if v.Related != nil {
+				if v.Related.InboundFk != nil {
+					// the count has no type affinity so wouldn't match the text of the value
+					clauses = append(clauses, relatedValueSql(table, v.Related, joinFks)+" = cast(? as integer)")
+				} else {
+					clauses = append(clauses, relatedValueSql(table, v.Related, joinFks)+" = ?")
+				}
+			} else if len(v.JsonPath) > 0 {
+				clauses = append(clauses, "json_extract(t.["+col.Name+"], ?) = ?")
+				values = append(values, v.JsonPathExpression())
+			} else {
+				clauses = append(clauses, "t.["+col.Name+"] = ?")
+			}
 			values = append(values, v.Values[0]) // todo: maybe support multiple values
 		}
 		sql = sql + strings.Join(clauses, " and ")
 	}
 
-	if len(params.Sort) > 0 {
+	if params.UsesCursor(table) {
+		if len(query) > 0 {
+			sql = sql + " and "
+		} else {
+			sql = sql + " where "
+		}
+		cursorSql, cursorValues := keysetClause(params.KeysetColumns(table), params.Cursor)
+		sql = sql + cursorSql
+		values = append(values, cursorValues...)
+	}
+
+	// paging from a cursor needs a unique order, and reads previous pages backwards.
+	// without one the order is left as it was asked for so as not to make the database sort every limited read.
+	orderBy := params.Sort
+	if params.UsesCursor(table) {
+		orderBy = params.KeysetColumns(table)
+	}
+	backwards := params.UsesCursor(table) && params.Cursor.Backwards
+	if len(orderBy) > 0 {
 		var sortParts []string
-		for _, sortCol := range params.Sort {
-			sortString := "t.[" + sortCol.Column.Name + "]"
-			if sortCol.Descending {
+		for _, sortCol := range orderBy {
+			var sortString string
+			if sortCol.Related != nil {
+				sortString = relatedValueSql(table, sortCol.Related, joinFks)
+			} else {
+				sortString = "t.[" + sortCol.Column.Name + "]"
+			}
+			if sortCol.Descending != backwards {
 				sortString = sortString + " desc"
 			}
 			sortParts = append(sortParts, sortString)
@@ -456,12 +825,90 @@ func buildQuery(table *schema.Table, params *params.TableParams, peekFinder *dri
 		sql = sql + " order by " + strings.Join(sortParts, ", ")
 	}
 
-	if params.RowLimit > 0 || params.SkipRows > 0 {
+	if params.UsesCursor(table) {
+		sql = sql + fmt.Sprintf(" limit %d", params.RowLimit)
+	} else if params.RowLimit > 0 || params.SkipRows > 0 {
 		sql = sql + fmt.Sprintf(" limit %d, %d", params.SkipRows, params.RowLimit)
 	}
 	return sql, values
 }
 
+// Joins the tables along their fks, each table is aliased by its position in the list
+func buildJoinQuery(join driver_interface.JoinQuery) (sql string, values []interface{}) {
+	var selectTables []string
+	for ix := range join.Tables {
+		selectTables = append(selectTables, fmt.Sprintf("t%d.*", ix))
+	}
+	sql = "select " + strings.Join(selectTables, ", ")
+	for ix, joined := range join.Tables {
+		if joined.Step == nil {
+			sql = sql + fmt.Sprintf("\nfrom [%s] t%d", joined.Table.Name, ix)
+			continue
+		}
+		var onPredicates []string
+		toColumns := joined.Step.ToColumns()
+		for colIx, fromCol := range joined.Step.FromColumns() {
+			onPredicates = append(onPredicates, fmt.Sprintf("t%d.[%s] = t%d.[%s]", joined.JoinedTo, fromCol.Name, ix, toColumns[colIx].Name))
+		}
+		sql = sql + fmt.Sprintf("\njoin [%s] t%d on %s", joined.Table.Name, ix, strings.Join(onPredicates, " and "))
+	}
+
+	if len(join.Filters) > 0 {
+		var clauses []string
+		for _, filter := range join.Filters {
+			clauses = append(clauses, fmt.Sprintf("t%d.[%s] = ?", filter.TableIndex, filter.Column.Name))
+			values = append(values, filter.Value)
+		}
+		sql = sql + "\nwhere " + strings.Join(clauses, "\nand ")
+	}
+	return
+}
+
+// Number of rows referencing the row through the inbound fk, as a subquery
+func inboundCountSql(inboundFkIndex int, inboundFk *schema.Fk) string {
+	onPredicates := []string{}
+	for ix, sourceCol := range inboundFk.SourceColumns {
+		onPredicates = append(onPredicates, fmt.Sprintf("ifk%d.[%s] = t.[%s]", inboundFkIndex, sourceCol.Name, inboundFk.DestinationColumns[ix].Name))
+	}
+	onString := strings.Join(onPredicates, " and ")
+	return fmt.Sprintf("(select count(*) from [%s] ifk%d where %s)", inboundFk.SourceTable, inboundFkIndex, onString)
+}
+
+// Expression for a peeked value (from the peek joins) or an inbound count, for sorting and filtering on
+func relatedValueSql(table *schema.Table, related *params.RelatedValue, joinFks []*schema.Fk) string {
+	if related.InboundFk != nil {
+		for inboundFkIndex, inboundFk := range table.InboundFks {
+			if inboundFk == related.InboundFk {
+				return inboundCountSql(inboundFkIndex, inboundFk)
+			}
+		}
+	}
+	return fmt.Sprintf("fk%d.[%s]", driver_interface.JoinIndex(joinFks, related.PeekFk), related.PeekCol)
+}
+
+// Rows after (or before) the cursor in the keyset order, e.g. for keyset (a, b) after (1, 2):
+// ((t.[a] > ?) or (t.[a] = ? and t.[b] > ?)) with values 1, 1, 2
+func keysetClause(keyset []params.SortCol, cursor *params.KeysetCursor) (sql string, values []interface{}) {
+	var alternatives []string
+	for ix, sortCol := range keyset {
+		var parts []string
+		for _, equalCol := range keyset[:ix] {
+			parts = append(parts, "t.["+equalCol.Column.Name+"] = ?")
+		}
+		operator := ">"
+		if sortCol.Descending != cursor.Backwards {
+			operator = "<"
+		}
+		parts = append(parts, "t.["+sortCol.Column.Name+"] "+operator+" ?")
+		alternatives = append(alternatives, "("+strings.Join(parts, " and ")+")")
+		for _, value := range cursor.Values[:ix+1] {
+			values = append(values, value)
+		}
+	}
+	sql = "(" + strings.Join(alternatives, " or ") + ")"
+	return
+}
+
 func (model sqliteModel) getColumns(dbc *sql.DB, table *schema.Table) (cols []*schema.Column, err error) {
 	// todo: parameterise
 	rows, err := dbc.Query("PRAGMA table_info('" + table.Name + "');")
@@ -480,19 +927,149 @@ func (model sqliteModel) getColumns(dbc *sql.DB, table *schema.Table) (cols []*s
 		thisCol := schema.Column{
 			Position:       colIndex,
 			Name:           name,
-			Type:           typeName,
+			Type:           parseDataType(typeName),
 			IsInPrimaryKey: pk > 0,
 			Nullable:       !notNull,
 		}
+		if defaultValue != nil {
+			thisCol.Default = fmt.Sprintf("%s", defaultValue)
+		}
 		cols = append(cols, &thisCol)
 		if pk > 0 {
 			table.Pk.Columns = append(table.Pk.Columns, &thisCol)
 		}
 		colIndex++
 	}
+	// a single "integer primary key" column is an alias for the auto-assigned rowid https://www.sqlite.org/lang_createtable.html#rowid
+	if len(table.Pk.Columns) == 1 && strings.EqualFold(table.Pk.Columns[0].Type.Name, "integer") {
+		table.Pk.Columns[0].IsIdentity = true
+	}
 	return
 }
 
+// Splits a declared type such as "DECIMAL(10,5)" or "VARCHAR(255)" into its parts.
+// Sqlite ignores the sizes https://www.sqlite.org/datatype3.html but they still tell the user what was intended.
+func parseDataType(declaredType string) (dataType schema.DataType) {
+	declaredType = strings.TrimSpace(declaredType)
+	openIndex := strings.IndexByte(declaredType, '(')
+	closeIndex := strings.LastIndexByte(declaredType, ')')
+	if openIndex < 0 || closeIndex < openIndex {
+		dataType.Name = declaredType
+		dataType.IsJson = strings.EqualFold(declaredType, "json") // sqlite stores json as text, but the declared type tells us what's intended
+		return
+	}
+	var sizes []int
+	for _, part := range strings.Split(declaredType[openIndex+1:closeIndex], ",") {
+		size, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			// not something we understand, leave it as it was declared
+			return schema.DataType{Name: declaredType}
+		}
+		sizes = append(sizes, size)
+	}
+	dataType.Name = strings.TrimSpace(declaredType[:openIndex])
+	lowerName := strings.ToLower(dataType.Name)
+	switch {
+	case len(sizes) == 2:
+		dataType.Precision = &sizes[0]
+		dataType.Scale = &sizes[1]
+	case len(sizes) == 1 && (strings.Contains(lowerName, "char") || strings.Contains(lowerName, "binary")):
+		dataType.MaxLength = &sizes[0]
+	case len(sizes) == 1:
+		dataType.Precision = &sizes[0]
+	default:
+		return schema.DataType{Name: declaredType}
+	}
+	return
+}
+
+func getCheckConstraints(dbc *sql.DB, table *schema.Table) (err error) {
+	// sqlite doesn't expose check constraints so we have to dig them out of the original create statement
+	var createSql string
+	err = dbc.QueryRow("select sql from sqlite_master where type='table' and name = ?;", table.Name).Scan(&createSql)
+	if err != nil {
+		return
+	}
+	table.CheckConstraints = parseCheckConstraints(createSql, table)
+	return
+}
+
+// Finds "[constraint name] check (expression)" clauses in a create table statement,
+// skipping over quoted names and string literals.
+func parseCheckConstraints(createSql string, table *schema.Table) (constraints []*schema.CheckConstraint) {
+	var words []string // previous words, for finding the constraint name
+	for i := 0; i < len(createSql); i++ {
+		c := createSql[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`' || c == '[':
+			closer := c
+			if c == '[' {
+				closer = ']'
+			}
+			end := strings.IndexByte(createSql[i+1:], closer)
+			if end < 0 {
+				return
+			}
+			words = append(words, createSql[i+1:i+1+end])
+			i = i + 1 + end
+		case isWordChar(c):
+			start := i
+			for i < len(createSql) && isWordChar(createSql[i]) {
+				i++
+			}
+			word := createSql[start:i]
+			i-- // let the loop move on to the next character
+			if !strings.EqualFold(word, "check") {
+				words = append(words, word)
+				continue
+			}
+			open := strings.IndexByte(createSql[i+1:], '(')
+			if open < 0 || strings.TrimSpace(createSql[i+1:i+1+open]) != "" {
+				continue
+			}
+			start = i + 1 + open
+			end := findClosingBracket(createSql, start)
+			if end < 0 {
+				return
+			}
+			constraint := &schema.CheckConstraint{Clause: createSql[start : end+1], Table: table}
+			if len(words) >= 2 && strings.EqualFold(words[len(words)-2], "constraint") {
+				constraint.Name = words[len(words)-1]
+			}
+			constraints = append(constraints, constraint)
+			i = end
+		}
+	}
+	return
+}
+
+func isWordChar(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// returns the index of the bracket matching the one at openIndex, or -1 if unbalanced
+func findClosingBracket(text string, openIndex int) int {
+	depth := 0
+	for i := openIndex; i < len(text); i++ {
+		switch text[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		case '\'':
+			end := strings.IndexByte(text[i+1:], '\'')
+			if end < 0 {
+				return -1
+			}
+			i = i + 1 + end
+		}
+	}
+	return -1
+}
+
 func (model sqliteModel) SetTableDescription(database string, table string, description string) (err error) {
 	return
 }
@@ -353,3 +353,109 @@ create table coz(
 );
 insert into coz(id, name, poke_id) values (1, 'andy', 11);
 insert into coz(id, name, poke_id) values (2, 'bob', 11);
+
+create table constraint_test(
+  id integer primary key,
+  size int default 10,
+  code varchar(10),
+  constraint CK_size check (size > 0),
+  constraint UQ_code unique (code)
+);
+insert into constraint_test(size, code) values (5, 'abc');
+
+create table type_test(
+  id int primary key,
+  amount decimal(10,2),
+  code varchar(10)
+);
+insert into type_test(id, amount, code) values (1, 12.34, 'abc');
+
+create table json_test(
+  id int primary key,
+  payload json
+);
+insert into json_test(id, payload) values (1, '{"status": "shipped", "customer": {"name": "bob"}, "items": [{"sku": "a1"}]}');
+insert into json_test(id, payload) values (2, '{"status": "pending", "customer": {"name": "fred"}, "items": []}');
+
+create table binary_test(
+  id int primary key,
+  content blob
+);
+insert into binary_test(id, content) values (1, X'89504E470D0A1A0A0000000D');
+insert into binary_test(id, content) values (2, X'68656C6C6F');
+insert into binary_test(id, content) values (3, null);
+
+-- no declared fks, for testing inferring them from column names
+create table infer_customers(
+  id int primary key,
+  name varchar(50)
+);
+insert into infer_customers(id, name) values (1, 'alice');
+insert into infer_customers(id, name) values (2, 'bob');
+create table infer_orders(
+  id int primary key,
+  infer_customer_id int
+);
+insert into infer_orders(id, infer_customer_id) values (10, 1);
+insert into infer_orders(id, infer_customer_id) values (11, 2);
+insert into infer_orders(id, infer_customer_id) values (12, 1);
+-- name matches but the values don't, so shouldn't survive validation
+create table infer_order_notes(
+  id int primary key,
+  infer_order_id int
+);
+insert into infer_order_notes(id, infer_order_id) values (1, 98);
+insert into infer_order_notes(id, infer_order_id) values (2, 99);
+
+-- no declared fk, for testing relationships from the virtual fks config
+create table virtual_parent(
+  id int primary key,
+  name varchar(50)
+);
+insert into virtual_parent(id, name) values (1, 'first');
+insert into virtual_parent(id, name) values (2, 'second');
+create table virtual_child(
+  id int primary key,
+  parent_ref int
+);
+insert into virtual_child(id, parent_ref) values (1, 1);
+insert into virtual_child(id, parent_ref) values (2, 2);
+insert into virtual_child(id, parent_ref) values (3, 1);
+-- orphans, parent 99 doesn't exist
+insert into virtual_child(id, parent_ref) values (4, 99);
+insert into virtual_child(id, parent_ref) values (5, 99);
+insert into virtual_child(id, parent_ref) values (6, null);
+
+create table analysis_stats_test(
+  id int primary key,
+  amount int,
+  label varchar(20),
+  created date
+);
+insert into analysis_stats_test(id, amount, label, created) values (1, 10, 'a', '2020-01-15');
+insert into analysis_stats_test(id, amount, label, created) values (2, 20, 'bb', '2020-01-20');
+insert into analysis_stats_test(id, amount, label, created) values (3, 30, 'ccc', '2020-03-01');
+insert into analysis_stats_test(id, amount, label, created) values (4, null, 'bb', null);
+
+create table group_owner(
+  id int primary key,
+  name varchar(50)
+);
+insert into group_owner(id, name) values (1, 'alice');
+insert into group_owner(id, name) values (2, 'bob');
+create table group_test(
+  id int primary key,
+  status varchar(10),
+  owner_id int,
+  foreign key (owner_id) references group_owner(id)
+);
+insert into group_test(id, status, owner_id) values (1, 'open', 1);
+insert into group_test(id, status, owner_id) values (2, 'open', 1);
+insert into group_test(id, status, owner_id) values (3, 'closed', 1);
+insert into group_test(id, status, owner_id) values (4, 'open', 2);
+insert into group_test(id, status, owner_id) values (5, 'closed', null);
+create table search_test(
+  id int primary key,
+  label varchar(50)
+);
+insert into search_test(id, label) values (1, 'quokka');
@@ -30,17 +30,25 @@ import (
 	"github.com/timabell/schema-explorer/params"
 	_ "github.com/timabell/schema-explorer/pg"
 	"github.com/timabell/schema-explorer/reader"
+	"github.com/timabell/schema-explorer/saved"
 	"github.com/timabell/schema-explorer/schema"
 	"github.com/timabell/schema-explorer/serve"
 	_ "github.com/timabell/schema-explorer/sqlite"
+	"context"
 	"fmt"
 	"github.com/gorilla/mux"
+	"io/ioutil"
 	"log"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
 	"reflect"
+	"regexp"
 	"strings"
 	"testing"
+	"time"
 )
 
 var testDb string
@@ -89,6 +97,33 @@ func Test_ReadSchema(t *testing.T) {
 	t.Log("Checking indexes")
 	checkIndexes(database, t)
 
+	t.Log("Checking constraints")
+	checkConstraints(database, t)
+
+	t.Log("Checking data types")
+	checkDataTypes(database, t)
+
+	t.Log("Checking pg type names")
+	checkPgTypeNames(database, t)
+
+	t.Log("Checking schema search")
+	checkSchemaSearch(database, t)
+
+	t.Log("Checking enums")
+	checkEnums(database, t)
+
+	t.Log("Checking structured types")
+	checkStructuredTypes(reader, database, t)
+
+	t.Log("Checking json")
+	checkJson(reader, database, t)
+
+	t.Log("Checking binary")
+	checkBinary(reader, database, t)
+
+	t.Log("Checking spatial")
+	checkSpatial(reader, database, t)
+
 	if database.Supports.Descriptions {
 		t.Log("Checking descriptions")
 		checkDescriptions(database, t)
@@ -111,6 +146,15 @@ func Test_ReadSchema(t *testing.T) {
 	t.Log("Checking table analysis")
 	checkTableAnalysis(reader, database, t)
 
+	t.Log("Checking column stats")
+	checkColumnStats(reader, database, t)
+
+	t.Log("Checking group counts")
+	checkGroupCounts(reader, database, t)
+
+	t.Log("Checking value search")
+	checkValueSearch(reader, database, t)
+
 	t.Log("Checking keyword escaping")
 	checkKeywordEscaping(reader, database, t)
 
@@ -119,6 +163,30 @@ func Test_ReadSchema(t *testing.T) {
 
 	t.Log("Checking inbound peeking")
 	checkInboundPeeking(reader, database, t)
+
+	t.Log("Checking column selection")
+	checkColumnSelection(reader, database, t)
+
+	t.Log("Checking related values")
+	checkRelatedValues(reader, database, t)
+
+	t.Log("Checking ad-hoc queries")
+	checkQuery(reader, database, t)
+
+	t.Log("Checking generated sql text")
+	checkSqlText(reader, database, t)
+
+	t.Log("Checking query plans")
+	checkQueryPlan(reader, database, t)
+
+	t.Log("Checking join paths")
+	checkJoinPaths(reader, database, t)
+
+	t.Log("Checking table trail joins")
+	checkTrailJoin(reader, database, t)
+
+	t.Log("Checking untrusted fks")
+	checkUntrustedFks(database, t)
 }
 
 func checkIndexes(database *schema.Database, t *testing.T) {
@@ -245,6 +313,277 @@ func checkNullable(database *schema.Database, t *testing.T) {
 	}
 }
 
+func checkConstraints(database *schema.Database, t *testing.T) {
+	table := findTable(schema.Table{Schema: database.DefaultSchemaName, Name: "constraint_test"}, database, t)
+
+	idCol := findColumn(table, "id", t)
+	if !idCol.IsIdentity {
+		t.Errorf("%s.%s should be an identity column", table, idCol)
+	}
+	sizeCol := findColumn(table, "size", t)
+	if !strings.Contains(sizeCol.Default, "10") {
+		t.Errorf("Got default '%s' for %s.%s, expected it to contain '10'", sizeCol.Default, table, sizeCol)
+	}
+
+	checkInt(1, len(table.CheckConstraints), fmt.Sprintf("check constraints on %s", table), t)
+	for _, check := range table.CheckConstraints {
+		checkStr("CK_size", check.Name, "check constraint name", t)
+		if !strings.Contains(check.Clause, "size") {
+			t.Errorf("Got clause '%s' for check constraint %s, expected it to reference size", check.Clause, check.Name)
+		}
+	}
+
+	// sqlite doesn't name unique constraints so match on columns
+	checkInt(1, len(table.UniqueConstraints), fmt.Sprintf("unique constraints on %s", table), t)
+	for _, unique := range table.UniqueConstraints {
+		checkInt(1, len(unique.Columns), fmt.Sprintf("columns in unique constraint on %s", table), t)
+		if len(unique.Columns) == 1 {
+			checkStr("code", unique.Columns[0].Name, "unique constraint column", t)
+		}
+	}
+}
+
+func checkDataTypes(database *schema.Database, t *testing.T) {
+	table := findTable(schema.Table{Schema: database.DefaultSchemaName, Name: "type_test"}, database, t)
+
+	codeCol := findColumn(table, "code", t)
+	if codeCol.Type.MaxLength == nil {
+		t.Errorf("%s.%s should have a max length", table, codeCol)
+	} else {
+		checkInt(10, *codeCol.Type.MaxLength, fmt.Sprintf("max length of %s.%s", table, codeCol), t)
+	}
+	expectedCodeType := "varchar(10)"
+	if options.Options.Driver == "pg" {
+		// shown the way psql shows it
+		expectedCodeType = "character varying(10)"
+	}
+	checkStr(expectedCodeType, strings.ToLower(codeCol.Type.String()), fmt.Sprintf("full type of %s.%s", table, codeCol), t)
+
+	amountCol := findColumn(table, "amount", t)
+	if amountCol.Type.Precision == nil || amountCol.Type.Scale == nil {
+		t.Errorf("%s.%s should have precision and scale", table, amountCol)
+	} else {
+		checkInt(10, *amountCol.Type.Precision, fmt.Sprintf("precision of %s.%s", table, amountCol), t)
+		checkInt(2, *amountCol.Type.Scale, fmt.Sprintf("scale of %s.%s", table, amountCol), t)
+	}
+	if !strings.HasSuffix(amountCol.Type.String(), "(10,2)") {
+		t.Errorf("Got '%s' for full type of %s.%s, expected it to end with '(10,2)'", amountCol.Type, table, amountCol)
+	}
+
+	idCol := findColumn(table, "id", t)
+	if idCol.Type.MaxLength != nil || idCol.Type.Precision != nil || idCol.Type.Scale != nil {
+		t.Errorf("%s.%s shouldn't have any sizes, got full type '%s'", table, idCol, idCol.Type)
+	}
+}
+
+// pg reads sizes out of the type modifier, and shows types by their sql standard names rather than typname
+func checkPgTypeNames(database *schema.Database, t *testing.T) {
+	table := database.FindTable(&schema.Table{Schema: database.DefaultSchemaName, Name: "pg_type_test"})
+	if table == nil {
+		t.Log("No pg_type_test table, not pg")
+		return
+	}
+
+	initialsCol := findColumn(table, "initials", t)
+	checkStr("bpchar", initialsCol.Type.Name, fmt.Sprintf("type name of %s.%s", table, initialsCol), t)
+	checkStr("character(3)", initialsCol.Type.String(), fmt.Sprintf("full type of %s.%s", table, initialsCol), t)
+
+	stampCol := findColumn(table, "stamp", t)
+	if stampCol.Type.Precision == nil {
+		t.Errorf("%s.%s should have a precision", table, stampCol)
+	} else {
+		checkInt(3, *stampCol.Type.Precision, fmt.Sprintf("precision of %s.%s", table, stampCol), t)
+	}
+	checkStr("timestamp(3) with time zone", stampCol.Type.String(), fmt.Sprintf("full type of %s.%s", table, stampCol), t)
+
+	timeCol := findColumn(table, "whole_seconds", t)
+	if timeCol.Type.Precision == nil {
+		t.Errorf("%s.%s should have a precision", table, timeCol)
+	} else {
+		checkInt(0, *timeCol.Type.Precision, fmt.Sprintf("precision of %s.%s", table, timeCol), t)
+	}
+	checkStr("time(0) without time zone", timeCol.Type.String(), fmt.Sprintf("full type of %s.%s", table, timeCol), t)
+}
+
+func checkEnums(database *schema.Database, t *testing.T) {
+	table := database.FindTable(&schema.Table{Schema: database.DefaultSchemaName, Name: "enum_test"})
+	if table == nil {
+		t.Log("No enum_test table, enums not supported")
+		return
+	}
+
+	moodCol := findColumn(table, "mood", t)
+	if !moodCol.Type.IsEnum() {
+		t.Errorf("%s.%s should be an enum", table, moodCol)
+	}
+	expected := []string{"sad", "ok", "happy"}
+	if !reflect.DeepEqual(expected, moodCol.Type.EnumValues) {
+		t.Errorf("Got enum values %#v for %s.%s, expected %#v", moodCol.Type.EnumValues, table, moodCol, expected)
+	}
+
+	// mysql only
+	_, toppingsCol := table.FindColumn("toppings")
+	if toppingsCol != nil {
+		if !toppingsCol.Type.IsSet || toppingsCol.Type.IsEnum() {
+			t.Errorf("%s.%s should be a set and not an enum", table, toppingsCol)
+		}
+		expected := []string{"cheese", "ham", "it's"}
+		if !reflect.DeepEqual(expected, toppingsCol.Type.EnumValues) {
+			t.Errorf("Got set values %#v for %s.%s, expected %#v", toppingsCol.Type.EnumValues, table, toppingsCol, expected)
+		}
+	}
+}
+
+func checkStructuredTypes(dbReader driver_interface.DbReader, database *schema.Database, t *testing.T) {
+	table := database.FindTable(&schema.Table{Schema: database.DefaultSchemaName, Name: "structured_test"})
+	if table == nil {
+		t.Log("No structured_test table, arrays/ranges/composites not supported")
+		return
+	}
+
+	tagsCol := findColumn(table, "tags", t)
+	if !tagsCol.Type.IsArray() {
+		t.Errorf("%s.%s should be an array", table, tagsCol)
+	} else {
+		checkStr("text", tagsCol.Type.ElementType.Name, fmt.Sprintf("element type of %s.%s", table, tagsCol), t)
+	}
+	moodsCol := findColumn(table, "moods", t)
+	if !moodsCol.Type.IsArray() || !moodsCol.Type.ElementType.IsEnum() {
+		t.Errorf("%s.%s should be an array of enums", table, moodsCol)
+	}
+	availableCol := findColumn(table, "available", t)
+	if !availableCol.Type.IsRange {
+		t.Errorf("%s.%s should be a range", table, availableCol)
+	}
+	homeCol := findColumn(table, "home", t)
+	if !homeCol.Type.IsComposite {
+		t.Errorf("%s.%s should be a composite", table, homeCol)
+	}
+
+	tableParams := &params.TableParams{
+		Filter: params.FieldFilterList{{Field: tagsCol, Values: []string{"big cat"}, ArrayContains: true}},
+	}
+	rows, _, err := reader.GetRows(dbReader, database.Name, table, tableParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkInt(1, len(rows), "rows with tags containing 'big cat'", t)
+	if len(rows) == 1 {
+		checkStr(`{red,"big cat",NULL}`, *reader.DbValueToString(rows[0][tagsCol.Position], tagsCol.Type), "tags value", t)
+		checkStr("[1,10)", *reader.DbValueToString(rows[0][availableCol.Position], availableCol.Type), "range value", t)
+		checkStr(`("1 High St",London)`, *reader.DbValueToString(rows[0][homeCol.Position], homeCol.Type), "composite value", t)
+	}
+}
+
+func checkBinary(dbReader driver_interface.DbReader, database *schema.Database, t *testing.T) {
+	table := findTable(schema.Table{Schema: database.DefaultSchemaName, Name: "binary_test"}, database, t)
+	contentCol := findColumn(table, "content", t)
+	if !contentCol.Type.IsBinary() {
+		t.Errorf("%s.%s should be binary, type %s", table, contentCol, contentCol.Type)
+	}
+	_, idCol := table.FindColumn("id")
+	binaryCases := []struct {
+		id       string
+		fileType string
+		length   int
+	}{
+		{id: "1", fileType: "PNG", length: 12},
+		{id: "2", fileType: "", length: 5},
+	}
+	for _, binaryCase := range binaryCases {
+		rowParams := &params.TableParams{Filter: params.FieldFilterList{{Field: idCol, Values: []string{binaryCase.id}}}}
+		value, err := reader.GetCellValue(dbReader, database.Name, table, contentCol, rowParams)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, ok := reader.BinaryValue(value)
+		if !ok {
+			t.Fatalf("expected bytes for %s.%s id %s, got %T", table, contentCol, binaryCase.id, value)
+		}
+		subject := fmt.Sprintf("%s.%s id %s", table, contentCol, binaryCase.id)
+		checkInt(binaryCase.length, len(data), "length of "+subject, t)
+		actualFileType := ""
+		if fileType := reader.DetectFileType(data); fileType != nil {
+			actualFileType = fileType.Name
+		}
+		checkStr(binaryCase.fileType, actualFileType, "file type of "+subject, t)
+	}
+	_, err := reader.GetCellValue(dbReader, database.Name, table, contentCol, &params.TableParams{})
+	if err == nil {
+		t.Errorf("expected an error reading a cell of %s without a primary key value", table)
+	}
+}
+
+func checkSpatial(dbReader driver_interface.DbReader, database *schema.Database, t *testing.T) {
+	table := database.FindTable(&schema.Table{Schema: database.DefaultSchemaName, Name: "spatial_test"})
+	if table == nil {
+		t.Log("No spatial types in this database")
+		return
+	}
+	_, idCol := table.FindColumn("id")
+	rowParams := &params.TableParams{Filter: params.FieldFilterList{{Field: idCol, Values: []string{"1"}}}}
+	rows, _, err := reader.GetRows(dbReader, database.Name, table, rowParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkInt(1, len(rows), "rows of "+table.String(), t)
+	spatialCases := []struct {
+		colName  string
+		expected string
+	}{
+		{colName: "location", expected: "POINT (1 2)"},
+		{colName: "area", expected: "POLYGON ((0 0, 10 0, 10 10, 0 10, 0 0))"},
+	}
+	for _, spatialCase := range spatialCases {
+		col := findColumn(table, spatialCase.colName, t)
+		if !col.Type.IsSpatial() {
+			t.Errorf("%s.%s should be spatial, type %s", table, col, col.Type)
+			continue
+		}
+		actual := reader.DbValueToString(rows[0][col.Position], col.Type)
+		if actual == nil {
+			t.Errorf("%s.%s unexpectedly null", table, col)
+			continue
+		}
+		checkStr(spatialCase.expected, *actual, fmt.Sprintf("%s.%s", table, col), t)
+	}
+}
+
+func checkJson(dbReader driver_interface.DbReader, database *schema.Database, t *testing.T) {
+	table := findTable(schema.Table{Schema: database.DefaultSchemaName, Name: "json_test"}, database, t)
+	payloadCol := findColumn(table, "payload", t)
+	if !payloadCol.Type.IsJson {
+		t.Errorf("%s.%s should be json", table, payloadCol)
+	}
+	if !database.Supports.JsonFilter {
+		t.Log("Json filtering not supported")
+		return
+	}
+	jsonCases := []struct {
+		path  []string
+		value string
+		id    int64
+	}{
+		{path: []string{"customer", "name"}, value: "bob", id: 1},
+		{path: []string{"status"}, value: "pending", id: 2},
+		{path: []string{"items", "0", "sku"}, value: "a1", id: 1},
+	}
+	for _, jsonCase := range jsonCases {
+		tableParams := &params.TableParams{
+			Filter: params.FieldFilterList{{Field: payloadCol, Values: []string{jsonCase.value}, JsonPath: jsonCase.path}},
+		}
+		rows, _, err := reader.GetRows(dbReader, database.Name, table, tableParams)
+		if err != nil {
+			t.Fatal(err)
+		}
+		subject := fmt.Sprintf("rows with %s = %s", strings.Join(jsonCase.path, "."), jsonCase.value)
+		checkInt(1, len(rows), subject, t)
+		if len(rows) == 1 {
+			checkInt64(jsonCase.id, rows[0][0].(int64), "id of "+subject, t)
+		}
+	}
+}
+
 func checkTableRowCount(reader driver_interface.DbReader, database *schema.Database, t *testing.T) {
 	table := findTable(schema.Table{Schema: database.DefaultSchemaName, Name: "SortFilterTest"}, database, t)
 
@@ -517,6 +856,58 @@ func checkPaging(dbReader driver_interface.DbReader, database *schema.Database,
 	tableParams.Sort = []params.SortCol{{Column: idCol}} // have to sort to use paging for sql server
 	// check with sort
 	pagingChecker(dbReader, database.Name, table, tableParams, t, idCol)
+
+	// keyset paging from the ids either side of the page
+	keysetParams := &params.TableParams{RowLimit: 2, SkipRows: 3, Cursor: &params.KeysetCursor{Values: []string{"3"}}}
+	if !keysetParams.UsesCursor(table) {
+		t.Fatal("keyset paging not used for " + table.String())
+	}
+	pagingChecker(dbReader, database.Name, table, keysetParams, t, idCol)
+	keysetParams = &params.TableParams{RowLimit: 2, SkipRows: 3, Cursor: &params.KeysetCursor{Values: []string{"6"}, Backwards: true}}
+	pagingChecker(dbReader, database.Name, table, keysetParams, t, idCol)
+
+	// the cursor survives the query string
+	roundTripped, _ := url.ParseQuery(string(params.TableParams{RowLimit: 2, SkipRows: 1}.NextPageAfter([]string{"3"}).AsQueryString()))
+	pagingChecker(dbReader, database.Name, table, params.ParseTableParams(roundTripped, table), t, idCol)
+
+	// descending keyset
+	keysetParams = &params.TableParams{RowLimit: 2, SkipRows: 2, Sort: []params.SortCol{{Column: idCol, Descending: true}}, Cursor: &params.KeysetCursor{Values: []string{"6"}}}
+	rows, _, err := reader.GetRows(dbReader, database.Name, table, keysetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkInt(2, len(rows), "rows after 6 descending", t)
+	if len(rows) == 2 {
+		checkInt(5, int(rows[0][idCol.Position].(int64)), "first row after 6 descending", t)
+		checkInt(4, int(rows[1][idCol.Position].(int64)), "second row after 6 descending", t)
+	}
+
+	// can't seek on a nullable column so offset paging is used
+	sizeCol := findColumn(table, "size", t)
+	nullableSort := params.TableParams{RowLimit: 2, Sort: []params.SortCol{{Column: sizeCol}}}
+	if nullableSort.KeysetColumns(table) != nil {
+		t.Error("keyset paging on nullable column " + sizeCol.Name)
+	}
+
+	// the primary key is only added to the order when paging from a cursor
+	unsorted := &params.TableParams{RowLimit: 2}
+	_, peekFinder, err := reader.GetRows(dbReader, database.Name, table, unsorted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sqlText := strings.ToLower(dbReader.GetSqlText(database.Name, table, unsorted, peekFinder)); strings.Contains(sqlText, "order by") {
+		t.Errorf("expected no order by without a sort or cursor: %s", sqlText)
+	}
+	if unsorted.ReadsInKeysetOrder(table) {
+		t.Error("unsorted rows without a cursor shouldn't be paged by key")
+	}
+	if !(params.TableParams{RowLimit: 2, Sort: []params.SortCol{{Column: idCol}}}).ReadsInKeysetOrder(table) {
+		t.Error("rows sorted by the primary key should be paged by key")
+	}
+	cursorPage := &params.TableParams{RowLimit: 2, SkipRows: 2, Cursor: &params.KeysetCursor{Values: []string{"2"}}}
+	if sqlText := strings.ToLower(dbReader.GetSqlText(database.Name, table, cursorPage, peekFinder)); !strings.Contains(sqlText, "order by") {
+		t.Errorf("expected paging from a cursor to be ordered: %s", sqlText)
+	}
 }
 
 func pagingChecker(dbReader driver_interface.DbReader, databaseName string, table *schema.Table, tableParams *params.TableParams, t *testing.T, idCol *schema.Column) {
@@ -553,10 +944,7 @@ func checkTableAnalysis(dbReader driver_interface.DbReader, database *schema.Dat
 	table := findTable(schema.Table{Schema: database.DefaultSchemaName, Name: "analysis_test"}, database, t)
 	colName := "colour"
 	_, col := table.FindColumn(colName)
-	analysis, err := dbReader.GetAnalysis(database.Name, table)
-	if err != nil {
-		t.Fatal(err)
-	}
+	analysis := analyseTable(dbReader, database.Name, table, t)
 	checkInt(1, len(analysis), "columns analysed in "+table.String(), t)
 	colourAnalysis := analysis[0]
 	checkStr(colName, colourAnalysis.Column.Name, "only col in "+table.String(), t)
@@ -583,6 +971,173 @@ func checkTableAnalysis(dbReader driver_interface.DbReader, database *schema.Dat
 	}
 }
 
+func checkColumnStats(dbReader driver_interface.DbReader, database *schema.Database, t *testing.T) {
+	table := findTable(schema.Table{Schema: database.DefaultSchemaName, Name: "analysis_stats_test"}, database, t)
+	analysis := analyseTable(dbReader, database.Name, table, t)
+	checkInt(4, len(analysis), "columns analysed in "+table.String(), t)
+
+	amount := analysis[1]
+	checkInt(4, amount.RowCount, "rows analysed in amount", t)
+	checkInt(1, amount.NullCount, "nulls in amount", t)
+	checkInt(3, amount.DistinctCount, "distinct values in amount", t)
+	checkStr("10", *reader.DbValueToString(amount.Min, amount.Column.Type), "min amount", t)
+	checkStr("30", *reader.DbValueToString(amount.Max, amount.Column.Type), "max amount", t)
+	if amount.Average == nil || *amount.Average != 20 {
+		t.Errorf("average amount %v expected 20", amount.Average)
+	}
+	if amount.StdDev == nil || fmt.Sprintf("%.3f", *amount.StdDev) != "8.165" {
+		t.Errorf("amount standard deviation %v expected 8.165", amount.StdDev)
+	}
+
+	label := analysis[2]
+	checkInt(3, label.DistinctCount, "distinct values in label", t)
+	if label.MinLength == nil || label.MaxLength == nil {
+		t.Fatal("label lengths missing")
+	}
+	checkInt(1, *label.MinLength, "min label length", t)
+	checkInt(3, *label.MaxLength, "max label length", t)
+	checkInt(3, len(label.LengthCounts), "label lengths", t)
+	if len(label.LengthCounts) == 3 {
+		checkInt(2, label.LengthCounts[0].Value.(int), "most common label length", t)
+		checkInt(2, label.LengthCounts[0].Quantity, "labels of the most common length", t)
+	}
+	if label.Average != nil {
+		t.Error("label shouldn't have an average")
+	}
+
+	created := analysis[3]
+	checkInt(1, created.NullCount, "nulls in created", t)
+	expectedMonths := []schema.ValueInfo{{Value: "2020-01", Quantity: 2}, {Value: "2020-03", Quantity: 1}}
+	if !reflect.DeepEqual(expectedMonths, created.DateCounts) {
+		t.Errorf("created months %v expected %v", created.DateCounts, expectedMonths)
+	}
+}
+
+func checkGroupCounts(dbReader driver_interface.DbReader, database *schema.Database, t *testing.T) {
+	table := findTable(schema.Table{Schema: database.DefaultSchemaName, Name: "group_test"}, database, t)
+	statusCol := findColumn(table, "status", t)
+	ownerCol := findColumn(table, "owner_id", t)
+	ownerFk := table.Fks[0]
+	nameCol := findColumn(ownerFk.DestinationTable, "name", t)
+
+	groups, err := dbReader.GetGroupCounts(database.Name, table, []params.GroupByCol{{Column: statusCol}}, &params.TableParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkInt(2, len(groups), "status groups", t)
+	checkStr("open", fmt.Sprintf("%s", groups[0].Values[0]), "largest status group", t)
+	checkInt(3, groups[0].Quantity, "rows in largest status group", t)
+
+	// group by the owner's name and apply a filter to check the where clause survives the join
+	ownerName := params.GroupByCol{Column: ownerCol, PeekFk: ownerFk, PeekCol: nameCol}
+	filtered := &params.TableParams{Filter: params.FieldFilterList{{Field: statusCol, Values: []string{"open"}}}}
+	groups, err = dbReader.GetGroupCounts(database.Name, table, []params.GroupByCol{ownerName}, filtered)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkInt(2, len(groups), "open owner groups", t)
+	checkStr("alice", fmt.Sprintf("%s", groups[0].PeekValues[0]), "peeked owner of largest open group", t)
+	checkInt(2, groups[0].Quantity, "open rows owned by alice", t)
+	checkStr("1", *reader.DbValueToString(groups[0].Values[0], ownerCol.Type), "owner id of largest open group", t)
+
+	groups, err = dbReader.GetGroupCounts(database.Name, table, []params.GroupByCol{{Column: statusCol}, ownerName}, &params.TableParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkInt(4, len(groups), "status and owner groups", t)
+	checkInt(2, groups[0].Quantity, "rows in largest status and owner group", t)
+	for _, group := range groups {
+		if group.Values[1] == nil && (group.PeekValues[1] != nil || group.Quantity != 1) {
+			t.Errorf("unowned group %v expected one row with no peeked name", group)
+		}
+	}
+}
+
+func checkSchemaSearch(database *schema.Database, t *testing.T) {
+	table := findTable(schema.Table{Schema: database.DefaultSchemaName, Name: "group_test"}, database, t)
+	ownerCol := findColumn(table, "owner_id", t)
+
+	matches, err := database.SearchSchema(schema.SchemaQuery{Text: "GROUP_"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tableMatches := 0
+	for _, match := range matches {
+		if match.Kind == schema.TableMatch {
+			tableMatches++
+		}
+	}
+	checkInt(2, tableMatches, "tables matching group_", t)
+
+	// column filters leave out the group_owner table and its id column
+	matches, err = database.SearchSchema(schema.SchemaQuery{Text: "^owner_", IsRegex: true, TypeName: "INT"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkInt(1, len(matches), "int columns matching ^owner_", t)
+	if len(matches) == 1 && matches[0].Column != ownerCol {
+		t.Errorf("matched %s.%s, expected %s.%s", matches[0].Table, matches[0].Column, table, ownerCol)
+	}
+
+	notNull := false
+	matches, err = database.SearchSchema(schema.SchemaQuery{Text: "owner_id", Nullable: &notNull})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, match := range matches {
+		if match.Column == ownerCol {
+			t.Error("nullable column " + ownerCol.Name + " matched not null search")
+		}
+	}
+
+	_, err = database.SearchSchema(schema.SchemaQuery{Text: "(", IsRegex: true})
+	if err == nil {
+		t.Error("invalid regex didn't give an error")
+	}
+}
+
+func checkValueSearch(dbReader driver_interface.DbReader, database *schema.Database, t *testing.T) {
+	table := findTable(schema.Table{Schema: database.DefaultSchemaName, Name: "search_test"}, database, t)
+	labelCol := findColumn(table, "label", t)
+	idCol := findColumn(table, "id", t)
+
+	targets := reader.SearchTargets(database, "quokka", nil)
+	foundLabel := false
+	for _, target := range targets {
+		if target.Column == idCol {
+			t.Error("text value shouldn't be searched for in int column " + table.String() + ".id")
+		}
+		if target.Column == labelCol {
+			foundLabel = true
+		}
+	}
+	if !foundLabel {
+		t.Fatal("text column " + table.String() + ".label not searched")
+	}
+
+	result := reader.SearchValue(dbReader, database.Name, "quokka", targets, 60)
+	checkInt(len(targets), result.Searched, "columns searched for quokka", t)
+	for _, failure := range result.Failures {
+		t.Errorf("search of %s.%s failed: %s", failure.Table, failure.Column, failure.Error)
+	}
+	checkInt(1, len(result.Hits), "columns holding quokka", t)
+	if len(result.Hits) == 1 {
+		checkStr(labelCol.Name, result.Hits[0].Column.Name, "column holding quokka", t)
+		checkInt(1, result.Hits[0].RowCount, "rows holding quokka", t)
+	}
+
+	// searches that run out of time cancel their queries rather than leave them running
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := dbReader.GetRowCountContext(ctx, database.Name, table, &params.TableParams{}); err == nil {
+		t.Error("expected counting with a cancelled context to fail")
+	}
+
+	// limit to one table with the include list
+	targets = reader.SearchTargets(database, "2", []*regexp.Regexp{regexp.MustCompile(`group_test\.`)})
+	checkInt(3, len(targets), "columns of group_test that could hold 2", t)
+}
+
 // Poke all the things that might fall over if a bit of escaping has been missed.
 // The names in here are necessarily confusing and misleading because the table has sql keywords for names.
 func checkKeywordEscaping(dbReader driver_interface.DbReader, database *schema.Database, t *testing.T) {
@@ -663,6 +1218,363 @@ func checkPeeking(dbReader driver_interface.DbReader, database *schema.Database,
 	}
 }
 
+// relies on the peek column set up by checkPeeking
+func checkColumnSelection(dbReader driver_interface.DbReader, database *schema.Database, t *testing.T) {
+	table := findTable(schema.Table{Schema: database.DefaultSchemaName, Name: "peek"}, database, t)
+	idCol := findColumn(table, "id", t)
+	somethingCol := findColumn(table, "something", t)
+	filterCol := findColumn(table, "dumb_filter", t)
+	pokeIdCol := findColumn(table, "poke_id", t)
+	pikeIdCol := findColumn(table, "pike_id", t)
+	peekFk := table.Fks[0]
+
+	tableParams := params.TableParams{RowLimit: 999, Sort: []params.SortCol{{Column: idCol}}}
+	tableParams = tableParams.HideColumn(table, idCol).HideColumn(table, pokeIdCol).HideColumn(table, pikeIdCol)
+	tableParams = tableParams.MoveColumn(table, filterCol, -1)
+	checkStr("dumb_filter,something", tableParams.Columns.String(), "shown columns", t)
+	checkStr("id,poke_id,pike_id", tableParams.HiddenColumns(table).String(), "hidden columns", t)
+
+	// keys are still selected so that links can be built
+	checkStr("dumb_filter,something,id,poke_id", tableParams.SelectColumns(table).String(), "selected columns", t)
+
+	query, err := url.ParseQuery(string(tableParams.AsQueryString()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkStr("dumb_filter,something", params.ParseTableParams(query, table).Columns.String(), "columns parsed from query string", t)
+
+	data, peek, err := reader.GetRows(dbReader, database.Name, table, &tableParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkInt(4, len(data), "rows with selected columns", t)
+	checkInt(4+len(peekFk.DestinationTable.PeekColumns), len(data[0]), "columns in result set with selected columns", t)
+	checkInt(0, peek.ColumnIndex(filterCol), "data index of first shown column", t)
+	checkStr("wiggy", fmt.Sprintf("%s", data[0][peek.ColumnIndex(somethingCol)]), "selected column value", t)
+	checkStr("11", *reader.DbValueToString(data[0][peek.ColumnIndex(pokeIdCol)], pokeIdCol.Type), "fk column value", t)
+	checkStr("piggy", fmt.Sprintf("%s", data[0][peek.Find(peekFk, peekFk.DestinationTable.PeekColumns[0])]), "peeked value with selected columns", t)
+
+	// poke, joined for the peeked value, has a dumb_filter too, so sorting on the hidden one must say which it means
+	hiddenSortParams := params.TableParams{RowLimit: 999, Sort: []params.SortCol{{Column: filterCol}, {Column: idCol, Descending: true}}}
+	hiddenSortParams = hiddenSortParams.HideColumn(table, filterCol)
+	data, peek, err = reader.GetRows(dbReader, database.Name, table, &hiddenSortParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkInt(4, len(data), "rows sorted on a hidden column", t)
+
+	tableParams = tableParams.ShowAllColumns()
+	if tableParams.SelectColumns(table) != nil {
+		t.Fatal("expected all columns to be selected without a column list")
+	}
+
+	// names can have commas in, so the query string can't separate them with commas
+	commaCol := &schema.Column{Name: "last, first"}
+	otherCol := &schema.Column{Name: "other"}
+	commaTable := &schema.Table{Name: "people", Columns: schema.ColumnList{otherCol, commaCol}}
+	commaParams := params.TableParams{}.MoveColumn(commaTable, commaCol, -1)
+	query, err = url.ParseQuery(string(commaParams.AsQueryString()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsedColumns := params.ParseTableParams(query, commaTable).Columns
+	if len(parsedColumns) != 2 || parsedColumns[0] != commaCol || parsedColumns[1] != otherCol {
+		t.Fatalf("expected the column with a comma in its name to be moved first, got %s", parsedColumns)
+	}
+}
+
+// sorting and filtering on peeked values and inbound counts, relies on the peek column set up by checkPeeking
+func checkRelatedValues(dbReader driver_interface.DbReader, database *schema.Database, t *testing.T) {
+	peekTable := findTable(schema.Table{Schema: database.DefaultSchemaName, Name: "peek"}, database, t)
+	pokeTable := findTable(schema.Table{Schema: database.DefaultSchemaName, Name: "poke"}, database, t)
+	pokeIdCol := findColumn(pokeTable, "id", t)
+	peekFk := peekTable.Fks[0]
+	peekKey := "poke_id" + "~peek." + peekFk.DestinationTable.PeekColumns[0].Name
+	peekCountKey := "~count." + peekTable.String() + ".poke_id"
+	cozTable := findTable(schema.Table{Schema: database.DefaultSchemaName, Name: "coz"}, database, t)
+	cozCountKey := "~count." + cozTable.String() + ".poke_id"
+
+	// filter on a peeked value, counting needs the peek join as well
+	peekParams := params.ParseTableParams(url.Values{peekKey: {"piggy"}}, peekTable)
+	if len(peekParams.Filter) != 1 || peekParams.Filter[0].Related == nil {
+		t.Fatal("expected a filter on the peeked value")
+	}
+	checkStr(peekKey+"=piggy", string(peekParams.AsQueryString()), "peek filter query string", t)
+	rowCount, err := dbReader.GetRowCount(database.Name, peekTable, peekParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkInt(1, rowCount, "rows with peeked value", t)
+	peekParams.RowLimit = 10
+	rows, _, err := reader.GetRows(dbReader, database.Name, peekTable, peekParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkInt(1, len(rows), "rows read with peeked value", t)
+
+	// rows that nothing refers to
+	countParams := params.ParseTableParams(url.Values{peekCountKey: {"0"}}, pokeTable)
+	countParams.RowLimit = 10
+	rows, peek, err := reader.GetRows(dbReader, database.Name, pokeTable, countParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkInt(1, len(rows), "rows with no inbound references", t)
+	checkStr("13", *reader.DbValueToString(rows[0][peek.ColumnIndex(pokeIdCol)], pokeIdCol.Type), "row with no inbound references", t)
+
+	// most referenced first, sort keys round trip through the query string
+	sortParams := params.ParseTableParams(url.Values{"_sort": {cozCountKey + "~desc,id"}, "_rowLimit": {"10"}}, pokeTable)
+	checkStr("_sort="+cozCountKey+"~desc,id&_rowLimit=10", string(sortParams.AsQueryString()), "count sort query string", t)
+	if sortParams.KeysetColumns(pokeTable) != nil {
+		t.Fatal("expected no keyset paging when sorted on a count")
+	}
+	rows, peek, err = reader.GetRows(dbReader, database.Name, pokeTable, sortParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkInt(3, len(rows), "rows sorted by inbound count", t)
+	var ids []string
+	for _, row := range rows {
+		ids = append(ids, *reader.DbValueToString(row[peek.ColumnIndex(pokeIdCol)], pokeIdCol.Type))
+	}
+	checkStr("11,12,13", strings.Join(ids, ","), "rows sorted by inbound count", t)
+}
+
+func checkSqlText(dbReader driver_interface.DbReader, database *schema.Database, t *testing.T) {
+	peekTable := findTable(schema.Table{Schema: database.DefaultSchemaName, Name: "peek"}, database, t)
+	pokeTable := findTable(schema.Table{Schema: database.DefaultSchemaName, Name: "poke"}, database, t)
+	peekKey := "poke_id" + "~peek." + peekTable.Fks[0].DestinationTable.PeekColumns[0].Name
+	cozTable := findTable(schema.Table{Schema: database.DefaultSchemaName, Name: "coz"}, database, t)
+	cozCountKey := "~count." + cozTable.String() + ".poke_id"
+
+	// the shown statement should get the same rows when run elsewhere
+	checkSqlTextRows := func(table *schema.Table, query url.Values, expectedLiteral string) {
+		tableParams := params.ParseTableParams(query, table)
+		rows, peekFinder, err := reader.GetRows(dbReader, database.Name, table, tableParams)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sqlText := dbReader.GetSqlText(database.Name, table, tableParams, peekFinder)
+		if strings.Contains(sqlText, "?") || strings.Contains(sqlText, "$1") {
+			t.Fatalf("expected no placeholders in sql text: %s", sqlText)
+		}
+		if !strings.Contains(sqlText, expectedLiteral) {
+			t.Fatalf("expected %s in sql text: %s", expectedLiteral, sqlText)
+		}
+		result, err := dbReader.RunQuery(database.Name, sqlText, 100, 10*time.Second)
+		if err != nil {
+			t.Fatalf("sql text failed to run: %s\n%s", err, sqlText)
+		}
+		checkInt(len(rows), len(result.Rows), "rows from running sql text "+sqlText, t)
+	}
+	checkSqlTextRows(peekTable, url.Values{peekKey: {"piggy"}, "_rowLimit": {"10"}}, "'piggy'")
+	checkSqlTextRows(pokeTable, url.Values{"_sort": {cozCountKey + "~desc,id"}, "_rowLimit": {"10"}}, "count(*)")
+	checkSqlTextRows(pokeTable, url.Values{"name": {"it's"}}, "'it''s'")
+
+	// mssql's strings are shown as nvarchar to match the parameters, so plans and comparisons are the same
+	for literals, expected := range map[driver_interface.StringLiterals]string{
+		driver_interface.StandardStrings:         `select * from t where a = 'it''s\' and b = 1`,
+		driver_interface.BackslashEscapedStrings: `select * from t where a = 'it''s\\' and b = 1`,
+		driver_interface.NationalStrings:         `select * from t where a = N'it''s\' and b = 1`,
+	} {
+		checkStr(expected, driver_interface.InlineValues("select * from t where a = ? and b = ?", []interface{}{`it's\`, 1}, literals), "inlined string", t)
+	}
+}
+
+func checkQueryPlan(dbReader driver_interface.DbReader, database *schema.Database, t *testing.T) {
+	peekTable := findTable(schema.Table{Schema: database.DefaultSchemaName, Name: "peek"}, database, t)
+	tableParams := params.ParseTableParams(url.Values{"poke_id": {"11"}, "_rowLimit": {"10"}}, peekTable)
+	plan, sqlText, err := reader.GetQueryPlan(dbReader, database.Name, peekTable, tableParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(sqlText, "peek") {
+		t.Fatalf("expected the explained sql to read peek: %s", sqlText)
+	}
+	if plan == nil || plan.Label == "" {
+		t.Fatal("expected a query plan")
+	}
+	// the peek join means at least two steps somewhere in the tree
+	var countSteps func(node *driver_interface.PlanNode) int
+	countSteps = func(node *driver_interface.PlanNode) int {
+		count := 1
+		for _, child := range node.Children {
+			count += countSteps(child)
+		}
+		return count
+	}
+	if countSteps(plan) < 2 {
+		t.Fatalf("expected more than one step in the query plan, got %s", plan.Label)
+	}
+
+	// values are sent as parameters where explain allows, mysql's have to be inlined and are refused if that isn't reliable
+	pokeTable := findTable(schema.Table{Schema: database.DefaultSchemaName, Name: "poke"}, database, t)
+	tableParams = params.ParseTableParams(url.Values{"name": {`it's \' or 1=1`}}, pokeTable)
+	plan, _, err = reader.GetQueryPlan(dbReader, database.Name, pokeTable, tableParams)
+	if err != nil && !strings.Contains(err.Error(), "can't be quoted reliably") {
+		t.Fatal(err)
+	}
+	if err == nil && plan == nil {
+		t.Fatal("expected a query plan with a quote and backslash in the filter")
+	}
+}
+
+func checkJoinPaths(dbReader driver_interface.DbReader, database *schema.Database, t *testing.T) {
+	cozTable := findTable(schema.Table{Schema: database.DefaultSchemaName, Name: "coz"}, database, t)
+	pokeTable := findTable(schema.Table{Schema: database.DefaultSchemaName, Name: "poke"}, database, t)
+	peekTable := findTable(schema.Table{Schema: database.DefaultSchemaName, Name: "peek"}, database, t)
+	parentTable := findTable(schema.Table{Schema: database.DefaultSchemaName, Name: "CompoundKeyParent"}, database, t)
+	auntyTable := findTable(schema.Table{Schema: database.DefaultSchemaName, Name: "CompoundKeyAunty"}, database, t)
+	sortFilterTable := findTable(schema.Table{Schema: database.DefaultSchemaName, Name: "SortFilterTest"}, database, t)
+
+	checkJoinSql := func(from *schema.Table, path schema.JoinPath) {
+		sqlText := dbReader.GetJoinSql(database.Name, driver_interface.JoinQueryFromPath(from, path))
+		_, err := dbReader.RunQuery(database.Name, sqlText, 100, 10*time.Second)
+		if err != nil {
+			t.Fatalf("join sql failed to run: %s\n%s", err, sqlText)
+		}
+	}
+
+	paths := database.FindJoinPaths(cozTable, peekTable, 10)
+	checkInt(1, len(paths), "paths from coz to peek", t)
+	checkInt(2, len(paths[0]), "steps from coz to peek", t)
+	if paths[0][0].To() != pokeTable || paths[0][1].Forward {
+		t.Fatalf("expected coz to peek to go via poke and back along peek's fk, got %v", paths[0].Tables())
+	}
+	checkJoinSql(cozTable, paths[0])
+
+	// both columns of the compound fk need to be in the join
+	paths = database.FindJoinPaths(parentTable, auntyTable, 10)
+	checkInt(1, len(paths), "paths from CompoundKeyParent to CompoundKeyAunty", t)
+	checkInt(2, len(paths[0]), "steps from CompoundKeyParent to CompoundKeyAunty", t)
+	checkInt(2, len(paths[0][0].FromColumns()), "columns of compound join", t)
+	checkJoinSql(parentTable, paths[0])
+
+	paths = database.FindJoinPaths(peekTable, peekTable, 10)
+	checkInt(1, len(paths), "paths from a table to itself", t)
+	checkInt(0, len(paths[0]), "steps from a table to itself", t)
+
+	if paths = database.FindJoinPaths(sortFilterTable, peekTable, 10); paths != nil {
+		t.Fatalf("expected no paths between unconnected tables, got %v", paths)
+	}
+}
+
+func checkTrailJoin(dbReader driver_interface.DbReader, database *schema.Database, t *testing.T) {
+	cozTable := findTable(schema.Table{Schema: database.DefaultSchemaName, Name: "coz"}, database, t)
+	pokeTable := findTable(schema.Table{Schema: database.DefaultSchemaName, Name: "poke"}, database, t)
+	peekTable := findTable(schema.Table{Schema: database.DefaultSchemaName, Name: "peek"}, database, t)
+	sortFilterTable := findTable(schema.Table{Schema: database.DefaultSchemaName, Name: "SortFilterTest"}, database, t)
+
+	// poke isn't in the trail but is needed to get from peek to coz
+	join, unjoined := driver_interface.JoinQueryForTables(database, []*schema.Table{peekTable, sortFilterTable, cozTable, peekTable})
+	checkInt(3, len(join.Tables), "tables joined for trail", t)
+	if join.Tables[1].Table != pokeTable || join.Tables[2].Table != cozTable || join.Tables[2].JoinedTo != 1 {
+		t.Fatalf("expected peek, poke then coz joined to poke")
+	}
+	checkInt(1, len(unjoined), "unjoined trail tables", t)
+
+	_, nameCol := pokeTable.FindColumn("name")
+	join.Filters = []driver_interface.JoinFilter{{TableIndex: 1, Column: nameCol, Value: "piggy"}}
+	sqlText := dbReader.GetJoinSql(database.Name, join)
+	result, err := dbReader.RunQuery(database.Name, sqlText, 100, 10*time.Second)
+	if err != nil {
+		t.Fatalf("trail sql failed to run: %s\n%s", err, sqlText)
+	}
+	if len(result.Rows) == 0 {
+		t.Fatalf("expected rows from trail sql: %s", sqlText)
+	}
+}
+
+func checkUntrustedFks(database *schema.Database, t *testing.T) {
+	peekTable := findTable(schema.Table{Schema: database.DefaultSchemaName, Name: "peek"}, database, t)
+	if peekTable.Fks[0].NotTrusted {
+		t.Errorf("%s should be trusted", peekTable.Fks[0])
+	}
+	table := database.FindTable(&schema.Table{Schema: database.DefaultSchemaName, Name: "not_valid_child"})
+	if table == nil {
+		t.Log("No not_valid_child table, fks added without checking rows not supported")
+		return
+	}
+	checkInt(1, len(table.Fks), "fks on "+table.String(), t)
+	if len(table.Fks) == 1 && !table.Fks[0].NotTrusted {
+		t.Errorf("%s was added not valid so shouldn't be trusted", table.Fks[0])
+	}
+}
+
+func checkQuery(dbReader driver_interface.DbReader, database *schema.Database, t *testing.T) {
+	cozTable := findTable(schema.Table{Schema: database.DefaultSchemaName, Name: "coz"}, database, t)
+	pokeTable := findTable(schema.Table{Schema: database.DefaultSchemaName, Name: "poke"}, database, t)
+
+	for _, allowed := range []string{"-- the usual\nselect 1;", "select 'a;b' as x", "select 1 -- done; really\n", "select 1 /* ; */ ;", "select 'commit' as [into], replace('a', 'a', 'b') as \"set\""} {
+		if reader.ValidateQuery(allowed) != nil {
+			t.Fatalf("expected query to be allowed: %s", allowed)
+		}
+	}
+	for _, rejected := range []string{"delete from coz", "select 1; delete from coz", "select ';'; delete from coz", "  ",
+		"select 1 commit delete from coz", "select * into outfile '/tmp/coz' from coz", "select 'into' as x into @x"} {
+		if reader.ValidateQuery(rejected) == nil {
+			t.Fatalf("expected query to be rejected: %s", rejected)
+		}
+	}
+
+	query := "select c.id, c.poke_id, p.name as poke_name from coz c join poke p on p.id = c.poke_id order by c.id"
+	result, err := reader.RunQuery(dbReader, database.Name, query, 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkStr("id,poke_id,poke_name", strings.ToLower(strings.Join(result.Columns, ",")), "query result columns", t)
+	checkInt(1, len(result.Rows), "query rows up to the limit", t)
+	if !result.Truncated {
+		t.Fatal("expected query results to be truncated at the row limit")
+	}
+
+	tables := reader.QueryTables(database, query)
+	checkInt(2, len(tables), "tables in query", t)
+	if tables[0] != cozTable || tables[1] != pokeTable {
+		t.Fatalf("expected tables coz and poke in query, got %s and %s", tables[0], tables[1])
+	}
+	sources := reader.QueryColumnSources(tables, result.Columns, result.TypeNames)
+	if sources[0].Column != nil {
+		t.Fatal("expected id to be untraced as both tables have one")
+	}
+	if sources[1].Column != findColumn(cozTable, "poke_id", t) {
+		t.Fatal("expected poke_id to be traced to coz")
+	}
+	if sources[2].Column != nil {
+		t.Fatal("expected aliased column to be untraced")
+	}
+
+	// the same name but not the same value, e.g. a uuid converted to text, mustn't be formatted or linked as the original column
+	query = "select cast(id as char(10)) as id from poke"
+	result, err = reader.RunQuery(dbReader, database.Name, query, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sources = reader.QueryColumnSources(reader.QueryTables(database, query), result.Columns, result.TypeNames)
+	if sources[0].Column != nil {
+		t.Fatalf("expected id converted to %s to be untraced", result.TypeNames[0])
+	}
+
+	// bypasses the validation to check the transaction doesn't let anything change
+	_, err = dbReader.RunQuery(database.Name, "delete from coz", 10, 10*time.Second)
+	rowCount, countErr := dbReader.GetRowCount(database.Name, cozTable, &params.TableParams{})
+	if countErr != nil {
+		t.Fatal(countErr)
+	}
+	checkInt(2, rowCount, fmt.Sprintf("coz rows after attempted delete (error: %v)", err), t)
+
+	// sql server runs statements in a batch without semicolons, a commit would end the transaction before the delete
+	_, err = reader.RunQuery(dbReader, database.Name, "select 1 commit delete from coz", 10, 0)
+	if err == nil {
+		t.Fatal("expected a batch committing and deleting to be rejected")
+	}
+	rowCount, countErr = dbReader.GetRowCount(database.Name, cozTable, &params.TableParams{})
+	if countErr != nil {
+		t.Fatal(countErr)
+	}
+	checkInt(2, rowCount, "coz rows after attempted commit and delete", t)
+}
+
 func checkInboundPeeking(dbReader driver_interface.DbReader, database *schema.Database, t *testing.T) {
 	table := findTable(schema.Table{Schema: database.DefaultSchemaName, Name: "poke"}, database, t)
 	idCol := findColumn(table, "id", t)
@@ -723,7 +1635,7 @@ var tests = []testCase{
 	// The headings are just to make it easier to navigate the list in reality there will be arbitary sharing.
 	// i.e. something in sqlite section might also test the pg database if the results are expected to be the same,
 	// that test will not be repeated in the pg section.
-	// todo: homogenize type reading - varchar(20) -> "varchar" + length info
+	// expectedType is the base type name, sizes are checked separately in checkDataTypes
 	// sqlite
 	{colName: "field_int", row: 0, expectedType: "INT", expectedString: "20"},
 	{colName: "field_int", row: 1, expectedType: "INT", expectedString: "-33"},
@@ -736,12 +1648,12 @@ var tests = []testCase{
 	{colName: "field_int2", row: 0, expectedType: "INT2", expectedString: "100"},
 	{colName: "field_int8", row: 0, expectedType: "INT8", expectedString: "110"},
 	{colName: "field_numeric", row: 0, expectedType: "numeric", expectedString: "987.12345"},
-	{colName: "field_character", row: 0, expectedType: "CHARACTER(20)", expectedString: "a_CHARACTER"},
-	{colName: "field_sqlite_varchar", row: 0, expectedType: "VARCHAR(255)", expectedString: "a_VARCHAR"},
-	{colName: "field_varying", row: 0, expectedType: "VARYING CHARACTER(255)", expectedString: "a_VARYING"},
-	{colName: "field_nchar", row: 0, expectedType: "NCHAR(55)", expectedString: "a_NCHAR"},
-	{colName: "field_native", row: 0, expectedType: "NATIVE CHARACTER(70)", expectedString: "a_NATIVE"},
-	{colName: "field_nvarchar", row: 0, expectedType: "NVARCHAR(100)", expectedString: "a_NVARCHAR"},
+	{colName: "field_character", row: 0, expectedType: "CHARACTER", expectedString: "a_CHARACTER"},
+	{colName: "field_sqlite_varchar", row: 0, expectedType: "VARCHAR", expectedString: "a_VARCHAR"},
+	{colName: "field_varying", row: 0, expectedType: "VARYING CHARACTER", expectedString: "a_VARYING"},
+	{colName: "field_nchar", row: 0, expectedType: "NCHAR", expectedString: "a_NCHAR"},
+	{colName: "field_native", row: 0, expectedType: "NATIVE CHARACTER", expectedString: "a_NATIVE"},
+	{colName: "field_nvarchar", row: 0, expectedType: "NVARCHAR", expectedString: "a_NVARCHAR"},
 	{colName: "field_text", row: 0, expectedType: "TEXT", expectedString: "a_TEXT"},
 	{colName: "field_clob", row: 0, expectedType: "CLOB", expectedString: "a_CLOB"},
 	{colName: "field_blob", row: 0, expectedType: "BLOB", expectedString: "[97 95 66 76 79 66]"},
@@ -749,7 +1661,7 @@ var tests = []testCase{
 	{colName: "field_double", row: 0, expectedType: "DOUBLE", expectedString: "1.234"},
 	{colName: "field_doubleprecision", row: 0, expectedType: "DOUBLE PRECISION", expectedString: "1.234"},
 	{colName: "field_float", row: 0, expectedType: "FLOAT", expectedString: "1.234"},
-	{colName: "field_sqlite_decimal", row: 0, expectedType: "DECIMAL(10,5)", expectedString: "1.234"},
+	{colName: "field_sqlite_decimal", row: 0, expectedType: "DECIMAL", expectedString: "1.234"},
 	{colName: "field_boolean", row: 0, expectedType: "BOOLEAN", expectedString: "true"},
 	{colName: "field_boolean", row: 1, expectedType: "BOOLEAN", expectedString: "false"},
 	// todo: all timezone variant things
@@ -764,9 +1676,9 @@ var tests = []testCase{
 	{colName: "field_jsonb", row: 0, expectedType: "jsonb", expectedString: "[{\"name\": \"frank\"}, {\"name\": \"sinatra\"}]"},
 	// mysql
 	{colName: "field_mysql_int", row: 0, expectedType: "int", expectedString: "20"},
-	{colName: "field_mysql_character", row: 0, expectedType: "char(20)", expectedString: "a_CHARACTER"},
-	{colName: "field_mysql_nchar", row: 0, expectedType: "char(55)", expectedString: "a_NCHAR"},
-	{colName: "field_mysql_nvarchar", row: 0, expectedType: "varchar(100)", expectedString: "a_NVARCHAR"},
+	{colName: "field_mysql_character", row: 0, expectedType: "char", expectedString: "a_CHARACTER"},
+	{colName: "field_mysql_nchar", row: 0, expectedType: "char", expectedString: "a_NCHAR"},
+	{colName: "field_mysql_nvarchar", row: 0, expectedType: "varchar", expectedString: "a_NVARCHAR"},
 	{colName: "field_mysql_real", row: 0, expectedType: "double", expectedString: "1.234"},
 	{colName: "field_mysql_doubleprecision", row: 0, expectedType: "double", expectedString: "1.234"},
 	{colName: "field_mysql_boolean", row: 0, expectedType: "tinyint", expectedString: "1"}, // gah! mysql
@@ -822,7 +1734,7 @@ func Test_GetRows(t *testing.T) {
 		}
 
 		actualType := table.Columns[columnIndex].Type
-		if !strings.EqualFold(actualType, test.expectedType) {
+		if !strings.EqualFold(actualType.Name, test.expectedType) {
 			t.Errorf("Incorrect column type for field '%s': '%s', expected '%s'", test.colName, actualType, test.expectedType)
 		}
 		// todo: check type of retrieved value, turns out you can put anything you like in sqlite cols
@@ -840,6 +1752,258 @@ func Test_GetRows(t *testing.T) {
 	}
 }
 
+func Test_InferFks(t *testing.T) {
+	dbReader := reader.GetDbReader()
+	databaseName := getDatabaseName()
+	rules, err := reader.ParseFkInferenceRules([]string{"# comment", "", "^(.+)_id$ => ${1}s.id"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkInt(1, len(rules), "inference rules", t)
+	for _, validate := range []bool{false, true} {
+		database, err := dbReader.ReadSchema(databaseName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		database.Name = databaseName
+		_, err = reader.InferFks(dbReader, database, rules, validate)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ordersTable := findTable(schema.Table{Schema: database.DefaultSchemaName, Name: "infer_orders"}, database, t)
+		customerCol := findColumn(ordersTable, "infer_customer_id", t)
+		checkInt(1, len(customerCol.Fks), fmt.Sprintf("inferred fks on %s.%s, validate %t", ordersTable, customerCol, validate), t)
+		if len(customerCol.Fks) == 1 {
+			fk := customerCol.Fks[0]
+			if !fk.IsInferred() {
+				t.Errorf("%s should be marked as inferred", fk)
+			}
+			checkStr("infer_customers", fk.DestinationTable.Name, "inferred fk destination table", t)
+			checkStr("id", fk.DestinationColumns[0].Name, "inferred fk destination column", t)
+			checkInt(1, len(fk.DestinationTable.InboundFks), "inbound fks on "+fk.DestinationTable.String(), t)
+		}
+
+		notesTable := findTable(schema.Table{Schema: database.DefaultSchemaName, Name: "infer_order_notes"}, database, t)
+		orderCol := findColumn(notesTable, "infer_order_id", t)
+		expectedNoteFks := 1
+		if validate {
+			expectedNoteFks = 0 // none of the values exist in infer_orders
+		}
+		checkInt(expectedNoteFks, len(orderCol.Fks), fmt.Sprintf("inferred fks on %s.%s, validate %t", notesTable, orderCol, validate), t)
+	}
+}
+
+func Test_VirtualFks(t *testing.T) {
+	dbReader := reader.GetDbReader()
+	databaseName := getDatabaseName()
+	database, err := dbReader.ReadSchema(databaseName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := []string{
+		"# comment",
+		"",
+		"VIRTUAL_CHILD(Parent_Ref) => virtual_parent(id)",
+		"virtual_child(no_such_column) => virtual_parent(id)",
+		"virtual_child parent_ref virtual_parent id",
+		"virtual_child(parent_ref) => virtual_parent(id)", // already added by the first line
+	}
+	added, errs := reader.AddVirtualFks(database, lines)
+	checkInt(1, len(added), "virtual fks added", t)
+	checkInt(3, len(errs), "virtual fk errors", t)
+
+	childTable := findTable(schema.Table{Schema: database.DefaultSchemaName, Name: "virtual_child"}, database, t)
+	parentTable := findTable(schema.Table{Schema: database.DefaultSchemaName, Name: "virtual_parent"}, database, t)
+	parentRefCol := findColumn(childTable, "parent_ref", t)
+	checkInt(1, len(parentRefCol.Fks), "virtual fks on "+childTable.String()+".parent_ref", t)
+	checkInt(1, len(childTable.Fks), "fks on "+childTable.String(), t)
+	checkInt(1, len(parentTable.InboundFks), "inbound fks on "+parentTable.String(), t)
+	checkInt(1, len(findColumn(parentTable, "id", t).InboundFks), "inbound fks on "+parentTable.String()+".id", t)
+	if len(parentRefCol.Fks) == 1 {
+		fk := parentRefCol.Fks[0]
+		if !fk.IsVirtual() {
+			t.Errorf("%s should be marked as virtual", fk)
+		}
+		if fk.DestinationTable != parentTable {
+			t.Errorf("%s should point at %s", fk, parentTable)
+		}
+		found := false
+		for _, databaseFk := range database.Fks {
+			found = found || databaseFk == fk
+		}
+		if !found {
+			t.Errorf("%s missing from database fks", fk)
+		}
+
+		orphans, err := dbReader.GetOrphans(databaseName, fk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkInt(2, orphans.RowCount, "orphaned rows in "+childTable.String(), t)
+		checkInt(1, len(orphans.ValueCounts), "missing values for "+fk.String(), t)
+		if len(orphans.ValueCounts) == 1 {
+			checkStr("99", *reader.DbValueToString(orphans.ValueCounts[0].Values[0], parentRefCol.Type), "missing value", t)
+			checkInt(2, orphans.ValueCounts[0].Quantity, "rows with missing value", t)
+		}
+
+		// the orphans pages run the same check in the background
+		reader.StartOrphanChecks(dbReader, databaseName, []*schema.Fk{fk}, true)
+		jobs := waitForOrphanChecks(databaseName, []*schema.Fk{fk}, t)
+		if jobs[0].Error != nil {
+			t.Fatal(jobs[0].Error)
+		}
+		checkStr("done", jobs[0].Status.String(), "status of orphan check of "+fk.String(), t)
+		checkInt(2, jobs[0].Result.RowCount, "orphaned rows found in the background in "+childTable.String(), t)
+	}
+
+	arrayChildTable := database.FindTable(&schema.Table{Schema: database.DefaultSchemaName, Name: "virtual_array_child"})
+	if arrayChildTable == nil {
+		t.Log("No virtual_array_child table, arrays not supported")
+		return
+	}
+	added, errs = reader.AddVirtualFks(database, []string{"virtual_array_child(parent_refs) => virtual_parent(id)"})
+	checkInt(1, len(added), "virtual array fks added", t)
+	checkInt(0, len(errs), "virtual array fk errors", t)
+	if len(added) == 1 {
+		// {1,99} and {98,99} each have a value that's missing, even though 1 is found
+		orphans, err := dbReader.GetOrphans(databaseName, added[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkInt(2, orphans.RowCount, "orphaned rows in "+arrayChildTable.String(), t)
+		checkInt(2, len(orphans.ValueCounts), "missing values for "+added[0].String(), t)
+		if len(orphans.ValueCounts) == 2 {
+			idCol := findColumn(parentTable, "id", t)
+			checkStr("99", *reader.DbValueToString(orphans.ValueCounts[0].Values[0], idCol.Type), "most common missing array value", t)
+			checkInt(2, orphans.ValueCounts[0].Quantity, "rows with missing array value", t)
+		}
+	}
+}
+
+func Test_AnalysisJobs(t *testing.T) {
+	dbReader := reader.GetDbReader()
+	databaseName := getDatabaseName()
+	database, err := dbReader.ReadSchema(databaseName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	table := findTable(schema.Table{Schema: database.DefaultSchemaName, Name: "analysis_stats_test"}, database, t)
+	amountCol := findColumn(table, "amount", t)
+
+	sample := schema.AnalysisSample{FirstRows: 2}
+	reader.StartAnalysis(dbReader, databaseName, table, table.Columns, false, sample)
+	jobs := waitForAnalysis(databaseName, table, sample, t)
+	for _, job := range jobs {
+		if job.Status != reader.AnalysisDone {
+			t.Errorf("analysis of %s %s, expected done: %v", job.Column, job.Status, job.Error)
+		}
+	}
+	checkInt(2, jobs[amountCol.Position].Result.RowCount, "sampled rows analysed in amount", t)
+	checkInt(2, jobs[amountCol.Position].Result.Sample.FirstRows, "sample size for amount", t)
+	firstRun := jobs[amountCol.Position].Finished
+
+	// cached unless re-run
+	reader.StartAnalysis(dbReader, databaseName, table, table.Columns, false, sample)
+	jobs = waitForAnalysis(databaseName, table, sample, t)
+	if jobs[amountCol.Position].Finished != firstRun {
+		t.Error("analysis of amount should have been cached")
+	}
+
+	reader.StartAnalysis(dbReader, databaseName, table, []*schema.Column{amountCol}, true, sample)
+	jobs = waitForAnalysis(databaseName, table, sample, t)
+	if !jobs[amountCol.Position].Finished.After(firstRun) {
+		t.Error("analysis of amount should have been re-run")
+	}
+	checkInt(2, jobs[amountCol.Position+1].Result.RowCount, "rows analysed in column that wasn't re-run", t)
+
+	// another sample isn't answered from the first one's results
+	wholeTable := schema.AnalysisSample{}
+	reader.StartAnalysis(dbReader, databaseName, table, []*schema.Column{amountCol}, true, wholeTable)
+	jobs = waitForAnalysis(databaseName, table, wholeTable, t)
+	checkInt(4, jobs[amountCol.Position].Result.RowCount, "rows analysed in amount with the whole table", t)
+	checkStr("the whole table", jobs[amountCol.Position].Result.Sample.String(), "sample of amount", t)
+	jobs = reader.GetAnalysisJobs(databaseName, table, sample)
+	checkInt(2, jobs[amountCol.Position].Result.RowCount, "rows analysed in amount with the first sample", t)
+
+	// every page of the table is in a 100% sample
+	if database.Supports.TableSample {
+		percentSample := schema.AnalysisSample{Percent: 100}
+		reader.StartAnalysis(dbReader, databaseName, table, []*schema.Column{amountCol}, true, percentSample)
+		jobs = waitForAnalysis(databaseName, table, percentSample, t)
+		checkInt(4, jobs[amountCol.Position].Result.RowCount, "rows analysed in amount with a 100% tablesample", t)
+		checkInt(100, jobs[amountCol.Position].Result.Sample.Percent, "sample percentage for amount", t)
+	}
+}
+
+func checkAnalysisSampleChoice(dbPrefix string, schemaPrefix string, router *mux.Router, database *schema.Database, t *testing.T) {
+	rerunPath := fmt.Sprintf("%s/tables/%sanalysis_test/analyse-data/rerun", dbPrefix, schemaPrefix)
+	request, _ := http.NewRequest("POST", rerunPath, strings.NewReader(url.Values{"sample": {"rows"}, "sampleRows": {"2"}}.Encode()))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	checkInt(303, response.Code, "status of re-run with a sample", t)
+	checkStr(fmt.Sprintf("%s/tables/%sanalysis_test/analyse-data?sample=rows&sampleRows=2", dbPrefix, schemaPrefix), response.Header().Get("Location"), "redirect keeping the sample chosen", t)
+	request, _ = http.NewRequest("GET", fmt.Sprintf("%s/tables/%sanalysis_test/analyse-data?sample=rows&sampleRows=2", dbPrefix, schemaPrefix), nil)
+	response = httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	checkInt(200, response.Code, "status of analysis page with a sample", t)
+	if !strings.Contains(response.Body.String(), `value="rows" checked`) {
+		t.Error("sample of the re-run should be selected on the analysis page")
+	}
+
+	checkFormPost(rerunPath, url.Values{"sample": {"rows"}, "sampleRows": {"0"}}, router, 400, t)
+	checkFormPost(rerunPath, url.Values{"sample": {"percent"}, "samplePercent": {"101"}}, router, 400, t)
+	if !database.Supports.TableSample {
+		checkFormPost(rerunPath, url.Values{"sample": {"percent"}, "samplePercent": {"10"}}, router, 400, t)
+	}
+}
+
+// Runs the analysis of every column of the whole table in the background as the analysis page does
+func analyseTable(dbReader driver_interface.DbReader, databaseName string, table *schema.Table, t *testing.T) (analysis []schema.ColumnAnalysis) {
+	reader.StartAnalysis(dbReader, databaseName, table, table.Columns, true, schema.AnalysisSample{})
+	for _, job := range waitForAnalysis(databaseName, table, schema.AnalysisSample{}, t) {
+		if job.Error != nil {
+			t.Fatal(job.Error)
+		}
+		analysis = append(analysis, job.Result)
+	}
+	return
+}
+
+// Waits for the columns that have been started to finish
+func waitForAnalysis(databaseName string, table *schema.Table, sample schema.AnalysisSample, t *testing.T) (jobs []reader.AnalysisJob) {
+	for attempt := 0; attempt < 100; attempt++ {
+		jobs = reader.GetAnalysisJobs(databaseName, table, sample)
+		finished := true
+		for _, job := range jobs {
+			finished = finished && (job.Status == reader.AnalysisNotStarted || job.Status.IsFinished())
+		}
+		if finished {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	t.Fatalf("analysis of %s didn't finish", table)
+	return
+}
+
+func waitForOrphanChecks(databaseName string, fks []*schema.Fk, t *testing.T) (jobs []reader.OrphanJob) {
+	for attempt := 0; attempt < 100; attempt++ {
+		jobs = reader.GetOrphanJobs(databaseName, fks)
+		finished := true
+		for _, job := range jobs {
+			finished = finished && (job.Status == reader.AnalysisNotStarted || job.Status.IsFinished())
+		}
+		if finished {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	t.Fatalf("orphan checks didn't finish")
+	return
+}
+
 // error if not found
 func findTable(tableToFind schema.Table, database *schema.Database, t *testing.T) *schema.Table {
 	table := database.FindTable(&tableToFind)
@@ -884,7 +2048,54 @@ func Test_Http(t *testing.T) {
 	CheckForOk(fmt.Sprintf("%s/tables/%sDataTypeTest", dbPrefix, schemaPrefix), router, t)
 	CheckForOk(fmt.Sprintf("%s/tables/%sDataTypeTest/data", dbPrefix, schemaPrefix), router, t)
 	CheckForOk(fmt.Sprintf("%s/tables/%sanalysis_test/analyse-data", dbPrefix, schemaPrefix), router, t)
+	CheckForOk(fmt.Sprintf("%s/tables/%sanalysis_test/analyse-data/status", dbPrefix, schemaPrefix), router, t)
+	CheckForStatusWithMethodAndBody(fmt.Sprintf("%s/tables/%sanalysis_test/analyse-data/rerun", dbPrefix, schemaPrefix), "POST", router, 303, "", t)
+	checkAnalysisSampleChoice(dbPrefix, schemaPrefix, router, database, t)
+	CheckForOk(fmt.Sprintf("%s/orphans", dbPrefix), router, t)
+	CheckForStatusWithMethodAndBody(fmt.Sprintf("%s/orphans/rerun", dbPrefix), "POST", router, 303, "", t)
+	CheckForOk(fmt.Sprintf("%s/tables/%spet/orphans", dbPrefix, schemaPrefix), router, t)
+	CheckForStatusWithMethodAndBody(fmt.Sprintf("%s/tables/%spet/orphans/rerun", dbPrefix, schemaPrefix), "POST", router, 303, "", t)
+	CheckForOk(fmt.Sprintf("%s/tables/%sgroup_test/group-by", dbPrefix, schemaPrefix), router, t)
+	CheckForOk(fmt.Sprintf("%s/search", dbPrefix), router, t)
+	CheckForOk(fmt.Sprintf("%s/search?q=quokka", dbPrefix), router, t)
+	CheckForOk(fmt.Sprintf("%s/schema-search?q=owner&type=int&nullable=yes", dbPrefix), router, t)
+	CheckForOk(fmt.Sprintf("%s/schema-search?q=(&regex=on", dbPrefix), router, t)
+	CheckForOk(fmt.Sprintf("%s/query", dbPrefix), router, t)
+	CheckForOk(fmt.Sprintf("%s/query?sql=%s", dbPrefix, url.QueryEscape("select id, poke_id from coz")), router, t)
+	checkFormPost(fmt.Sprintf("%s/query", dbPrefix), url.Values{"sql": {"select id, poke_id from coz"}}, router, 200, t)
+	// a link can only fill in the form, e.g. from another site
+	linkRequest, _ := http.NewRequest("GET", fmt.Sprintf("%s/query?sql=%s", dbPrefix, url.QueryEscape("select id, poke_id from coz")), nil)
+	linkResponse := httptest.NewRecorder()
+	router.ServeHTTP(linkResponse, linkRequest)
+	if strings.Contains(linkResponse.Body.String(), "data-table-view") {
+		t.Fatal("expected a query from a link not to be run")
+	}
+	checkFormPost(fmt.Sprintf("%s/query", dbPrefix), url.Values{"sql": {"delete from coz"}}, router, 200, t)
+	CheckForStatus(fmt.Sprintf("%s/query?sql=select+1&rowLimit=lots", dbPrefix), router, 400, t)
+	CheckForOk(fmt.Sprintf("%s/tables/%sgroup_test/group-by?_groupBy=status,owner_id&status=open", dbPrefix, schemaPrefix), router, t)
+	CheckForOk(fmt.Sprintf("%s/tables/%speek/explain?poke_id=11", dbPrefix, schemaPrefix), router, t)
+	CheckForStatus(fmt.Sprintf("%s/tables/%snosuchtable/explain", dbPrefix, schemaPrefix), router, 404, t)
+	CheckForOk(fmt.Sprintf("%s/join-path", dbPrefix), router, t)
+	CheckForOk(fmt.Sprintf("%s/join-path?from=%scoz&to=%speek", dbPrefix, schemaPrefix, schemaPrefix), router, t)
+	CheckForStatus(fmt.Sprintf("%s/join-path?from=%scoz&to=%snosuchtable", dbPrefix, schemaPrefix, schemaPrefix), router, 404, t)
+	CheckForStatus(fmt.Sprintf("%s/tables/%sgroup_test/group-by?_groupBy=id,status,owner_id", dbPrefix, schemaPrefix), router, 400, t)
+	if database.FindTable(&schema.Table{Schema: database.DefaultSchemaName, Name: "enum_test"}) != nil {
+		CheckForOk(fmt.Sprintf("%s/tables/%senum_test?mood=happy", dbPrefix, schemaPrefix), router, t)
+	}
+	CheckForOk(fmt.Sprintf("%s/tables/%sbinary_test/data", dbPrefix, schemaPrefix), router, t)
+	checkCellDownload(fmt.Sprintf("%s/tables/%sbinary_test/cell/content?id=1", dbPrefix, schemaPrefix), "image/png", 12, router, t)
+	checkCellDownload(fmt.Sprintf("%s/tables/%sbinary_test/cell/content?id=1&_cols=id", dbPrefix, schemaPrefix), "image/png", 12, router, t)
+	CheckForStatus(fmt.Sprintf("%s/tables/%sbinary_test/cell/content?id=3", dbPrefix, schemaPrefix), router, 404, t)
+	CheckForStatus(fmt.Sprintf("%s/tables/%sbinary_test/cell/content", dbPrefix, schemaPrefix), router, 404, t)
+	if database.FindTable(&schema.Table{Schema: database.DefaultSchemaName, Name: "spatial_test"}) != nil {
+		CheckForOk(fmt.Sprintf("%s/tables/%sspatial_test", dbPrefix, schemaPrefix), router, t)
+		CheckForOk(fmt.Sprintf("%s/tables/%sspatial_test/geojson/area?id=1", dbPrefix, schemaPrefix), router, t)
+	}
 	CheckForOk(fmt.Sprintf("%s/table-trail", dbPrefix), router, t)
+	CheckForOk(fmt.Sprintf("%s/table-trail/sql", dbPrefix), router, t)
+	CheckForOk(fmt.Sprintf("%s/table-trail/sql?tables=%speek,%scoz&filterTable=%speek&filter=poke_id%%3D11", dbPrefix, schemaPrefix, schemaPrefix, schemaPrefix), router, t)
+	checkSavedViews(dbPrefix, schemaPrefix, router, databaseName, t)
+	checkHistory(dbPrefix, schemaPrefix, router, t)
 	CheckForStatus("/setup", router, 403, t)
 	CheckForStatus("/setup/pg", router, 403, t)
 	CheckForStatusWithMethod("/setup/pg", "POST", router, 403, t)
@@ -894,6 +2105,122 @@ func Test_Http(t *testing.T) {
 	}
 }
 
+func checkHistory(dbPrefix string, schemaPrefix string, router *mux.Router, t *testing.T) {
+	CheckForOk(fmt.Sprintf("%s/history", dbPrefix), router, t)
+
+	// the same browser session throughout
+	var sessionCookie *http.Cookie
+	get := func(path string, expectedStatus int) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest("GET", path, nil)
+		if sessionCookie != nil {
+			request.AddCookie(sessionCookie)
+		}
+		response := httptest.NewRecorder()
+		router.ServeHTTP(response, request)
+		if response.Code != expectedStatus {
+			t.Fatalf("%d status for %s, expected %d", response.Code, path, expectedStatus)
+		}
+		for _, cookie := range response.Result().Cookies() {
+			if cookie.Name == "sse-session" {
+				sessionCookie = cookie
+			}
+		}
+		return response
+	}
+	// only table pages start a session, not e.g. crawlers of the other pages
+	get(fmt.Sprintf("%s/history/export", dbPrefix), 200)
+	get(fmt.Sprintf("%s/history/0", dbPrefix), 404)
+	if sessionCookie != nil {
+		t.Fatal("expected no session to be started without visiting a table")
+	}
+	get(fmt.Sprintf("%s/tables/%speek/data?poke_id=11", dbPrefix, schemaPrefix), 200)
+	get(fmt.Sprintf("%s/tables/%speek/data?poke_id=11&_skip=1", dbPrefix, schemaPrefix), 200) // paging isn't another step
+	get(fmt.Sprintf("%s/tables/%spoke/data?id=11", dbPrefix, schemaPrefix), 200)
+	page := get(fmt.Sprintf("%s/tables/%scoz/data?poke_id=11", dbPrefix, schemaPrefix), 200)
+	if !strings.Contains(page.Body.String(), "history-breadcrumbs") {
+		t.Fatal("expected breadcrumbs on data page")
+	}
+
+	export := get(fmt.Sprintf("%s/history/export", dbPrefix), 200).Body.String()
+	checkInt(3, strings.Count(export, "/tables/"), "steps in exported history:\n"+export, t)
+	checkInt(2, strings.Count(export, " via "), "fks followed in exported history:\n"+export, t)
+	if !strings.Contains(export, "/tables/"+schemaPrefix+"poke?id=11#data") {
+		t.Fatalf("expected permalink to filtered poke in exported history:\n%s", export)
+	}
+
+	// going back forgets the later steps
+	back := get(fmt.Sprintf("%s/history/1", dbPrefix), 302)
+	checkStr(fmt.Sprintf("%s/tables/%spoke?id=11#data", dbPrefix, schemaPrefix), back.Header().Get("Location"), "redirect to history step", t)
+	export = get(fmt.Sprintf("%s/history/export", dbPrefix), 200).Body.String()
+	checkInt(2, strings.Count(export, "/tables/"), "steps in exported history after going back:\n"+export, t)
+	get(fmt.Sprintf("%s/history/5", dbPrefix), 404)
+	get(fmt.Sprintf("%s/history/clear", dbPrefix), 302)
+	export = get(fmt.Sprintf("%s/history/export", dbPrefix), 200).Body.String()
+	checkStr("", export, "exported history after clearing", t)
+}
+
+func checkSavedViews(dbPrefix string, schemaPrefix string, router *mux.Router, databaseName string, t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "sse-saved-views")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+	savedViewsPath := filepath.Join(tempDir, "saved-views.db")
+	options.Options.SavedViewsPath = savedViewsPath
+	defer func() { options.Options.SavedViewsPath = "" }()
+
+	CheckForOk(fmt.Sprintf("%s/saved", dbPrefix), router, t)
+	tableView := url.Values{
+		"name":        {"peeks of piggy"},
+		"description": {"the usual"},
+		"table":       {schemaPrefix + "peek"},
+		"tableParams": {"poke_id=11&_cols=something&_cols=poke_id&_skip=10"},
+	}
+	checkFormPost(fmt.Sprintf("%s/saved", dbPrefix), tableView, router, 303, t)
+	checkFormPost(fmt.Sprintf("%s/saved", dbPrefix), url.Values{"sql": {"select * from coz"}}, router, 400, t)
+	checkFormPost(fmt.Sprintf("%s/saved", dbPrefix), url.Values{"name": {"coz"}, "sql": {"select * from coz"}}, router, 303, t)
+	CheckForOk(fmt.Sprintf("%s/saved", dbPrefix), router, t)
+
+	// read back from the file to check they were persisted
+	store, err := saved.Open(savedViewsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	views, err := store.ForDatabase(databaseName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(views) != 2 {
+		t.Fatalf("expected 2 saved views, got %d", len(views))
+	}
+	queryView, tableViewSaved := views[0], views[1]
+	checkStr("select * from coz", queryView.Sql, "saved query", t)
+	checkStr("the usual", tableViewSaved.Description, "saved view description", t)
+	checkStr("poke_id=11&_cols=something&_cols=poke_id", tableViewSaved.TableParams, "saved table params, without the offset", t)
+
+	request, _ := http.NewRequest("GET", fmt.Sprintf("%s/saved/%s", dbPrefix, tableViewSaved.Id), nil)
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	checkInt(302, response.Code, "status of saved view link", t)
+	checkStr(fmt.Sprintf("%s/tables/%speek?%s#data", dbPrefix, schemaPrefix, tableViewSaved.TableParams), response.Header().Get("Location"), "saved view redirect", t)
+	CheckForStatus(fmt.Sprintf("%s/saved/%s", dbPrefix, queryView.Id), router, 302, t)
+	CheckForStatus(fmt.Sprintf("%s/saved/nosuchview", dbPrefix), router, 404, t)
+
+	checkFormPost(fmt.Sprintf("%s/saved/%s/delete", dbPrefix, queryView.Id), url.Values{}, router, 303, t)
+	CheckForStatus(fmt.Sprintf("%s/saved/%s", dbPrefix, queryView.Id), router, 404, t)
+}
+
+func checkFormPost(path string, form url.Values, router *mux.Router, expectedStatus int, t *testing.T) {
+	request, _ := http.NewRequest("POST", path, strings.NewReader(form.Encode()))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	if response.Code != expectedStatus {
+		t.Fatalf("%d status for POST %s, expected %d: %s", response.Code, path, expectedStatus, response.Body.String())
+	}
+}
+
 func descriptionTests(dbPrefix string, schemaPrefix string, router *mux.Router, t *testing.T, databaseName string, database *schema.Database) {
 	table := schema.Table{Schema: database.DefaultSchemaName, Name: "person"}
 	// add
@@ -954,6 +2281,17 @@ func CheckForOk(path string, router *mux.Router, t *testing.T) {
 	CheckForStatus(path, router, 200, t)
 }
 
+func checkCellDownload(path string, expectedContentType string, expectedLength int, router *mux.Router, t *testing.T) {
+	request, _ := http.NewRequest("GET", path, nil)
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	if response.Code != 200 {
+		t.Fatalf("%d status for %s, expected 200", response.Code, path)
+	}
+	checkStr(expectedContentType, response.Header().Get("Content-Type"), "content type of "+path, t)
+	checkInt(expectedLength, response.Body.Len(), "length of "+path, t)
+}
+
 func CheckForStatus(path string, router *mux.Router, expectedStatus int, t *testing.T) {
 	CheckForStatusWithMethod(path, "GET", router, expectedStatus, t)
 }
@@ -0,0 +1,90 @@
+package trail
+
+import (
+	"github.com/timabell/schema-explorer/params"
+	"github.com/timabell/schema-explorer/schema"
+	"fmt"
+	"strings"
+)
+
+// Beyond this the oldest steps are dropped
+const maxHistorySteps = 50
+
+// The pages of rows a user has been through, in order, for retracing their steps
+type History struct {
+	Steps []HistoryStep
+}
+
+type HistoryStep struct {
+	Table   string
+	Query   string // filters, sort etc of the page as a query string, e.g. "poke_id=11&_sort=id"
+	Filters string // just the filters, e.g. "poke_id=11"
+	ViaFk   string // the fk followed from the step before, e.g. "coz(poke_id) => poke(id)", empty if not reached along one
+}
+
+// Relative to the database, e.g. "/tables/poke?id=11#data"
+func (step HistoryStep) Url() string {
+	return fmt.Sprintf("/tables/%s?%s#data", step.Table, step.Query)
+}
+
+// Adds a page of the table unless it's the same as the latest step, e.g. when paging
+func (history *History) AddStep(table *schema.Table, tableParams params.TableParams) {
+	query := string(tableParams.ClearPaging().AsQueryString())
+	var filtered schema.ColumnList
+	for _, filter := range tableParams.Filter {
+		if filter.Field != nil && len(filter.JsonPath) == 0 {
+			filtered = append(filtered, filter.Field)
+		}
+	}
+	var viaFk string
+	if len(history.Steps) > 0 {
+		latest := history.Steps[len(history.Steps)-1]
+		if latest.Table == table.String() && latest.Query == query {
+			return
+		}
+		if fk := followedFk(latest.Table, table, filtered); fk != nil {
+			viaFk = strings.TrimSpace(fk.String()) // unnamed fks start with a space
+		}
+	}
+	history.Steps = append(history.Steps, HistoryStep{Table: table.String(), Query: query, Filters: string(tableParams.Filter.AsQueryString()), ViaFk: viaFk})
+	if len(history.Steps) > maxHistorySteps {
+		history.Steps = history.Steps[len(history.Steps)-maxHistorySteps:]
+	}
+}
+
+// Drops the steps after the given one, for going back to it. False if there's no such step.
+func (history *History) BackTo(stepIndex int) bool {
+	if stepIndex < 0 || stepIndex >= len(history.Steps) {
+		return false
+	}
+	history.Steps = history.Steps[:stepIndex+1]
+	return true
+}
+
+// The fk whose link would have been followed to get from a row of the previous table to the filtered table.
+// Links to referenced rows filter on the fk's destination columns, links to referencing rows on its source columns.
+func followedFk(previousTable string, table *schema.Table, filtered schema.ColumnList) *schema.Fk {
+	for _, fk := range table.InboundFks {
+		if fk.SourceTable.String() == previousTable && sameColumns(fk.DestinationColumns, filtered) {
+			return fk
+		}
+	}
+	for _, fk := range table.Fks {
+		if fk.DestinationTable.String() == previousTable && sameColumns(fk.SourceColumns, filtered) {
+			return fk
+		}
+	}
+	return nil
+}
+
+func sameColumns(fkColumns schema.ColumnList, filtered schema.ColumnList) bool {
+	if len(fkColumns) != len(filtered) {
+		return false
+	}
+	for _, col := range fkColumns {
+		if !filtered.Contains(col) {
+			return false
+		}
+	}
+	return true
+}
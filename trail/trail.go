@@ -6,8 +6,10 @@ import (
 )
 
 type TrailLog struct {
-	Tables  []string
-	Dynamic bool // whether this is dynamic from cookies or is from a permalink, for altering UI
+	Tables       []string
+	FiltersTable string // the table of the last data page visited, for carrying its filters into the trail's sql
+	Filters      string // that page's filters as a query string, e.g. "poke_id=11", empty if it wasn't filtered
+	Dynamic      bool   // whether this is dynamic from cookies or is from a permalink, for altering UI
 }
 
 func (trail TrailLog) AsCsv() string {
@@ -25,3 +27,9 @@ func (trail *TrailLog) AddTable(table *schema.Table) {
 		trail.Tables = append(trail.Tables, table.String())
 	}
 }
+
+// Remembers the filters of the latest data page, replacing those of any earlier page
+func (trail *TrailLog) SetFilters(table *schema.Table, filters string) {
+	trail.FiltersTable = table.String()
+	trail.Filters = filters
+}